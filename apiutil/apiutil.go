@@ -20,14 +20,17 @@ import (
 	"io"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nlnwa/veidemann-api/go/commons/v1"
 	commonsV1 "github.com/nlnwa/veidemann-api/go/commons/v1"
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
 	"github.com/nlnwa/veidemannctl/connection"
 	"github.com/nlnwa/veidemannctl/format"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	empty "google.golang.org/protobuf/types/known/emptypb"
 )
 
 // CreateSelector creates a label selector from a string.
@@ -281,3 +284,25 @@ func CompleteName(kind string, name string) ([]string, error) {
 	}
 	return names, nil
 }
+
+// WaitForRunStatus polls the crawler status every interval until it reports the wanted run status
+// or the context is done.
+func WaitForRunStatus(ctx context.Context, client controllerV1.ControllerClient, want controllerV1.RunStatus, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := client.Status(ctx, &empty.Empty{})
+		if err == nil && status.GetRunStatus() == want {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("crawler did not report %s: %w", want, err)
+			}
+			return fmt.Errorf("crawler did not report %s, last status was %s: %w", want, status.GetRunStatus(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
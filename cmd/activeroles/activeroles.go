@@ -16,15 +16,24 @@ package activeroles
 import (
 	"context"
 	"fmt"
+	"os"
 
 	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
 	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/nlnwa/veidemannctl/format"
 	"github.com/spf13/cobra"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 )
 
+type options struct {
+	format     string
+	goTemplate string
+}
+
 func NewCmd() *cobra.Command {
-	return &cobra.Command{
+	o := &options{}
+
+	cmd := &cobra.Command{
 		GroupID:      "debug",
 		Use:          "activeroles",
 		Short:        "Get the active roles for the currently logged in user",
@@ -45,10 +54,18 @@ func NewCmd() *cobra.Command {
 				return err
 			}
 
-			for _, role := range r.Role {
-				fmt.Println(role)
+			s, err := format.NewFormatter("RoleList", os.Stdout, o.format, o.goTemplate)
+			if err != nil {
+				return fmt.Errorf("error creating formatter: %w", err)
 			}
-			return nil
+			defer s.Close()
+
+			return s.WriteRecord(r)
 		},
 	}
+
+	cmd.Flags().StringVarP(&o.format, "output", "o", "table", "Output format (table|json|yaml|template|template-file)")
+	cmd.Flags().StringVarP(&o.goTemplate, "template", "t", "", "A Go template used to format the output")
+
+	return cmd
 }
@@ -23,6 +23,7 @@ import (
 	configcmd "github.com/nlnwa/veidemannctl/cmd/config"
 	"github.com/nlnwa/veidemannctl/cmd/create"
 	deletecmd "github.com/nlnwa/veidemannctl/cmd/delete"
+	"github.com/nlnwa/veidemannctl/cmd/exporter"
 	"github.com/nlnwa/veidemannctl/cmd/get"
 	importcmd "github.com/nlnwa/veidemannctl/cmd/import"
 	"github.com/nlnwa/veidemannctl/cmd/logconfig"
@@ -33,6 +34,7 @@ import (
 	"github.com/nlnwa/veidemannctl/cmd/run"
 	"github.com/nlnwa/veidemannctl/cmd/script_parameters"
 	"github.com/nlnwa/veidemannctl/cmd/status"
+	"github.com/nlnwa/veidemannctl/cmd/top"
 	"github.com/nlnwa/veidemannctl/cmd/unpause"
 	"github.com/nlnwa/veidemannctl/cmd/update"
 	"github.com/nlnwa/veidemannctl/config"
@@ -97,9 +99,11 @@ func NewRootCmd() *cobra.Command {
 		ID:    "status",
 		Title: "Management Commands:",
 	})
-	cmd.AddCommand(status.NewCmd())  // status
-	cmd.AddCommand(pause.NewCmd())   // pause
-	cmd.AddCommand(unpause.NewCmd()) // unpause
+	cmd.AddCommand(status.NewCmd())   // status
+	cmd.AddCommand(top.NewCmd())      // top
+	cmd.AddCommand(exporter.NewCmd()) // exporter
+	cmd.AddCommand(pause.NewCmd())    // pause
+	cmd.AddCommand(unpause.NewCmd())  // unpause
 
 	cmd.AddGroup(&cobra.Group{
 		ID:    "login",
@@ -24,6 +24,7 @@ import (
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
 	"github.com/nlnwa/veidemannctl/connection"
 	"github.com/nlnwa/veidemannctl/format"
+	"github.com/nlnwa/veidemannctl/importutil"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -111,6 +112,11 @@ func run(o *options) error {
 			Msg("Failed to save config object")
 	}
 
+	// Report progress while saving
+	progress := importutil.NewProgress("create")
+	progress.Start()
+	defer progress.Stop()
+
 	var wg sync.WaitGroup
 	for i := 0; i < o.concurrency; i++ {
 		wg.Add(1)
@@ -118,14 +124,16 @@ func run(o *options) error {
 			defer wg.Done()
 			for co := range result {
 				// validate
-				err = validate(co)
+				err := validate(co)
 				if err != nil {
 					handleError(co, fmt.Errorf("validation failed: %w", err))
+					progress.Done(err)
 					continue
 				}
 				// save
 				for attempts := 0; attempts < 3; attempts++ {
-					r, err := client.SaveConfigObject(context.Background(), co)
+					var r *configV1.ConfigObject
+					r, err = client.SaveConfigObject(context.Background(), co)
 					s, ok := status.FromError(err)
 					if ok && s.Code() == codes.Unauthenticated {
 						// retry if unauthenticated
@@ -139,6 +147,7 @@ func run(o *options) error {
 					log.Info().Str("kind", r.GetKind().String()).Str("meta.name", r.Meta.Name).Str("id", r.Id).Msg("Saved config object")
 					break
 				}
+				progress.Done(err)
 			}
 		}()
 	}
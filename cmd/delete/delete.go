@@ -23,6 +23,7 @@ import (
 	"github.com/nlnwa/veidemannctl/apiutil"
 	"github.com/nlnwa/veidemannctl/connection"
 	"github.com/nlnwa/veidemannctl/format"
+	"github.com/nlnwa/veidemannctl/importutil"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -124,6 +125,12 @@ func run(o *options) error {
 		return nil
 	}
 
+	// Report progress while deleting
+	progress := importutil.NewProgress("delete")
+	progress.SetTotal(int(count.Count))
+	progress.Start()
+	defer progress.Stop()
+
 	var deleted int
 	for {
 		msg, err := r.Recv()
@@ -142,6 +149,7 @@ func run(o *options) error {
 		}
 
 		r, err := client.DeleteConfigObject(context.Background(), request)
+		progress.Done(err)
 		if err != nil {
 			log.Error().Err(err).Str("id", msg.Id).Msgf("Could not delete object")
 			continue
@@ -150,6 +158,7 @@ func run(o *options) error {
 			deleted++
 		}
 	}
+	progress.Stop()
 	log.Info().Msgf("Deleted %d objects of %d selected", deleted, count.Count)
 
 	return nil
@@ -0,0 +1,298 @@
+// Copyright © 2017 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
+	frontierV1 "github.com/nlnwa/veidemann-api/go/frontier/v1"
+	reportV1 "github.com/nlnwa/veidemann-api/go/report/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+)
+
+const namespace = "veidemann"
+
+// failureStates are the crawl execution states counted as failures.
+var failureStates = []frontierV1.CrawlExecutionStatus_State{
+	frontierV1.CrawlExecutionStatus_FAILED,
+	frontierV1.CrawlExecutionStatus_DIED,
+	frontierV1.CrawlExecutionStatus_ABORTED_TIMEOUT,
+	frontierV1.CrawlExecutionStatus_ABORTED_SIZE,
+	frontierV1.CrawlExecutionStatus_ABORTED_MANUAL,
+}
+
+// collector polls Veidemann and updates metrics.
+type collector struct {
+	controller controllerV1.ControllerClient
+	report     reportV1.ReportClient
+
+	queueSize               prometheus.Gauge
+	busyCrawlHostGroups     prometheus.Gauge
+	paused                  prometheus.Gauge
+	runningJobExecutions    prometheus.Gauge
+	fetchingCrawlExecutions prometheus.Gauge
+	jobDocumentsCrawled     *prometheus.GaugeVec
+	jobBytesCrawled         *prometheus.GaugeVec
+	jobDocumentsFailed      *prometheus.GaugeVec
+	crawlExecutions         *prometheus.GaugeVec
+	crawlExecutionFailures  *prometheus.CounterVec
+	scrapeErrors            prometheus.Counter
+
+	// failures holds the last seen number of failed crawl executions per state for each running job execution.
+	// A job execution is kept until it has been read once after it stopped running.
+	failures map[string]map[string]int32
+}
+
+// newCollector creates a collector and registers its metrics with reg.
+func newCollector(reg prometheus.Registerer, controller controllerV1.ControllerClient, report reportV1.ReportClient) *collector {
+	jobLabels := []string{"job_id", "job_execution_id"}
+
+	c := &collector{
+		controller: controller,
+		report:     report,
+		queueSize: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "queue_size",
+			Help:      "Total number of queued URIs.",
+		}),
+		busyCrawlHostGroups: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "busy_crawl_host_groups",
+			Help:      "Number of busy crawl host groups.",
+		}),
+		paused: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "paused",
+			Help:      "1 if the crawler is paused, 0 otherwise.",
+		}),
+		runningJobExecutions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "running_job_executions",
+			Help:      "Number of running job executions.",
+		}),
+		fetchingCrawlExecutions: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "fetching_crawl_executions",
+			Help:      "Number of crawl executions currently fetching.",
+		}),
+		jobDocumentsCrawled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "job_execution_documents_crawled",
+			Help:      "Number of documents crawled by a running job execution.",
+		}, jobLabels),
+		jobBytesCrawled: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "job_execution_bytes_crawled",
+			Help:      "Number of bytes crawled by a running job execution.",
+		}, jobLabels),
+		jobDocumentsFailed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "job_execution_documents_failed",
+			Help:      "Number of documents failed by a running job execution.",
+		}, jobLabels),
+		crawlExecutions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "crawl_executions",
+			Help:      "Number of crawl executions in running job executions by state.",
+		}, []string{"state"}),
+		crawlExecutionFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "crawl_execution_failures_total",
+			Help:      "Number of crawl executions observed to end in a failed or aborted state.",
+		}, []string{"state"}),
+		scrapeErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "exporter_scrape_errors_total",
+			Help:      "Number of failed attempts to get status from Veidemann.",
+		}),
+		failures: make(map[string]map[string]int32),
+	}
+
+	reg.MustRegister(
+		c.queueSize,
+		c.busyCrawlHostGroups,
+		c.paused,
+		c.runningJobExecutions,
+		c.fetchingCrawlExecutions,
+		c.jobDocumentsCrawled,
+		c.jobBytesCrawled,
+		c.jobDocumentsFailed,
+		c.crawlExecutions,
+		c.crawlExecutionFailures,
+		c.scrapeErrors,
+	)
+
+	// initialize failure counters so they are exported before the first failure
+	for _, state := range failureStates {
+		c.crawlExecutionFailures.WithLabelValues(state.String())
+	}
+
+	return c
+}
+
+// update gets status from Veidemann and updates the metrics.
+func (c *collector) update(ctx context.Context) error {
+	err := c.collect(ctx)
+	if err != nil {
+		c.scrapeErrors.Inc()
+	}
+	return err
+}
+
+func (c *collector) collect(ctx context.Context) error {
+	status, err := c.controller.Status(ctx, &empty.Empty{})
+	if err != nil {
+		return fmt.Errorf("failed to get crawler status: %w", err)
+	}
+
+	jobExecutions, err := c.listRunningJobExecutions(ctx)
+	if err != nil {
+		return err
+	}
+
+	fetching, err := c.countFetchingCrawlExecutions(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.queueSize.Set(float64(status.GetQueueSize()))
+	c.busyCrawlHostGroups.Set(float64(status.GetBusyCrawlHostGroupCount()))
+	if status.GetRunStatus() == controllerV1.RunStatus_PAUSED {
+		c.paused.Set(1)
+	} else {
+		c.paused.Set(0)
+	}
+	c.runningJobExecutions.Set(float64(len(jobExecutions)))
+	c.fetchingCrawlExecutions.Set(float64(fetching))
+
+	// job executions come and go, so start from scratch
+	c.jobDocumentsCrawled.Reset()
+	c.jobBytesCrawled.Reset()
+	c.jobDocumentsFailed.Reset()
+	c.crawlExecutions.Reset()
+
+	failures := make(map[string]map[string]int32, len(jobExecutions))
+	states := make(map[string]int32)
+
+	for _, jes := range jobExecutions {
+		c.jobDocumentsCrawled.WithLabelValues(jes.GetJobId(), jes.GetId()).Set(float64(jes.GetDocumentsCrawled()))
+		c.jobBytesCrawled.WithLabelValues(jes.GetJobId(), jes.GetId()).Set(float64(jes.GetBytesCrawled()))
+		c.jobDocumentsFailed.WithLabelValues(jes.GetJobId(), jes.GetId()).Set(float64(jes.GetDocumentsFailed()))
+
+		for state, count := range jes.GetExecutionsState() {
+			states[state] += count
+		}
+
+		failures[jes.GetId()] = c.countFailures(jes)
+	}
+
+	for state, count := range states {
+		c.crawlExecutions.WithLabelValues(state).Set(float64(count))
+	}
+
+	// Count failures between the last update and the end of job executions no longer running
+	var ended []string
+	for id := range c.failures {
+		if _, ok := failures[id]; !ok {
+			ended = append(ended, id)
+		}
+	}
+	if len(ended) > 0 {
+		endedJobExecutions, err := c.listJobExecutions(ctx, &reportV1.JobExecutionsListRequest{Id: ended})
+		if err != nil {
+			// try again on next update
+			for _, id := range ended {
+				failures[id] = c.failures[id]
+			}
+			c.failures = failures
+			return err
+		}
+		for _, jes := range endedJobExecutions {
+			counts := c.countFailures(jes)
+			if jes.GetState() == frontierV1.JobExecutionStatus_RUNNING {
+				failures[jes.GetId()] = counts
+			}
+		}
+	}
+	c.failures = failures
+
+	return nil
+}
+
+// countFailures counts the failures of the job execution since the last update and returns its failure counts.
+func (c *collector) countFailures(jes *frontierV1.JobExecutionStatus) map[string]int32 {
+	last := c.failures[jes.GetId()]
+	counts := make(map[string]int32)
+	for _, s := range failureStates {
+		state := s.String()
+		count := jes.GetExecutionsState()[state]
+		if delta := count - last[state]; delta > 0 {
+			c.crawlExecutionFailures.WithLabelValues(state).Add(float64(delta))
+		}
+		counts[state] = count
+	}
+	return counts
+}
+
+// listRunningJobExecutions returns all running job executions.
+func (c *collector) listRunningJobExecutions(ctx context.Context) ([]*frontierV1.JobExecutionStatus, error) {
+	return c.listJobExecutions(ctx, &reportV1.JobExecutionsListRequest{
+		State: []frontierV1.JobExecutionStatus_State{frontierV1.JobExecutionStatus_RUNNING},
+	})
+}
+
+// listJobExecutions returns the job executions matching the request.
+func (c *collector) listJobExecutions(ctx context.Context, req *reportV1.JobExecutionsListRequest) ([]*frontierV1.JobExecutionStatus, error) {
+	r, err := c.report.ListJobExecutions(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job executions: %w", err)
+	}
+	var result []*frontierV1.JobExecutionStatus
+	for {
+		jes, err := r.Recv()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list job executions: %w", err)
+		}
+		result = append(result, jes)
+	}
+}
+
+// countFetchingCrawlExecutions returns the number of crawl executions currently fetching.
+func (c *collector) countFetchingCrawlExecutions(ctx context.Context) (int, error) {
+	r, err := c.report.ListExecutions(ctx, &reportV1.CrawlExecutionsListRequest{
+		State: []frontierV1.CrawlExecutionStatus_State{frontierV1.CrawlExecutionStatus_FETCHING},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list crawl executions: %w", err)
+	}
+	var count int
+	for {
+		_, err := r.Recv()
+		if errors.Is(err, io.EOF) {
+			return count, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to list crawl executions: %w", err)
+		}
+		count++
+	}
+}
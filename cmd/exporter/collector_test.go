@@ -0,0 +1,215 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
+	frontierV1 "github.com/nlnwa/veidemann-api/go/frontier/v1"
+	reportV1 "github.com/nlnwa/veidemann-api/go/report/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+)
+
+type fakeController struct {
+	controllerV1.ControllerClient
+	status *controllerV1.CrawlerStatus
+	err    error
+}
+
+func (f *fakeController) Status(context.Context, *empty.Empty, ...grpc.CallOption) (*controllerV1.CrawlerStatus, error) {
+	return f.status, f.err
+}
+
+// fakeReport lists job executions by state or id
+type fakeReport struct {
+	reportV1.ReportClient
+	jobExecutions   []*frontierV1.JobExecutionStatus
+	crawlExecutions []*frontierV1.CrawlExecutionStatus
+	// idErr is returned when listing job executions by id
+	idErr error
+}
+
+func (f *fakeReport) ListJobExecutions(_ context.Context, req *reportV1.JobExecutionsListRequest, _ ...grpc.CallOption) (reportV1.Report_ListJobExecutionsClient, error) {
+	if len(req.GetId()) > 0 && f.idErr != nil {
+		return nil, f.idErr
+	}
+	var items []*frontierV1.JobExecutionStatus
+	for _, jes := range f.jobExecutions {
+		if (len(req.GetState()) == 0 || slices.Contains(req.GetState(), jes.GetState())) &&
+			(len(req.GetId()) == 0 || slices.Contains(req.GetId(), jes.GetId())) {
+			items = append(items, jes)
+		}
+	}
+	return &jobExecutionStream{items: items}, nil
+}
+
+func (f *fakeReport) ListExecutions(context.Context, *reportV1.CrawlExecutionsListRequest, ...grpc.CallOption) (reportV1.Report_ListExecutionsClient, error) {
+	return &crawlExecutionStream{items: f.crawlExecutions}, nil
+}
+
+type jobExecutionStream struct {
+	grpc.ClientStream
+	items []*frontierV1.JobExecutionStatus
+}
+
+func (s *jobExecutionStream) Recv() (*frontierV1.JobExecutionStatus, error) {
+	if len(s.items) == 0 {
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
+
+type crawlExecutionStream struct {
+	grpc.ClientStream
+	items []*frontierV1.CrawlExecutionStatus
+}
+
+func (s *crawlExecutionStream) Recv() (*frontierV1.CrawlExecutionStatus, error) {
+	if len(s.items) == 0 {
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
+
+func TestCollectorUpdate(t *testing.T) {
+	controller := &fakeController{
+		status: &controllerV1.CrawlerStatus{
+			RunStatus:               controllerV1.RunStatus_PAUSED,
+			QueueSize:               42,
+			BusyCrawlHostGroupCount: 3,
+		},
+	}
+	report := &fakeReport{
+		jobExecutions: []*frontierV1.JobExecutionStatus{
+			{
+				Id:               "jes1",
+				JobId:            "job1",
+				State:            frontierV1.JobExecutionStatus_RUNNING,
+				DocumentsCrawled: 100,
+				BytesCrawled:     2048,
+				ExecutionsState:  map[string]int32{"FETCHING": 2, "FAILED": 1},
+			},
+		},
+		crawlExecutions: []*frontierV1.CrawlExecutionStatus{{Id: "ces1"}, {Id: "ces2"}},
+	}
+
+	c := newCollector(prometheus.NewRegistry(), controller, report)
+	ctx := context.Background()
+
+	if err := c.update(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		collector prometheus.Collector
+		want      float64
+	}{
+		{"queue size", c.queueSize, 42},
+		{"busy crawl host groups", c.busyCrawlHostGroups, 3},
+		{"paused", c.paused, 1},
+		{"running job executions", c.runningJobExecutions, 1},
+		{"fetching crawl executions", c.fetchingCrawlExecutions, 2},
+		{"documents crawled", c.jobDocumentsCrawled.WithLabelValues("job1", "jes1"), 100},
+		{"bytes crawled", c.jobBytesCrawled.WithLabelValues("job1", "jes1"), 2048},
+		{"fetching state", c.crawlExecutions.WithLabelValues("FETCHING"), 2},
+		{"failures", c.crawlExecutionFailures.WithLabelValues("FAILED"), 1},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(tt.collector); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// only new failures are counted on subsequent updates
+	report.jobExecutions = []*frontierV1.JobExecutionStatus{
+		{
+			Id:              "jes1",
+			JobId:           "job1",
+			State:           frontierV1.JobExecutionStatus_RUNNING,
+			ExecutionsState: map[string]int32{"FAILED": 3},
+		},
+	}
+	if err := c.update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(c.crawlExecutionFailures.WithLabelValues("FAILED")); got != 3 {
+		t.Errorf("failures: got %v, want 3", got)
+	}
+
+	controller.err = errors.New("unavailable")
+	if err := c.update(ctx); err == nil {
+		t.Error("expected error")
+	}
+	if got := testutil.ToFloat64(c.scrapeErrors); got != 1 {
+		t.Errorf("scrape errors: got %v, want 1", got)
+	}
+}
+
+func TestCollectorEndedJobExecutionFailures(t *testing.T) {
+	controller := &fakeController{status: &controllerV1.CrawlerStatus{}}
+	report := &fakeReport{
+		jobExecutions: []*frontierV1.JobExecutionStatus{
+			{
+				Id:              "jes1",
+				JobId:           "job1",
+				State:           frontierV1.JobExecutionStatus_RUNNING,
+				ExecutionsState: map[string]int32{"FAILED": 1},
+			},
+		},
+	}
+
+	c := newCollector(prometheus.NewRegistry(), controller, report)
+	ctx := context.Background()
+	failed := c.crawlExecutionFailures.WithLabelValues("FAILED")
+
+	if err := c.update(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The job execution fails more crawl executions before it finishes
+	report.jobExecutions[0] = &frontierV1.JobExecutionStatus{
+		Id:              "jes1",
+		JobId:           "job1",
+		State:           frontierV1.JobExecutionStatus_FINISHED,
+		ExecutionsState: map[string]int32{"FAILED": 4},
+	}
+
+	// The baseline is kept while the finished job execution can not be read
+	report.idErr = errors.New("unavailable")
+	if err := c.update(ctx); err == nil {
+		t.Error("expected error")
+	}
+	if got := testutil.ToFloat64(failed); got != 1 {
+		t.Errorf("failures: got %v, want 1", got)
+	}
+
+	report.idErr = nil
+	if err := c.update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(failed); got != 4 {
+		t.Errorf("failures: got %v, want 4", got)
+	}
+
+	// The finished job execution is read only once
+	if err := c.update(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(failed); got != 4 {
+		t.Errorf("failures: got %v, want 4", got)
+	}
+	if len(c.failures) != 0 {
+		t.Errorf("got failure counts %v of ended job executions, want none", c.failures)
+	}
+}
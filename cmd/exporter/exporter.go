@@ -0,0 +1,127 @@
+// Copyright © 2017 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
+	reportV1 "github.com/nlnwa/veidemann-api/go/report/v1"
+	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	listen   string
+	path     string
+	interval time.Duration
+}
+
+func NewCmd() *cobra.Command {
+	o := &options{}
+
+	cmd := &cobra.Command{
+		GroupID: "status",
+		Use:     "exporter",
+		Short:   "Run a Prometheus exporter for crawler status",
+		Long: `Run a Prometheus exporter for crawler status.
+
+Crawler status, running job executions and fetching crawl executions are periodically
+fetched from Veidemann and exposed as metrics in Prometheus text format.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.interval <= 0 {
+				return fmt.Errorf("interval must be positive: %v", o.interval)
+			}
+
+			cmd.SilenceUsage = true
+
+			return run(o)
+		},
+	}
+
+	cmd.Flags().StringVar(&o.listen, "listen", ":9100", "Address to listen on")
+	cmd.Flags().StringVar(&o.path, "path", "/metrics", "Path to expose metrics on")
+	cmd.Flags().DurationVar(&o.interval, "interval", 15*time.Second, "How often to get status from Veidemann")
+
+	return cmd
+}
+
+func run(o *options) error {
+	conn, err := connection.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	reg := prometheus.NewRegistry()
+	c := newCollector(reg, controllerV1.NewControllerClient(conn), reportV1.NewReportClient(conn))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	mux := http.NewServeMux()
+	mux.Handle(o.path, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	server := &http.Server{
+		Addr:              o.listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		update := func() {
+			ctx, cancel := context.WithTimeout(ctx, o.interval)
+			defer cancel()
+			if err := c.update(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to update metrics")
+			}
+		}
+		ticker := time.NewTicker(o.interval)
+		defer ticker.Stop()
+
+		update()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				update()
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info().Str("address", o.listen).Str("path", o.path).Msg("Exporter listening")
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("exporter failed: %w", err)
+	}
+	return nil
+}
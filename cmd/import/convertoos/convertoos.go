@@ -14,42 +14,57 @@
 package convertoos
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
 	"io"
+	"net/url"
 	"os"
-	"path"
 	"strings"
+	"sync"
 	"time"
 
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	logV1 "github.com/nlnwa/veidemann-api/go/log/v1"
 	"github.com/nlnwa/veidemannctl/config"
 	"github.com/nlnwa/veidemannctl/connection"
 	"github.com/nlnwa/veidemannctl/format"
 	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/nlnwa/veidemannctl/logger"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 // ConvertOosCmdOptions is the options for the convert oos command
 type options struct {
-	Filename        string
-	ErrorFile       string
-	OutFile         string
-	Toplevel        bool
-	IgnoreScheme    bool
-	CheckUri        bool
-	CheckUriTimeout time.Duration
-	DbDir           string
-	ResetDb         bool
-	Concurrency     int
-	SkipImport      bool
-	EntityId        string
-	EntityName      string
-	EntityLabels    []string
-	SeedLabels      []string
+	Filename              string
+	FromCrawlLog          bool
+	ExecutionId           string
+	JobExecutionId        string
+	StatusCodes           []int32
+	ErrorFile             string
+	OutFile               string
+	Toplevel              bool
+	IgnoreScheme          bool
+	NormalizerRules       string
+	CheckUri              bool
+	CheckUriTimeout       time.Duration
+	CheckUriRate          float64
+	CheckUriHostRate      float64
+	CheckUriRetries       int
+	CheckUriMaxRetryAfter time.Duration
+	CheckUriSoft404       bool
+	Accept                []string
+	DbDir                 string
+	ResetDb               bool
+	Concurrency           int
+	SkipImport            bool
+	EntityId              string
+	EntityName            string
+	EntityLabels          []string
+	SeedLabels            []string
 }
 
 // NewCmd creates the convert oos command
@@ -59,23 +74,50 @@ func NewCmd() *cobra.Command {
 	var cmd = &cobra.Command{
 		Use:   "convertoos",
 		Short: "Convert Out of Scope file(s) to seed import file",
-		Long:  ``,
-		Args:  cobra.NoArgs,
+		Long: `Convert Out of Scope file(s) to seed import file.
+
+With --from-crawllog the uris are instead read from the crawl log of a crawl execution (--execution-id) or
+a job execution (--job-execution-id), keeping the entries with one of the status codes given by --status,
+which defaults to out of scope (-5000) and blocked (-5001, -5002).
+
+With --toplevel, the default, uris from either input are converted to toplevel uris before they are checked.`,
+		Example: `# Convert the out of scope uris of a job execution to a seed import file
+veidemannctl import convertoos --from-crawllog --job-execution-id 5f3a... -o seeds.json`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.FromCrawlLog && o.ExecutionId == "" && o.JobExecutionId == "" {
+				return errors.New("--from-crawllog requires --execution-id or --job-execution-id")
+			}
+			if !o.FromCrawlLog && (o.ExecutionId != "" || o.JobExecutionId != "") {
+				return errors.New("--execution-id and --job-execution-id require --from-crawllog")
+			}
 			return run(o)
 		},
 	}
 
 	cmd.Flags().StringVarP(&o.Filename, "filename", "f", "", "Filename or directory to read from. "+
 		"If input is a directory, all files ending in .yaml or .json will be tried. An input of '-' will read from stdin.")
-	_ = cmd.MarkFlagRequired("filename")
+	cmd.Flags().BoolVar(&o.FromCrawlLog, "from-crawllog", false, "Read uris from the crawl log of a crawl or job execution instead of from file")
+	cmd.Flags().StringVar(&o.ExecutionId, "execution-id", "", "Crawl execution to read the crawl log of")
+	cmd.Flags().StringVar(&o.JobExecutionId, "job-execution-id", "", "Job execution to read the crawl log of")
+	cmd.Flags().Int32SliceVar(&o.StatusCodes, "status", importutil.ExcludedStatusCodes, "Status codes of crawl log entries to convert")
+	cmd.MarkFlagsOneRequired("filename", "from-crawllog")
+	cmd.MarkFlagsMutuallyExclusive("filename", "from-crawllog")
+	cmd.MarkFlagsMutuallyExclusive("execution-id", "job-execution-id")
 	cmd.Flags().StringVarP(&o.ErrorFile, "err-file", "e", "-", "File to write errors to. '-' writes to stderr.")
 	cmd.Flags().StringVarP(&o.OutFile, "out-file", "o", "-", "File to write result to. '-' writes to stdout.")
-	cmd.Flags().BoolVar(&o.Toplevel, "toplevel", true, "Convert URI to toplevel by removing path")
+	cmd.Flags().BoolVar(&o.Toplevel, "toplevel", true, "Convert URI to toplevel by removing path, query and fragment")
 	cmd.Flags().BoolVar(&o.IgnoreScheme, "ignore-scheme", true, "Ignore the URL's scheme when checking if this URL is already imported.")
+	cmd.Flags().StringVar(&o.NormalizerRules, "normalizer-rules", "", importutil.NormalizerRulesUsage)
 	cmd.Flags().BoolVarP(&o.CheckUri, "check-uri", "", true, "Check the uri for liveness and follow 301")
 	cmd.Flags().DurationVarP(&o.CheckUriTimeout, "check-uri-timeout", "", 2*time.Second, "Timeout when checking uri for liveness")
-	cmd.Flags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db")
+	cmd.Flags().Float64Var(&o.CheckUriRate, "check-uri-rate", 0, "Maximum number of requests per second when checking uris, 0 means unlimited")
+	cmd.Flags().Float64Var(&o.CheckUriHostRate, "check-uri-host-rate", 1, "Maximum number of requests per second to each host when checking uris, 0 means unlimited")
+	cmd.Flags().IntVar(&o.CheckUriRetries, "check-uri-retries", 2, "Number of retries when a server responds with 429 or 503 and a Retry-After header")
+	cmd.Flags().DurationVar(&o.CheckUriMaxRetryAfter, "check-uri-max-retry-after", time.Minute, "Longest Retry-After delay to wait for before retrying, 0 means no limit")
+	cmd.Flags().StringSliceVar(&o.Accept, "accept", nil, importutil.AcceptUsage)
+	cmd.Flags().BoolVar(&o.CheckUriSoft404, "check-uri-soft-404", false, "Fetch reachable pages when checking uris to detect not found pages responding with 200")
+	cmd.Flags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db. \":memory:\" keeps the state in memory for the duration of the command")
 	cmd.Flags().BoolVar(&o.ResetDb, "truncate", false, "Truncate state database")
 	cmd.Flags().IntVarP(&o.Concurrency, "concurrency", "c", 16, "Number of concurrent workers")
 	cmd.Flags().BoolVar(&o.SkipImport, "skip-import", false, "Do not import existing seeds into state database")
@@ -89,6 +131,16 @@ func NewCmd() *cobra.Command {
 
 // run runs the convert oos command
 func run(o *options) error {
+	// Load canonicalization rules for URI keys
+	var uriRules *importutil.UriRules
+	if o.NormalizerRules != "" {
+		var err error
+		uriRules, err = importutil.LoadUriRules(o.NormalizerRules)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Create output writer (file or stdout)
 	out, err := format.ResolveWriter(o.OutFile)
 	if err != nil {
@@ -97,15 +149,16 @@ func run(o *options) error {
 	defer out.Close()
 
 	// Create error writer (file or stderr)
-	var errFile io.WriteCloser
+	var errFile io.Writer
 	if o.ErrorFile == "" || o.ErrorFile == "-" {
-		errFile = os.Stderr
+		errFile = logger.Stderr
 	} else {
 		f, err := os.Create(o.ErrorFile)
 		if err != nil {
 			return fmt.Errorf("unable to open error file: %v: %w", o.ErrorFile, err)
 		}
 		defer f.Close()
+		errFile = f
 	}
 
 	// Connect to Veidemann API server
@@ -122,14 +175,22 @@ func run(o *options) error {
 	var uriChecker *importutil.UriChecker
 	if o.CheckUri {
 		uriChecker = &importutil.UriChecker{
-			Client: importutil.NewHttpClient(o.CheckUriTimeout, false),
+			Client:        importutil.NewHttpClient(o.CheckUriTimeout, false),
+			Limiter:       importutil.NewRequestLimiter(o.CheckUriRate, o.CheckUriHostRate),
+			MaxRetries:    o.CheckUriRetries,
+			MaxRetryAfter: o.CheckUriMaxRetryAfter,
+			DetectSoft404: o.CheckUriSoft404,
 		}
 	}
+	acceptPolicy, err := importutil.ParseAcceptPolicy(o.Accept)
+	if err != nil {
+		return err
+	}
 
 	// Create key normalizer for state database
-	uriNormalizer := &importutil.UriKeyNormalizer{IgnoreScheme: o.IgnoreScheme, Toplevel: o.Toplevel}
+	uriNormalizer := &importutil.UriKeyNormalizer{IgnoreScheme: o.IgnoreScheme, Toplevel: o.Toplevel, Rules: uriRules}
 
-	dbDir := path.Join(o.DbDir, config.GetContext(), configV1.Kind_seed.String())
+	dbDir := importutil.StateDbDir(o.DbDir, config.GetContext(), configV1.Kind_seed.String())
 
 	// Create database for storing state
 	seedDb, err := importutil.NewImportDb(dbDir, o.ResetDb)
@@ -147,10 +208,24 @@ func run(o *options) error {
 		}
 	}
 
-	// Create Record reader for file input
-	rr, err := importutil.NewRecordReader(o.Filename, &importutil.LineAsStringDecoder{}, "*.txt")
-	if err != nil {
-		return fmt.Errorf("unable to open file '%v': %w", o.Filename, err)
+	// Create Record reader for crawl log or file input
+	var rr interface {
+		Next(v interface{}) (*importutil.State, error)
+	}
+	if o.FromCrawlLog {
+		executionId, jobExecution := o.ExecutionId, false
+		if o.JobExecutionId != "" {
+			executionId, jobExecution = o.JobExecutionId, true
+		}
+		rr, err = importutil.NewCrawlLogReader(context.Background(), logV1.NewLogClient(conn), executionId, jobExecution, o.StatusCodes)
+		if err != nil {
+			return fmt.Errorf("unable to read crawl log: %w", err)
+		}
+	} else {
+		rr, err = importutil.NewRecordReader(o.Filename, &importutil.LineAsStringDecoder{}, "*.txt")
+		if err != nil {
+			return fmt.Errorf("unable to open file '%v': %w", o.Filename, err)
+		}
 	}
 
 	entityId := o.EntityId
@@ -183,6 +258,33 @@ func run(o *options) error {
 		}
 	}
 
+	// Create error logger
+	errorLog := log.Output(zerolog.ConsoleWriter{Out: errFile, TimeFormat: time.RFC3339})
+
+	// Keys converted in this run, so every key is only converted once
+	var mu sync.Mutex
+	converted := make(map[string]bool)
+	claim := func(key string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if converted[key] {
+			return importutil.ErrAlreadyExists(key)
+		}
+		if ids, err := seedDb.Get(key); err != nil {
+			return err
+		} else if len(ids) > 0 {
+			return importutil.ErrAlreadyExists(key)
+		}
+		converted[key] = true
+		return nil
+	}
+	// release gives up a claimed key that was not converted
+	release := func(key string) {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(converted, key)
+	}
+
 	// Processor for converting oos records into import records
 	proc := func(uri string) error {
 		seed := &importutil.SeedDesc{
@@ -197,23 +299,34 @@ func run(o *options) error {
 			seed.EntityName = uri
 		}
 
-		if uriChecker != nil {
-			uri, err := uriChecker.Check(uri)
-			if err != nil {
-				return fmt.Errorf("failed URL check: %w", err)
-			}
-			seed.Uri = uri
-		}
-
-		normalizedUri, err := uriNormalizer.Normalize(seed.Uri)
+		// Claim the key before checking the uri to avoid checking uris that will not be converted
+		normalizedUri, err := uriNormalizer.Normalize(uri)
 		if err != nil {
 			return fmt.Errorf("failed to normalize URL '%s': %w", uri, err)
 		}
-
-		if ids, err := seedDb.Get(normalizedUri); err != nil {
+		if err := claim(normalizedUri); err != nil {
 			return err
-		} else if len(ids) > 0 {
-			return importutil.ErrAlreadyExists(normalizedUri)
+		}
+
+		if uriChecker != nil {
+			result := uriChecker.Check(uri)
+			if !acceptPolicy.Accept(result) {
+				release(normalizedUri)
+				return importutil.ErrUriCheck{Result: result}
+			}
+			if result.Category != importutil.UriOk {
+				errorLog.Warn().Str("uri", uri).Interface("uriCheck", result).Msg("Accepted uri flagged by uri check")
+			}
+			seed.Uri = result.Uri
+
+			// The checked uri may have been redirected to another key
+			if key, err := uriNormalizer.Normalize(seed.Uri); err != nil {
+				return fmt.Errorf("failed to normalize URL '%s': %w", seed.Uri, err)
+			} else if key != normalizedUri {
+				if err := claim(key); err != nil {
+					return err
+				}
+			}
 		}
 
 		j, err := json.Marshal(seed)
@@ -226,9 +339,6 @@ func run(o *options) error {
 		return nil
 	}
 
-	// Create error logger
-	errorLog := log.Output(zerolog.ConsoleWriter{Out: errFile, TimeFormat: time.RFC3339})
-
 	// Error handler for executor
 	errHandler := func(state importutil.Job[string]) {
 		l := errorLog.With().
@@ -237,8 +347,11 @@ func run(o *options) error {
 			Int("recNum", state.GetRecordNum()).Logger()
 
 		var err importutil.ErrAlreadyExists
+		var uriErr importutil.ErrUriCheck
 		if errors.As(state.GetError(), &err) {
 			l.Info().Msg(err.Error())
+		} else if errors.As(state.GetError(), &uriErr) {
+			l.Warn().Interface("uriCheck", uriErr.Result).Msg("Rejected by uri check")
 		} else {
 			l.Error().Err(state.GetError()).Msg("")
 		}
@@ -247,7 +360,17 @@ func run(o *options) error {
 	// Create cuncurrent executor for processing records
 	executor := importutil.NewExecutor(o.Concurrency, proc, errHandler)
 
-	// Read records from file and queue for processing
+	// Report progress while converting
+	progress := importutil.NewProgress("convertoos")
+	if input, ok := rr.(importutil.InputProgress); ok {
+		progress.SetInput(input)
+	}
+	progress.SetStats(executor.Stats)
+	progress.Start()
+	defer progress.Stop()
+
+	// Read records from file or crawl log and queue for processing
+	var readErr error
 	for {
 		var uri string
 		state, err := rr.Next(&uri)
@@ -255,20 +378,43 @@ func run(o *options) error {
 			break
 		}
 		if err != nil {
-			errorLog.Error().Err(err).Msgf("error decoding record: %v", state)
+			// The input can not be read any further
+			readErr = fmt.Errorf("failed to read records: %w", err)
+			break
+		}
+		progress.Read(state)
+		if state.GetError() != nil {
+			errorLog.Error().Err(state.GetError()).Str("filename", state.GetFilename()).Int("recNum", state.GetRecordNum()).Msg("Failed to decode record")
 			continue
 		}
 		// ignore empty lines
 		if uri == "" {
 			continue
 		}
+		if o.Toplevel {
+			uri = toplevel(uri)
+		}
 		executor.Queue <- importutil.Job[string]{State: state, Val: uri}
 	}
 
-	// Wait for all records to be processed
+	// Wait for all queued records to be processed
 	count, success, failed := executor.Wait()
+	progress.Stop()
 
 	errorLog.Info().Int("total", count).Int("success", success).Int("failed", failed).Msg("Finished converting records")
 
-	return nil
+	return readErr
+}
+
+// toplevel returns the uri without path, query and fragment, or the uri unchanged if it can not be parsed.
+func toplevel(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri
+	}
+	u.Path = "/"
+	u.RawPath = ""
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
 }
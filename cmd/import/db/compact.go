@@ -0,0 +1,74 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func newCompactCmd(o *options) *cobra.Command {
+	var discardRatio float64
+
+	cmd := &cobra.Command{
+		Use:   "compact",
+		Short: "Reclaim space in the state database",
+		Long: `Reclaim space in the state database.
+
+Runs value log garbage collection, which rewrites value log files where at least the discard ratio
+of the space is taken by deleted or overwritten values.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if discardRatio <= 0 || discardRatio >= 1 {
+				return fmt.Errorf("discard ratio must be between 0 and 1: %v", discardRatio)
+			}
+
+			// silence usage to prevent printing usage when error occurs
+			cmd.SilenceUsage = true
+
+			db, err := o.open()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			before, err := db.Stats()
+			if err != nil {
+				return err
+			}
+			n, err := db.Compact(discardRatio)
+			if err != nil {
+				return fmt.Errorf("failed to compact state db: %w", err)
+			}
+			after, err := db.Stats()
+			if err != nil {
+				return err
+			}
+
+			log.Info().
+				Int("rewrittenFiles", n).
+				Int64("vlogSizeBefore", before.VlogSize).
+				Int64("vlogSizeAfter", after.VlogSize).
+				Msg("Compact completed")
+
+			return nil
+		},
+	}
+
+	cmd.Flags().Float64Var(&discardRatio, "discard-ratio", 0.5, "Rewrite value log files with at least this ratio of discardable space")
+
+	return cmd
+}
@@ -0,0 +1,85 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/config"
+	"github.com/nlnwa/veidemannctl/format"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/spf13/cobra"
+)
+
+// options are the options shared by the db subcommands
+type options struct {
+	Kind  string
+	DbDir string
+}
+
+func NewCmd() *cobra.Command {
+	o := &options{}
+
+	cmd := &cobra.Command{
+		Use:   "db",
+		Short: "Inspect and maintain the import state database",
+		Long: `Inspect and maintain the import state database.
+
+The state database maps normalized keys (URLs of seeds or names of crawl entities) to the ids of
+objects in Veidemann. It is filled by the import commands and stored in a directory per context
+and kind below --db-dir.`,
+	}
+
+	cmd.PersistentFlags().StringVar(&o.Kind, "kind", configV1.Kind_seed.String(), "Kind of state database (seed|crawlEntity)")
+	cmd.PersistentFlags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db")
+
+	cmd.AddCommand(newStatsCmd(o))   // stats
+	cmd.AddCommand(newGetCmd(o))     // get
+	cmd.AddCommand(newDumpCmd(o))    // dump
+	cmd.AddCommand(newVerifyCmd(o))  // verify
+	cmd.AddCommand(newCompactCmd(o)) // compact
+
+	return cmd
+}
+
+// kind returns the kind of the state database
+func (o *options) kind() (configV1.Kind, error) {
+	kind := format.GetKind(o.Kind)
+	switch kind {
+	case configV1.Kind_seed, configV1.Kind_crawlEntity:
+		return kind, nil
+	default:
+		return kind, fmt.Errorf("invalid kind: %s", o.Kind)
+	}
+}
+
+// open opens the existing state database of the kind
+func (o *options) open() (*importutil.ImportDb, error) {
+	kind, err := o.kind()
+	if err != nil {
+		return nil, err
+	}
+	dbDir := path.Join(o.DbDir, config.GetContext(), kind.String())
+	if _, err := os.Stat(dbDir); err != nil {
+		return nil, fmt.Errorf("no state database at %s: %w", dbDir, err)
+	}
+	db, err := importutil.NewImportDb(dbDir, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state db: %w", err)
+	}
+	return db, nil
+}
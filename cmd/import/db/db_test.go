@@ -0,0 +1,95 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeConfigClient knows about the objects with the given ids
+type fakeConfigClient struct {
+	configV1.ConfigClient
+	ids map[string]bool
+}
+
+func (c *fakeConfigClient) GetConfigObject(_ context.Context, ref *configV1.ConfigRef, _ ...grpc.CallOption) (*configV1.ConfigObject, error) {
+	switch {
+	case c.ids[ref.GetId()]:
+		return &configV1.ConfigObject{Id: ref.GetId(), Kind: ref.GetKind()}, nil
+	case ref.GetId() == "empty":
+		return &configV1.ConfigObject{}, nil
+	default:
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+}
+
+func newTestDb(t *testing.T) *importutil.ImportDb {
+	db, err := importutil.NewImportDb(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	_, _, _ = db.Set("http://example.com/", "1")
+	_, _, _ = db.Set("http://example.com/", "2")
+	_, _, _ = db.Set("http://example.org/", "3")
+	_, _, _ = db.Set("http://example.net/", "empty")
+	return db
+}
+
+func TestDump(t *testing.T) {
+	db := newTestDb(t)
+
+	var buf bytes.Buffer
+	if err := dump(db, &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"key":"http://example.com/","ids":["1","2"]}
+{"key":"http://example.net/","ids":["empty"]}
+{"key":"http://example.org/","ids":["3"]}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("dump() = %s, want %s", got, want)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	client := &fakeConfigClient{ids: map[string]bool{"1": true}}
+
+	contents := func(db *importutil.ImportDb) map[string][]string {
+		got := make(map[string][]string)
+		_ = db.IterateIds(func(key string, ids []string) {
+			got[key] = ids
+		})
+		return got
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		db := newTestDb(t)
+		before := contents(db)
+		if err := verify(db, client, configV1.Kind_seed, &verifyOptions{DryRun: true, Concurrency: 2}); err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(db); !reflect.DeepEqual(got, before) {
+			t.Errorf("Expected dry run to keep state db unchanged, got %v", got)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		db := newTestDb(t)
+		if err := verify(db, client, configV1.Kind_seed, &verifyOptions{Concurrency: 2}); err != nil {
+			t.Fatal(err)
+		}
+		want := map[string][]string{"http://example.com/": {"1"}}
+		if got := contents(db); !reflect.DeepEqual(got, want) {
+			t.Errorf("verify() left %v, want %v", got, want)
+		}
+	})
+}
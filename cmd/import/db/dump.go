@@ -0,0 +1,92 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/spf13/cobra"
+)
+
+// dbRecord is a key with its ids
+type dbRecord struct {
+	Key string   `json:"key"`
+	Ids []string `json:"ids"`
+}
+
+func newDumpCmd(o *options) *cobra.Command {
+	var outFile string
+
+	cmd := &cobra.Command{
+		Use:   "dump",
+		Short: "Print all keys and ids in the state database as JSON lines",
+		Long:  `Print all keys and ids in the state database as JSON lines.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// silence usage to prevent printing usage when error occurs
+			cmd.SilenceUsage = true
+
+			// Create output writer (file or stdout)
+			var out io.Writer
+			if outFile == "" || outFile == "-" {
+				out = os.Stdout
+			} else {
+				f, err := os.Create(outFile)
+				if err != nil {
+					return fmt.Errorf("unable to open output file: %v: %w", outFile, err)
+				}
+				defer f.Close()
+				out = f
+			}
+
+			db, err := o.open()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			return dump(db, out)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outFile, "out-file", "o", "-", "File to write result to. '-' writes to stdout.")
+
+	return cmd
+}
+
+// dump writes every key and its ids as a JSON line
+func dump(db *importutil.ImportDb, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	var encErr error
+	err := db.IterateIds(func(key string, ids []string) {
+		if encErr != nil {
+			return
+		}
+		encErr = enc.Encode(dbRecord{Key: key, Ids: ids})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to iterate state db: %w", err)
+	}
+	if encErr != nil {
+		return fmt.Errorf("failed to write record: %w", encErr)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,98 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/spf13/cobra"
+)
+
+type getOptions struct {
+	Raw             bool
+	Toplevel        bool
+	IgnoreScheme    bool
+	NormalizerRules string
+}
+
+func newGetCmd(o *options) *cobra.Command {
+	g := &getOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "get KEY",
+		Short: "Look up the ids of a key in the state database",
+		Long: `Look up the ids of a key in the state database.
+
+For the seed database the key is a URL, which is normalized the same way as when importing
+unless --raw is given. Use the same normalization flags as when the database was filled.`,
+		Example: `veidemannctl import db get https://www.example.com/ --ignore-scheme`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// silence usage to prevent printing usage when error occurs
+			cmd.SilenceUsage = true
+
+			return runGet(o, g, args[0])
+		},
+	}
+
+	cmd.Flags().BoolVar(&g.Raw, "raw", false, "Look up the key as given without normalizing it")
+	cmd.Flags().BoolVar(&g.Toplevel, "toplevel", false, "Convert URI by removing path")
+	cmd.Flags().BoolVar(&g.IgnoreScheme, "ignore-scheme", false, "Ignore the URL's scheme")
+	cmd.Flags().StringVar(&g.NormalizerRules, "normalizer-rules", "", importutil.NormalizerRulesUsage)
+
+	return cmd
+}
+
+func runGet(o *options, g *getOptions, key string) error {
+	kind, err := o.kind()
+	if err != nil {
+		return err
+	}
+
+	if kind == configV1.Kind_seed && !g.Raw {
+		var uriRules *importutil.UriRules
+		if g.NormalizerRules != "" {
+			uriRules, err = importutil.LoadUriRules(g.NormalizerRules)
+			if err != nil {
+				return err
+			}
+		}
+		normalizer := &importutil.UriKeyNormalizer{Toplevel: g.Toplevel, IgnoreScheme: g.IgnoreScheme, Rules: uriRules}
+		normalized, err := normalizer.Normalize(key)
+		if err != nil {
+			return fmt.Errorf("failed to normalize URL '%s': %w", key, err)
+		}
+		key = normalized
+	}
+
+	db, err := o.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ids, err := db.Get(key)
+	if err != nil {
+		return fmt.Errorf("failed to get '%s': %w", key, err)
+	}
+	if len(ids) == 0 {
+		return importutil.ErrNotFound(key)
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(dbRecord{Key: key, Ids: ids})
+}
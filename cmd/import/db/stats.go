@@ -0,0 +1,54 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+func newStatsCmd(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:          "stats",
+		Short:        "Show number of keys and ids in the state database",
+		Long:         `Show number of keys and ids in the state database.`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			db, err := o.open()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			stats, err := db.Stats()
+			if err != nil {
+				return fmt.Errorf("failed to count entries: %w", err)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintf(w, "Keys:\t%d\n", stats.Keys)
+			_, _ = fmt.Fprintf(w, "Ids:\t%d\n", stats.Ids)
+			_, _ = fmt.Fprintf(w, "Duplicate keys:\t%d\n", stats.DuplicateKeys)
+			_, _ = fmt.Fprintf(w, "Checkpoints:\t%d\n", stats.Checkpoints)
+			_, _ = fmt.Fprintf(w, "SURT index entries:\t%d\n", stats.SurtIndexEntries)
+			_, _ = fmt.Fprintf(w, "LSM size:\t%d bytes\n", stats.LsmSize)
+			_, _ = fmt.Fprintf(w, "Value log size:\t%d bytes\n", stats.VlogSize)
+			return w.Flush()
+		},
+	}
+}
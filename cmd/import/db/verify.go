@@ -0,0 +1,136 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"fmt"
+	"sync"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type verifyOptions struct {
+	DryRun      bool
+	Concurrency int
+}
+
+func newVerifyCmd(o *options) *cobra.Command {
+	v := &verifyOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Remove ids of objects no longer in Veidemann from the state database",
+		Long: `Remove ids of objects no longer in Veidemann from the state database.
+
+Every id in the state database is looked up in Veidemann. Ids of objects that do not exist
+anymore are removed, and keys without ids left are deleted.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// silence usage to prevent printing usage when error occurs
+			cmd.SilenceUsage = true
+
+			kind, err := o.kind()
+			if err != nil {
+				return err
+			}
+
+			conn, err := connection.Connect()
+			if err != nil {
+				return fmt.Errorf("failed to connect: %w", err)
+			}
+			defer conn.Close()
+
+			db, err := o.open()
+			if err != nil {
+				return err
+			}
+			defer db.Close()
+
+			return verify(db, configV1.NewConfigClient(conn), kind, v)
+		},
+	}
+
+	cmd.Flags().BoolVar(&v.DryRun, "dry-run", false, "Only report stale ids without removing them")
+	cmd.Flags().IntVarP(&v.Concurrency, "concurrency", "c", 16, "Number of concurrent workers")
+
+	return cmd
+}
+
+// verify checks every id in the db against Veidemann and removes the ids of objects that do not exist
+func verify(db *importutil.ImportDb, client configV1.ConfigClient, kind configV1.Kind, v *verifyOptions) error {
+	var records []dbRecord
+	err := db.IterateIds(func(key string, ids []string) {
+		records = append(records, dbRecord{Key: key, Ids: ids})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to iterate state db: %w", err)
+	}
+
+	var m sync.Mutex
+	var ids, stale int
+
+	proc := func(rec dbRecord) error {
+		for _, id := range rec.Ids {
+			exists, err := importutil.ObjectExists(client, kind, id)
+			if err != nil {
+				return fmt.Errorf("failed to get %s '%s': %w", kind, id, err)
+			}
+
+			m.Lock()
+			ids++
+			if !exists {
+				stale++
+			}
+			m.Unlock()
+
+			if exists {
+				continue
+			}
+			l := log.With().Str("key", rec.Key).Str("id", id).Logger()
+			if v.DryRun {
+				l.Info().Msg("Would remove stale id")
+				continue
+			}
+			if err := db.Delete(rec.Key, id); err != nil {
+				return fmt.Errorf("failed to remove '%s' from '%s': %w", id, rec.Key, err)
+			}
+			l.Info().Msg("Removed stale id")
+		}
+		return nil
+	}
+
+	errHandler := func(job importutil.Job[dbRecord]) {
+		log.Error().Err(job.GetError()).Str("key", job.Val.Key).Msg("")
+	}
+
+	executor := importutil.NewExecutor(v.Concurrency, proc, errHandler)
+	for _, rec := range records {
+		executor.Queue <- importutil.Job[dbRecord]{State: &importutil.State{}, Val: rec}
+	}
+	count, _, failed := executor.Wait()
+
+	log.Info().
+		Bool("dryRun", v.DryRun).
+		Int("keys", count).
+		Int("ids", ids).
+		Int("stale", stale).
+		Int("errors", failed).
+		Msg("Verify completed")
+
+	return nil
+}
@@ -0,0 +1,487 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	commonsV1 "github.com/nlnwa/veidemann-api/go/commons/v1"
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/config"
+	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	strategyOldest      = "oldest"
+	strategyMostJobs    = "most-jobs"
+	strategyInteractive = "interactive"
+)
+
+// errQuit is returned when the user quits interactive selection
+var errQuit = errors.New("quit")
+
+type options struct {
+	Filename             string
+	OutFile              string
+	Strategy             string
+	DeleteOrphanEntities bool
+	DryRun               bool
+	DbDir                string
+	Toplevel             bool
+	IgnoreScheme         bool
+	NormalizerRules      string
+	Truncate             bool
+	SkipImport           bool
+}
+
+func NewCmd() *cobra.Command {
+	o := &options{}
+
+	cmd := &cobra.Command{
+		Use:   "dedupe",
+		Short: "Merge duplicate seeds into one",
+		Long: `Merge duplicate seeds into one.
+
+Duplicates are read from a report made by 'import duplicatereport seed' or, if no report is given,
+found the same way as the report does. For each group of duplicates one seed is kept and the others
+are deleted. The crawl job references and labels of the deleted seeds are added to the kept seed.
+
+The seed to keep is chosen by strategy:
+
+  oldest       the seed created first
+  most-jobs    the seed with most crawl job references (the oldest of them on a tie)
+  interactive  ask for each group
+
+The default is a dry run that only outputs the plan. Use --dry-run=false to carry it out.`,
+		Example: `# Show plan for duplicates found in Veidemann
+veidemannctl import dedupe
+
+# Keep the seed with most crawl jobs of each group in a report and delete entities left without seeds
+veidemannctl import dedupe -f duplicates.json --strategy most-jobs --delete-orphan-entities --dry-run=false`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch o.Strategy {
+			case strategyOldest, strategyMostJobs:
+			case strategyInteractive:
+				if o.Filename == "-" {
+					return fmt.Errorf("interactive strategy can not be used when reading report from stdin")
+				}
+			default:
+				return fmt.Errorf("invalid value for --strategy: %s", o.Strategy)
+			}
+
+			// silence usage to prevent printing usage when error occurs
+			cmd.SilenceUsage = true
+
+			return run(o)
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.Filename, "filename", "f", "", "Duplicate report to read from. An input of '-' will read from stdin. "+
+		"If not given, duplicates are found using the state database")
+	cmd.Flags().StringVarP(&o.OutFile, "out-file", "o", "", "File to write plan to")
+	cmd.Flags().StringVar(&o.Strategy, "strategy", strategyOldest, "How to choose the seed to keep (oldest|most-jobs|interactive)")
+	cmd.Flags().BoolVar(&o.DeleteOrphanEntities, "delete-orphan-entities", false, "Delete entities left without seeds")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", true, "Only output the plan without writing anything to Veidemann")
+	cmd.Flags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db. \":memory:\" keeps the state in memory for the duration of the command")
+	cmd.Flags().BoolVar(&o.Toplevel, "toplevel", false, "Convert URI to toplevel by removing path before checking for duplicates.")
+	cmd.Flags().BoolVar(&o.IgnoreScheme, "ignore-scheme", false, "Ignore the URL's scheme when checking for duplicates.")
+	cmd.Flags().StringVar(&o.NormalizerRules, "normalizer-rules", "", importutil.NormalizerRulesUsage)
+	cmd.Flags().BoolVar(&o.Truncate, "truncate", false, "Truncate state database")
+	cmd.Flags().BoolVar(&o.SkipImport, "skip-import", false, "Do not import existing seeds into state database")
+
+	return cmd
+}
+
+// duplicateGroup is a group of seeds with the same key
+type duplicateGroup struct {
+	key string
+	ids []string
+}
+
+// planRecord describes what is done with a group of duplicates
+type planRecord struct {
+	Key            string
+	Keep           string
+	Uri            string
+	Delete         []string
+	Changed        []string `json:",omitempty"`
+	JobRefs        []string
+	Labels         []string
+	DeleteEntities []string `json:",omitempty"`
+}
+
+func run(o *options) error {
+	// Create output writer (file or stdout)
+	var out io.Writer
+	if o.OutFile == "" {
+		out = os.Stdout
+	} else {
+		f, err := os.Create(o.OutFile)
+		if err != nil {
+			return fmt.Errorf("unable to open output file: %v: %w", o.OutFile, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	// Connect to Veidemann
+	conn, err := connection.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	client := configV1.NewConfigClient(conn)
+
+	var groups []duplicateGroup
+	var seedDb *importutil.ImportDb
+
+	if o.Filename != "" {
+		groups, err = readReport(o.Filename)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Load canonicalization rules for URI keys
+		var uriRules *importutil.UriRules
+		if o.NormalizerRules != "" {
+			uriRules, err = importutil.LoadUriRules(o.NormalizerRules)
+			if err != nil {
+				return err
+			}
+		}
+		uriNormalizer := &importutil.UriKeyNormalizer{Toplevel: o.Toplevel, IgnoreScheme: o.IgnoreScheme, Rules: uriRules}
+
+		// Create/open state database for seeds
+		seedDbDir := importutil.StateDbDir(o.DbDir, config.GetContext(), configV1.Kind_seed.String())
+		seedDb, err = importutil.NewImportDb(seedDbDir, o.Truncate)
+		if err != nil {
+			return fmt.Errorf("failed to initialize seed state db: %w", err)
+		}
+		defer seedDb.Close()
+
+		if !o.SkipImport {
+			err = importutil.ImportExisting(seedDb, client, configV1.Kind_seed, uriNormalizer)
+			if err != nil {
+				return fmt.Errorf("failed to import seeds: %w", err)
+			}
+		}
+
+		err = seedDb.IterateDuplicates(func(key string, ids []string) {
+			groups = append(groups, duplicateGroup{key: key, ids: ids})
+		})
+		if err != nil {
+			return fmt.Errorf("failed to find duplicates: %w", err)
+		}
+	}
+
+	choose := func(group duplicateGroup, seeds []*configV1.ConfigObject) (int, error) {
+		return chooseSeed(o.Strategy, seeds), nil
+	}
+	if o.Strategy == strategyInteractive {
+		in := bufio.NewReader(os.Stdin)
+		choose = func(group duplicateGroup, seeds []*configV1.ConfigObject) (int, error) {
+			return chooseInteractive(in, os.Stderr, group.key, seeds)
+		}
+	}
+
+	// deletedSeeds counts seeds planned for deletion by entity, to find orphan entities in a dry run
+	deletedSeeds := make(map[string]int)
+	// orphans holds entities planned for deletion
+	orphans := make(map[string]bool)
+
+	var merged, deleted, deletedEntities, failed int
+
+	for _, group := range groups {
+		l := log.With().Str("key", group.key).Logger()
+
+		var seeds []*configV1.ConfigObject
+		for _, id := range group.ids {
+			seed, err := client.GetConfigObject(context.Background(), &configV1.ConfigRef{Kind: configV1.Kind_seed, Id: id})
+			if err != nil {
+				l.Warn().Err(err).Str("id", id).Msg("Failed to get seed from Veidemann, skipping it")
+				continue
+			}
+			if seed.GetSeed() == nil {
+				l.Warn().Str("id", id).Msg("Not a seed, skipping it")
+				continue
+			}
+			seeds = append(seeds, seed)
+		}
+		if len(seeds) < 2 {
+			l.Info().Msg("No longer duplicated")
+			continue
+		}
+
+		i, err := choose(group, seeds)
+		if errors.Is(err, errQuit) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if i < 0 {
+			l.Info().Msg("Skipped")
+			continue
+		}
+
+		keep := seeds[i]
+		others := append(append([]*configV1.ConfigObject{}, seeds[:i]...), seeds[i+1:]...)
+
+		plan := planRecord{
+			Key:  group.key,
+			Keep: keep.GetId(),
+			Uri:  keep.GetMeta().GetName(),
+		}
+
+		// Merge crawl job references and labels of the other seeds into the kept seed
+		for _, other := range others {
+			sd := &importutil.SeedDesc{
+				SeedLabel:   other.GetMeta().GetLabel(),
+				CrawlJobRef: other.GetSeed().GetJobRef(),
+			}
+			for _, field := range sd.UpdateSeed(keep, false) {
+				if !contains(plan.Changed, field) {
+					plan.Changed = append(plan.Changed, field)
+				}
+			}
+			plan.Delete = append(plan.Delete, other.GetId())
+		}
+		for _, ref := range keep.GetSeed().GetJobRef() {
+			plan.JobRefs = append(plan.JobRefs, ref.GetId())
+		}
+		for _, label := range keep.GetMeta().GetLabel() {
+			plan.Labels = append(plan.Labels, label.GetKey()+":"+label.GetValue())
+		}
+
+		if err := apply(o.DryRun, client, seedDb, group.key, keep, others, plan.Changed); err != nil {
+			failed++
+			l.Error().Err(err).Msg("Failed to merge duplicates")
+			continue
+		}
+		if len(plan.Changed) > 0 {
+			merged++
+		}
+		deleted += len(others)
+
+		if o.DeleteOrphanEntities {
+			for _, other := range others {
+				entityRef := other.GetSeed().GetEntityRef()
+				if entityRef.GetId() == "" || entityRef.GetId() == keep.GetSeed().GetEntityRef().GetId() {
+					continue
+				}
+				deletedSeeds[entityRef.GetId()]++
+				if orphans[entityRef.GetId()] {
+					continue
+				}
+
+				orphan, err := isOrphan(client, entityRef, o.DryRun, deletedSeeds[entityRef.GetId()])
+				if err != nil {
+					l.Error().Err(err).Str("entityId", entityRef.GetId()).Msg("Failed to count seeds of entity")
+					continue
+				}
+				if !orphan {
+					continue
+				}
+				orphans[entityRef.GetId()] = true
+				plan.DeleteEntities = append(plan.DeleteEntities, entityRef.GetId())
+				if !o.DryRun {
+					obj := &configV1.ConfigObject{Id: entityRef.GetId(), Kind: configV1.Kind_crawlEntity}
+					if _, err := client.DeleteConfigObject(context.Background(), obj); err != nil {
+						l.Error().Err(err).Str("entityId", entityRef.GetId()).Msg("Failed to delete entity")
+						continue
+					}
+				}
+				deletedEntities++
+			}
+		}
+
+		b, err := json.Marshal(&plan)
+		if err != nil {
+			return fmt.Errorf("failed to marshal plan to json: %w", err)
+		}
+		if _, err := out.Write(append(b, '\n')); err != nil {
+			return fmt.Errorf("failed to write plan: %w", err)
+		}
+	}
+
+	log.Info().
+		Bool("dryRun", o.DryRun).
+		Int("groups", len(groups)).
+		Int("merged", merged).
+		Int("deletedSeeds", deleted).
+		Int("deletedEntities", deletedEntities).
+		Int("errors", failed).
+		Msg("Dedupe completed")
+
+	return nil
+}
+
+// readReport reads the groups of duplicates from a report made by the duplicatereport command.
+func readReport(filename string) ([]duplicateGroup, error) {
+	rr, err := importutil.NewRecordReader(filename, &importutil.JsonYamlDecoder{}, "*.json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize reader: %w", err)
+	}
+
+	var groups []duplicateGroup
+	for {
+		var rec importutil.SeedDuplicateReportRecord
+		state, err := rr.Next(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding record: %v: %w", state, err)
+		}
+		group := duplicateGroup{key: rec.Host}
+		for _, seed := range rec.Seeds {
+			group.ids = append(group.ids, seed.SeedId)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// apply saves the kept seed if it was changed and deletes the others.
+func apply(dryRun bool, client configV1.ConfigClient, seedDb *importutil.ImportDb, key string, keep *configV1.ConfigObject, others []*configV1.ConfigObject, changed []string) error {
+	if dryRun {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if len(changed) > 0 {
+		if _, err := client.SaveConfigObject(ctx, keep); err != nil {
+			return fmt.Errorf("failed to update seed '%s': %w", keep.GetId(), err)
+		}
+	}
+	for _, other := range others {
+		if _, err := client.DeleteConfigObject(ctx, other); err != nil {
+			return fmt.Errorf("failed to delete seed '%s': %w", other.GetId(), err)
+		}
+		if seedDb != nil {
+			if err := seedDb.Delete(key, other.GetId()); err != nil {
+				return fmt.Errorf("failed to delete seed '%s' from state db: %w", other.GetId(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// isOrphan returns true if the entity has no seeds left.
+//
+// In a dry run no seeds are deleted, so the number of seeds planned for deletion is subtracted from the count.
+func isOrphan(client configV1.ConfigClient, entityRef *configV1.ConfigRef, dryRun bool, planned int) (bool, error) {
+	req := &configV1.ListRequest{
+		Kind: configV1.Kind_seed,
+		QueryTemplate: &configV1.ConfigObject{
+			Spec: &configV1.ConfigObject_Seed{Seed: &configV1.Seed{EntityRef: entityRef}},
+		},
+		QueryMask: &commonsV1.FieldMask{Paths: []string{"seed.entityRef"}},
+	}
+	res, err := client.CountConfigObjects(context.Background(), req)
+	if err != nil {
+		return false, err
+	}
+	count := res.GetCount()
+	if dryRun {
+		count -= int64(planned)
+	}
+	return count <= 0, nil
+}
+
+// chooseSeed returns the index of the seed to keep according to strategy.
+func chooseSeed(strategy string, seeds []*configV1.ConfigObject) int {
+	best := 0
+	for i := 1; i < len(seeds); i++ {
+		seed := seeds[i]
+		if strategy == strategyMostJobs {
+			n, bestN := len(seed.GetSeed().GetJobRef()), len(seeds[best].GetSeed().GetJobRef())
+			if n > bestN {
+				best = i
+				continue
+			}
+			if n < bestN {
+				continue
+			}
+		}
+		if created(seed).Before(created(seeds[best])) {
+			best = i
+		}
+	}
+	return best
+}
+
+// created returns the creation time of a config object.
+func created(o *configV1.ConfigObject) time.Time {
+	return o.GetMeta().GetCreated().AsTime()
+}
+
+// chooseInteractive lists the seeds and asks which one to keep.
+// It returns the index of the chosen seed, -1 if the group is skipped or errQuit if the user quits.
+func chooseInteractive(in *bufio.Reader, out io.Writer, key string, seeds []*configV1.ConfigObject) (int, error) {
+	_, _ = fmt.Fprintf(out, "\n%s\n", key)
+	for i, seed := range seeds {
+		_, _ = fmt.Fprintf(out, "  [%d] %s %s entity=%s jobs=%d created=%s\n",
+			i+1,
+			seed.GetId(),
+			seed.GetMeta().GetName(),
+			seed.GetSeed().GetEntityRef().GetId(),
+			len(seed.GetSeed().GetJobRef()),
+			created(seed).Format(time.RFC3339))
+	}
+	for {
+		_, _ = fmt.Fprintf(out, "Keep which seed? [1-%d], s to skip, q to quit: ", len(seeds))
+		line, err := in.ReadString('\n')
+		answer := strings.TrimSpace(line)
+		switch answer {
+		case "s":
+			return -1, nil
+		case "q":
+			return 0, errQuit
+		}
+		if n, convErr := strconv.Atoi(answer); convErr == nil && n >= 1 && n <= len(seeds) {
+			return n - 1, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return 0, errQuit
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func contains(s []string, e string) bool {
+	for _, a := range s {
+		if a == e {
+			return true
+		}
+	}
+	return false
+}
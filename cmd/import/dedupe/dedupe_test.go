@@ -0,0 +1,83 @@
+package dedupe
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func newSeed(id string, created time.Time, jobs ...string) *configV1.ConfigObject {
+	seed := &configV1.Seed{}
+	for _, job := range jobs {
+		seed.JobRef = append(seed.JobRef, &configV1.ConfigRef{Kind: configV1.Kind_crawlJob, Id: job})
+	}
+	return &configV1.ConfigObject{
+		Id:   id,
+		Kind: configV1.Kind_seed,
+		Meta: &configV1.Meta{Name: "https://example.com/", Created: timestamppb.New(created)},
+		Spec: &configV1.ConfigObject_Seed{Seed: seed},
+	}
+}
+
+func TestChooseSeed(t *testing.T) {
+	now := time.Now()
+	seeds := []*configV1.ConfigObject{
+		newSeed("a", now.Add(-1*time.Hour), "job1"),
+		newSeed("b", now.Add(-3*time.Hour)),
+		newSeed("c", now.Add(-2*time.Hour), "job1", "job2"),
+		newSeed("d", now, "job1", "job2"),
+	}
+
+	tests := []struct {
+		strategy string
+		want     string
+	}{
+		{strategyOldest, "b"},
+		{strategyMostJobs, "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			if got := seeds[chooseSeed(tt.strategy, seeds)].GetId(); got != tt.want {
+				t.Errorf("chooseSeed() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChooseInteractive(t *testing.T) {
+	seeds := []*configV1.ConfigObject{
+		newSeed("a", time.Now()),
+		newSeed("b", time.Now()),
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		want    int
+		wantErr error
+	}{
+		{"choose", "2\n", 1, nil},
+		{"retry invalid", "3\nfoo\n1\n", 0, nil},
+		{"skip", "s\n", -1, nil},
+		{"quit", "q\n", 0, errQuit},
+		{"eof", "", 0, errQuit},
+		{"no newline", "2", 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := chooseInteractive(bufio.NewReader(strings.NewReader(tt.input)), io.Discard, "key", seeds)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("chooseInteractive() error = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("chooseInteractive() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
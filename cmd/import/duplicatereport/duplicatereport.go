@@ -17,7 +17,6 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path"
 
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
 	"github.com/nlnwa/veidemannctl/config"
@@ -30,13 +29,15 @@ import (
 
 // options is the options for the convert oos command
 type options struct {
-	Kind         configV1.Kind
-	OutFile      string
-	DbDir        string
-	ResetDb      bool
-	Toplevel     bool
-	IgnoreScheme bool
-	SkipImport   bool
+	Kind            configV1.Kind
+	OutFile         string
+	DbDir           string
+	ResetDb         bool
+	Toplevel        bool
+	IgnoreScheme    bool
+	NormalizerRules string
+	SkipImport      bool
+	GroupBy         string
 }
 
 func NewCmd() *cobra.Command {
@@ -45,8 +46,15 @@ func NewCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "duplicatereport KIND",
 		Short: "List duplicated seeds or crawl entities in Veidemann",
-		Long:  ``,
-		Args:  cobra.ExactArgs(1),
+		Long: `List duplicated seeds or crawl entities in Veidemann.
+
+Seeds are duplicates when their normalized URIs are equal. Use --group-by to list clusters of seeds
+with overlapping scope instead:
+
+  registered-domain  seeds on the same registered domain, e.g. example.com and news.example.com
+  host               seeds on the same host
+  prefix             a seed and every seed whose SURT starts with the seed's SURT, e.g. example.com/ and example.com/news/`,
+		Args: cobra.ExactArgs(1),
 		ValidArgs: []string{
 			configV1.Kind_seed.String(),
 			configV1.Kind_crawlEntity.String(),
@@ -58,6 +66,10 @@ func NewCmd() *cobra.Command {
 			}
 			o.Kind = kind
 
+			if o.GroupBy != "" && kind != configV1.Kind_seed {
+				return fmt.Errorf("--group-by is only supported for kind %s", configV1.Kind_seed)
+			}
+
 			// silence usage to prevent printing usage when error occurs
 			cmd.SilenceUsage = true
 
@@ -66,11 +78,13 @@ func NewCmd() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&o.OutFile, "out-file", "o", "", "File to write output.")
-	cmd.Flags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db")
+	cmd.Flags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db. \":memory:\" keeps the state in memory for the duration of the command")
 	cmd.Flags().BoolVarP(&o.Toplevel, "toplevel", "", false, "Convert URI to toplevel by removing path before checking for duplicates.")
 	cmd.Flags().BoolVarP(&o.IgnoreScheme, "ignore-scheme", "", false, "Ignore the URL's scheme when checking for duplicates.")
+	cmd.Flags().StringVar(&o.NormalizerRules, "normalizer-rules", "", importutil.NormalizerRulesUsage)
 	cmd.Flags().BoolVar(&o.ResetDb, "truncate", false, "Truncate state database")
 	cmd.Flags().BoolVar(&o.SkipImport, "skip-import", false, "Do not import existing seeds into state database")
+	cmd.Flags().StringVar(&o.GroupBy, "group-by", "", "Report clusters of seeds with overlapping scope grouped by registered-domain, host or prefix")
 
 	return cmd
 }
@@ -81,6 +95,25 @@ type DuplicateReporter interface {
 
 // run runs the convert oos command with the given options
 func run(o *options) error {
+	// Load canonicalization rules for URI keys
+	var uriRules *importutil.UriRules
+	if o.NormalizerRules != "" {
+		var err error
+		uriRules, err = importutil.LoadUriRules(o.NormalizerRules)
+		if err != nil {
+			return err
+		}
+	}
+
+	var groupBy importutil.GroupBy
+	if o.GroupBy != "" {
+		var err error
+		groupBy, err = importutil.ParseGroupBy(o.GroupBy)
+		if err != nil {
+			return err
+		}
+	}
+
 	// Create output writer (file or stdout)
 	var out io.Writer
 	if o.OutFile == "" {
@@ -106,10 +139,10 @@ func run(o *options) error {
 	// Create key normalizer
 	var keyNormalizer importutil.KeyNormalizer
 	if o.Kind == configV1.Kind_seed {
-		keyNormalizer = &importutil.UriKeyNormalizer{Toplevel: o.Toplevel, IgnoreScheme: o.IgnoreScheme}
+		keyNormalizer = &importutil.UriKeyNormalizer{Toplevel: o.Toplevel, IgnoreScheme: o.IgnoreScheme, Rules: uriRules}
 	}
 
-	dbDir := path.Join(o.DbDir, config.GetContext(), o.Kind.String())
+	dbDir := importutil.StateDbDir(o.DbDir, config.GetContext(), o.Kind.String())
 
 	// Create state Database of kind seed or kind crawlEntity from Veidemann
 	stateDb, err := importutil.NewImportDb(dbDir, o.ResetDb)
@@ -129,7 +162,9 @@ func run(o *options) error {
 
 	var duplicateReporter DuplicateReporter
 
-	if o.Kind == configV1.Kind_seed {
+	if groupBy != "" {
+		duplicateReporter = importutil.SeedClusterReporter{ImportDb: stateDb, Client: client, GroupBy: groupBy}
+	} else if o.Kind == configV1.Kind_seed {
 		duplicateReporter = importutil.SeedReporter{ImportDb: stateDb, Client: client}
 	} else {
 		duplicateReporter = importutil.DuplicateKindReporter{ImportDb: stateDb}
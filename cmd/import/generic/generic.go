@@ -0,0 +1,312 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/config"
+	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/nlnwa/veidemannctl/format"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/nlnwa/veidemannctl/logger"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	Kind        string
+	Template    string
+	Key         string
+	Filename    string
+	ErrorFile   string
+	ColumnMap   string
+	OnExisting  string
+	DbDir       string
+	Truncate    bool
+	SkipImport  bool
+	DryRun      bool
+	Concurrency int
+}
+
+const (
+	onExistingSkip    = "skip"
+	onExistingReplace = "replace"
+)
+
+func NewCmd() *cobra.Command {
+	o := &options{}
+
+	cmd := &cobra.Command{
+		Use:   "generic",
+		Short: "Import config objects of any kind rendered from a template",
+		Long: `Import config objects of any kind by rendering each input record with a template.
+
+Input files ending in .csv or .tsv are read as comma or tab separated values with a header row, and
+files ending in .json, .yaml or .yml as a stream of JSON or YAML objects. Use --column-map to rename
+columns (field=column).
+
+The template is a Go template executed with the fields of a record, e.g. {{.name}}, and must render one
+config object as YAML or JSON, as accepted by the create command. The kind defaults to --kind and
+apiVersion to v1. A record rendering to nothing is skipped. Besides the standard template functions,
+json (quote a value as JSON), split, join, lower, upper, trim and default are available.
+
+Objects are deduplicated by a key created by the --key template, which is executed with the rendered
+config object, e.g. {{.Meta.Name}}. Keys of existing objects are kept in the state database. By default
+records matching an existing object are skipped. Use --on-existing=replace to overwrite the existing object.`,
+		Example: `# Create collections from a CSV file with the columns name and description
+cat > collection.tmpl <<'TMPL'
+meta:
+  name: {{json .name}}
+  description: {{json .description}}
+collection:
+  collectionDedupPolicy: MONTHLY
+TMPL
+veidemannctl import generic --kind collection --template collection.tmpl -f collections.csv`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch o.OnExisting {
+			case onExistingSkip, onExistingReplace:
+			default:
+				return fmt.Errorf("invalid value for --on-existing: %s", o.OnExisting)
+			}
+			if format.GetKind(o.Kind) == configV1.Kind_undefined {
+				return fmt.Errorf("invalid kind: %s", o.Kind)
+			}
+			// silence usage to prevent printing usage when an error occurs
+			cmd.SilenceUsage = true
+			return run(o)
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.Kind, "kind", "k", "", "Kind of config objects to import")
+	_ = cmd.MarkFlagRequired("kind")
+	cmd.Flags().StringVarP(&o.Template, "template", "t", "", "File with a template rendering a record into a config object")
+	_ = cmd.MarkFlagRequired("template")
+	cmd.Flags().StringVar(&o.Key, "key", "{{.Meta.Name}}", "Template creating the key used to find existing objects from a config object")
+	cmd.Flags().StringVarP(&o.Filename, "filename", "f", "", "Filename or directory to read from. "+
+		"If input is a directory, all files ending in .json, .yaml, .yml, .csv or .tsv will be tried. An input of '-' will read from stdin.")
+	_ = cmd.MarkFlagRequired("filename")
+	cmd.Flags().StringVar(&o.ColumnMap, "column-map", "", "Map fields to columns of CSV/TSV input (field=column[,field=column...])")
+	cmd.Flags().StringVar(&o.OnExisting, "on-existing", onExistingSkip, "What to do with records matching an existing object: skip or replace")
+	cmd.Flags().StringVarP(&o.ErrorFile, "err-file", "e", "-", "File to write errors to. \"-\" writes to stderr")
+	cmd.Flags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db. \":memory:\" keeps the state in memory for the duration of the command")
+	cmd.Flags().BoolVar(&o.Truncate, "truncate", false, "Truncate state database")
+	cmd.Flags().BoolVar(&o.SkipImport, "skip-import", false, "Do not import existing objects into state database")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "Run without actually writing anything to Veidemann")
+	cmd.Flags().IntVarP(&o.Concurrency, "concurrency", "c", 16, "Number of concurrent workers")
+
+	return cmd
+}
+
+func run(o *options) error {
+	kind := format.GetKind(o.Kind)
+
+	tmpl, err := importutil.LoadObjectTemplate(o.Template, kind)
+	if err != nil {
+		return err
+	}
+	keyer, err := importutil.ParseTemplateKey(o.Key)
+	if err != nil {
+		return err
+	}
+
+	columnMap, err := importutil.ParseColumnMap(o.ColumnMap)
+	if err != nil {
+		return err
+	}
+	csvDecoder := &importutil.CsvDecoder{ColumnMap: columnMap}
+	decoder := &importutil.SuffixDecoder{
+		Default:  &importutil.JsonYamlDecoder{},
+		Decoders: map[string]importutil.RecordDecoder{".csv": csvDecoder, ".tsv": csvDecoder},
+	}
+	rr, err := importutil.NewRecordReader(o.Filename, decoder, "*.json", "*.yaml", "*.yml", "*.csv", "*.tsv")
+	if err != nil {
+		return fmt.Errorf("failed to initialize reader: %w", err)
+	}
+
+	// Create error writer (file or stderr)
+	var errFile io.Writer
+	if o.ErrorFile == "" || o.ErrorFile == "-" {
+		errFile = logger.Stderr
+	} else {
+		f, err := os.Create(o.ErrorFile)
+		if err != nil {
+			return fmt.Errorf("unable to open error file '%v': %w", o.ErrorFile, err)
+		}
+		defer f.Close()
+		errFile = f
+	}
+
+	// Create Veidemann config client
+	conn, err := connection.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	client := configV1.NewConfigClient(conn)
+
+	// Create/open state database for the kind
+	dbDir := importutil.StateDbDir(o.DbDir, config.GetContext(), kind.String())
+	db, err := importutil.NewImportDb(dbDir, o.Truncate)
+	if err != nil {
+		return fmt.Errorf("failed to initialize state db: %w", err)
+	}
+	defer db.Close()
+
+	if !o.SkipImport {
+		err = importutil.ImportExisting(db, client, kind, keyer)
+		if err != nil {
+			return fmt.Errorf("failed to import %s: %w", kind, err)
+		}
+	}
+
+	// Create error logger
+	errorLog := log.Output(zerolog.ConsoleWriter{Out: errFile, TimeFormat: time.RFC3339})
+
+	imp := &importer{
+		client:   client,
+		db:       db,
+		template: tmpl,
+		keyer:    keyer,
+		replace:  o.OnExisting == onExistingReplace,
+		dryRun:   o.DryRun,
+		locks:    &importutil.KeyLocks{},
+		log:      errorLog,
+	}
+
+	errHandler := func(state importutil.Job[map[string]interface{}]) {
+		l := errorLog.With().
+			Str("filename", state.GetFilename()).
+			Int("recNum", state.GetRecordNum()).Logger()
+
+		var alreadyExists importutil.ErrAlreadyExists
+		if errors.As(state.GetError(), &alreadyExists) {
+			l.Warn().Msgf("Skipping: %v", alreadyExists.Error())
+		} else {
+			l.Error().Err(state.GetError()).Msg("")
+		}
+	}
+
+	executor := importutil.NewExecutor(o.Concurrency, imp.importRecord, errHandler)
+
+	for {
+		var record map[string]interface{}
+		state, err := rr.Next(&record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			errorLog.Error().Err(err).Msgf("error decoding record: %v", state)
+			continue
+		}
+		if state.GetError() != nil {
+			errorLog.Error().Err(state.GetError()).Str("filename", state.GetFilename()).Int("recNum", state.GetRecordNum()).Msg("Failed to decode record")
+			continue
+		}
+		executor.Queue <- importutil.Job[map[string]interface{}]{State: state, Val: record}
+	}
+
+	count, success, failed := executor.Wait()
+
+	errorLog.Info().Str("kind", kind.String()).Int("processed", count).Int("imported", success).Int("errors", failed).Msg("Import completed")
+
+	return nil
+}
+
+// importer creates or replaces a config object for each record.
+type importer struct {
+	client   configV1.ConfigClient
+	db       *importutil.ImportDb
+	template *importutil.ObjectTemplate
+	keyer    importutil.ObjectKeyer
+	replace  bool
+	dryRun   bool
+	locks    *importutil.KeyLocks
+	log      zerolog.Logger
+}
+
+// importRecord renders the record into a config object and saves it unless an object with the same key exists.
+func (i *importer) importRecord(record map[string]interface{}) error {
+	obj, err := i.template.Render(record)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return nil
+	}
+	key, err := i.keyer.ObjectKey(obj)
+	if err != nil {
+		return err
+	}
+
+	// Records with the same key must see the same state
+	unlock := i.locks.Lock(key)
+	defer unlock()
+
+	ids, err := i.db.Get(key)
+	if err != nil {
+		return err
+	}
+	// Only an object recorded in the import db is replaced, an id set by the template does not count
+	var replacing bool
+	if len(ids) > 0 {
+		if !i.replace {
+			return importutil.ErrAlreadyExists(key)
+		}
+		if len(ids) > 1 {
+			return importutil.ErrAmbiguous{Key: key, Ids: ids}
+		}
+		obj.Id = ids[0]
+		replacing = true
+	}
+
+	l := i.log.With().Str("kind", obj.GetKind().String()).Str("key", key).Str("name", obj.GetMeta().GetName()).Logger()
+
+	if i.dryRun {
+		if replacing {
+			l.Info().Str("id", obj.Id).Msg("Would replace config object in Veidemann")
+		} else {
+			l.Info().Msg("Would create config object in Veidemann")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	saved, err := i.client.SaveConfigObject(ctx, obj)
+	if err != nil {
+		return fmt.Errorf("failed to save %s '%s' in Veidemann: %w", obj.GetKind(), obj.GetMeta().GetName(), err)
+	}
+	if !slices.Contains(ids, saved.GetId()) {
+		if _, _, err := i.db.Set(key, saved.GetId()); err != nil {
+			return fmt.Errorf("failed to save %s to import db: %w", obj.GetKind(), err)
+		}
+	}
+	if replacing {
+		l.Info().Str("id", saved.GetId()).Msg("Replaced config object in Veidemann")
+	} else {
+		l.Info().Str("id", saved.GetId()).Msg("Created config object in Veidemann")
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package generic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+)
+
+// fakeConfigClient saves config objects, assigning ids to new ones
+type fakeConfigClient struct {
+	configV1.ConfigClient
+	mu    sync.Mutex
+	saved map[string]*configV1.ConfigObject
+}
+
+func (c *fakeConfigClient) SaveConfigObject(_ context.Context, obj *configV1.ConfigObject, _ ...grpc.CallOption) (*configV1.ConfigObject, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if obj.Id == "" {
+		obj.Id = fmt.Sprintf("id%d", len(c.saved)+1)
+	}
+	c.saved[obj.Id] = obj
+	return obj, nil
+}
+
+func newTestImporter(t *testing.T, replace bool) (*importer, *fakeConfigClient) {
+	return newTestTemplateImporter(t, "meta:\n  name: {{json .name}}\n  description: {{json .description}}\n", replace)
+}
+
+func newTestTemplateImporter(t *testing.T, template string, replace bool) (*importer, *fakeConfigClient) {
+	tmpl, err := importutil.ParseObjectTemplate(template, configV1.Kind_collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyer, err := importutil.ParseTemplateKey("{{lower .Meta.Name}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := importutil.NewImportDb(importutil.InMemory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+
+	client := &fakeConfigClient{saved: map[string]*configV1.ConfigObject{}}
+	return &importer{
+		client:   client,
+		db:       db,
+		template: tmpl,
+		keyer:    keyer,
+		replace:  replace,
+		locks:    &importutil.KeyLocks{},
+		log:      zerolog.Nop(),
+	}, client
+}
+
+func TestImportRecord(t *testing.T) {
+	imp, client := newTestImporter(t, false)
+
+	if err := imp.importRecord(map[string]interface{}{"name": "Daily", "description": "first"}); err != nil {
+		t.Fatal(err)
+	}
+	err := imp.importRecord(map[string]interface{}{"name": "daily", "description": "second"})
+	var alreadyExists importutil.ErrAlreadyExists
+	if !errors.As(err, &alreadyExists) {
+		t.Errorf("got error %v, want ErrAlreadyExists", err)
+	}
+	if len(client.saved) != 1 || client.saved["id1"].GetMeta().GetDescription() != "first" {
+		t.Errorf("got saved objects %v, want only the first", client.saved)
+	}
+}
+
+func TestImportRecordReplace(t *testing.T) {
+	imp, client := newTestImporter(t, true)
+
+	for _, description := range []string{"first", "second"} {
+		if err := imp.importRecord(map[string]interface{}{"name": "Daily", "description": description}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(client.saved) != 1 || client.saved["id1"].GetMeta().GetDescription() != "second" {
+		t.Errorf("got saved objects %v, want the first replaced by the second", client.saved)
+	}
+}
+
+func TestImportRecordTemplateId(t *testing.T) {
+	imp, client := newTestTemplateImporter(t, "id: {{json .id}}\nmeta:\n  name: {{json .name}}\n", false)
+
+	if err := imp.importRecord(map[string]interface{}{"id": "fixed", "name": "Daily"}); err != nil {
+		t.Fatal(err)
+	}
+	// The key of an object with an id from the template is recorded like any other
+	ids, err := imp.db.Get("daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != "fixed" {
+		t.Errorf("got ids %v for key, want [fixed]", ids)
+	}
+
+	err = imp.importRecord(map[string]interface{}{"id": "fixed", "name": "daily"})
+	var alreadyExists importutil.ErrAlreadyExists
+	if !errors.As(err, &alreadyExists) {
+		t.Errorf("got error %v, want ErrAlreadyExists", err)
+	}
+	if len(client.saved) != 1 {
+		t.Errorf("got saved objects %v, want one", client.saved)
+	}
+}
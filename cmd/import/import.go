@@ -15,7 +15,11 @@ package importcmd
 
 import (
 	"github.com/nlnwa/veidemannctl/cmd/import/convertoos"
+	"github.com/nlnwa/veidemannctl/cmd/import/db"
+	"github.com/nlnwa/veidemannctl/cmd/import/dedupe"
 	"github.com/nlnwa/veidemannctl/cmd/import/duplicatereport"
+	"github.com/nlnwa/veidemannctl/cmd/import/generic"
+	"github.com/nlnwa/veidemannctl/cmd/import/retire"
 	"github.com/nlnwa/veidemannctl/cmd/import/seeds"
 	"github.com/spf13/cobra"
 )
@@ -31,6 +35,10 @@ func NewCmd() *cobra.Command {
 	cmd.AddCommand(convertoos.NewCmd())      // convertoos
 	cmd.AddCommand(seeds.NewCmd())           // seed
 	cmd.AddCommand(duplicatereport.NewCmd()) // duplicate
+	cmd.AddCommand(retire.NewCmd())          // retire
+	cmd.AddCommand(dedupe.NewCmd())          // dedupe
+	cmd.AddCommand(db.NewCmd())              // db
+	cmd.AddCommand(generic.NewCmd())         // generic
 
 	return cmd
 }
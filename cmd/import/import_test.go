@@ -0,0 +1,10 @@
+package importcmd
+
+import "testing"
+
+// TestNewCmd guards against errors in flag setup, which cobra reports by panicking when the commands are created
+func TestNewCmd(t *testing.T) {
+	if len(NewCmd().Commands()) == 0 {
+		t.Error("expected import sub commands")
+	}
+}
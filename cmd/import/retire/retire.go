@@ -0,0 +1,324 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/config"
+	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/nlnwa/veidemannctl/logger"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type options struct {
+	Filename         string
+	ErrorFile        string
+	Toplevel         bool
+	IgnoreScheme     bool
+	NormalizerRules  string
+	DbDir            string
+	Truncate         bool
+	SkipImport       bool
+	Delete           bool
+	RemoveJobRefs    bool
+	CrawlJobId       string
+	IncludeAmbiguous bool
+	DryRun           bool
+	Concurrency      int
+}
+
+func NewCmd() *cobra.Command {
+	o := &options{}
+
+	cmd := &cobra.Command{
+		Use:   "retire",
+		Short: "Disable, detach or delete seeds from a list of URLs",
+		Long: `Disable, detach or delete seeds from a list of URLs.
+
+Each line of the input is a URL. The URL is normalized the same way as when importing seeds and the
+matching seeds are looked up in the state database, which is filled with existing seeds from Veidemann.
+
+By default matching seeds are disabled. Use --remove-job-refs to remove the seeds from crawl jobs
+(all crawl jobs or only the one given by --crawljob-id), or --delete to delete the seeds.
+
+URLs without a matching seed are reported. URLs matching more than one seed are reported and
+skipped unless --include-ambiguous is given.`,
+		Example: `# Disable seeds
+veidemannctl import retire -f urls.txt
+
+# Delete seeds
+veidemannctl import retire -f urls.txt --delete`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.CrawlJobId != "" && !o.RemoveJobRefs {
+				return fmt.Errorf("--crawljob-id requires --remove-job-refs")
+			}
+			return run(o)
+		},
+	}
+
+	cmd.Flags().StringVarP(&o.Filename, "filename", "f", "", "Filename or directory to read from. "+
+		"If input is a directory, all files ending in .txt will be tried. An input of '-' will read from stdin.")
+	_ = cmd.MarkFlagRequired("filename")
+	cmd.Flags().StringVarP(&o.ErrorFile, "err-file", "e", "-", "File to write errors to. \"-\" writes to stderr")
+	cmd.Flags().BoolVar(&o.Toplevel, "toplevel", false, "Convert URI by removing path")
+	cmd.Flags().BoolVar(&o.IgnoreScheme, "ignore-scheme", true, "Ignore the URL's scheme when looking up seeds")
+	cmd.Flags().StringVar(&o.NormalizerRules, "normalizer-rules", "", importutil.NormalizerRulesUsage)
+	cmd.Flags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db. \":memory:\" keeps the state in memory for the duration of the command")
+	cmd.Flags().BoolVar(&o.Truncate, "truncate", false, "Truncate state database")
+	cmd.Flags().BoolVar(&o.SkipImport, "skip-import", false, "Do not import existing seeds into state database")
+	cmd.Flags().BoolVar(&o.Delete, "delete", false, "Delete matching seeds")
+	cmd.Flags().BoolVar(&o.RemoveJobRefs, "remove-job-refs", false, "Remove crawl job references from matching seeds")
+	cmd.Flags().StringVar(&o.CrawlJobId, "crawljob-id", "", "Only remove the reference to this crawl job")
+	cmd.Flags().BoolVar(&o.IncludeAmbiguous, "include-ambiguous", false, "Retire every seed matching a URL that matches more than one seed")
+	cmd.Flags().BoolVar(&o.DryRun, "dry-run", false, "Run without actually writing anything to Veidemann")
+	cmd.Flags().IntVarP(&o.Concurrency, "concurrency", "c", 16, "Number of concurrent workers")
+	cmd.MarkFlagsMutuallyExclusive("delete", "remove-job-refs")
+
+	return cmd
+}
+
+func run(o *options) error {
+	// Load canonicalization rules for URI keys
+	var uriRules *importutil.UriRules
+	if o.NormalizerRules != "" {
+		var err error
+		uriRules, err = importutil.LoadUriRules(o.NormalizerRules)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create error writer (file or stderr)
+	var errFile io.Writer
+	if o.ErrorFile == "" || o.ErrorFile == "-" {
+		errFile = logger.Stderr
+	} else {
+		f, err := os.Create(o.ErrorFile)
+		if err != nil {
+			return fmt.Errorf("unable to open error file '%v': %w", o.ErrorFile, err)
+		}
+		defer f.Close()
+		errFile = f
+	}
+
+	// Create Veidemann config client
+	conn, err := connection.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+	client := configV1.NewConfigClient(conn)
+
+	uriNormalizer := &importutil.UriKeyNormalizer{IgnoreScheme: o.IgnoreScheme, Toplevel: o.Toplevel, Rules: uriRules}
+
+	// Create/open state database for seeds
+	seedDbDir := importutil.StateDbDir(o.DbDir, config.GetContext(), configV1.Kind_seed.String())
+	seedDb, err := importutil.NewImportDb(seedDbDir, o.Truncate)
+	if err != nil {
+		return fmt.Errorf("failed to initialize seed state db: %w", err)
+	}
+	defer seedDb.Close()
+
+	if !o.SkipImport {
+		err = importutil.ImportExisting(seedDb, client, configV1.Kind_seed, uriNormalizer)
+		if err != nil {
+			return fmt.Errorf("failed to import seeds: %w", err)
+		}
+	}
+
+	rr, err := importutil.NewRecordReader(o.Filename, &importutil.LineAsStringDecoder{}, "*.txt")
+	if err != nil {
+		return fmt.Errorf("failed to initialize reader: %w", err)
+	}
+
+	// Create error logger
+	errorLog := log.Output(zerolog.ConsoleWriter{Out: errFile, TimeFormat: time.RFC3339})
+
+	// retireSeed disables, detaches or deletes a seed
+	retireSeed := func(key string, seedId string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		seed, err := client.GetConfigObject(ctx, &configV1.ConfigRef{Kind: configV1.Kind_seed, Id: seedId})
+		if err != nil {
+			return fmt.Errorf("failed to get seed '%s' from Veidemann: %w", seedId, err)
+		}
+
+		if seed.GetSeed() == nil {
+			return fmt.Errorf("object '%s' is not a seed", seedId)
+		}
+
+		l := errorLog.With().Str("seedId", seedId).Str("uri", seed.GetMeta().GetName()).Logger()
+
+		if o.Delete {
+			if o.DryRun {
+				l.Info().Msg("Would delete seed")
+				return nil
+			}
+			if _, err := client.DeleteConfigObject(ctx, seed); err != nil {
+				return fmt.Errorf("failed to delete seed '%s': %w", seedId, err)
+			}
+			if err := seedDb.Delete(key, seedId); err != nil {
+				return fmt.Errorf("failed to delete seed '%s' from state db: %w", seedId, err)
+			}
+			l.Info().Msg("Deleted seed")
+			return nil
+		}
+
+		var action string
+		if o.RemoveJobRefs {
+			action = "Removed crawl job references from seed"
+			if !removeJobRefs(seed, o.CrawlJobId) {
+				l.Info().Msg("Seed has no matching crawl job references")
+				return nil
+			}
+		} else {
+			action = "Disabled seed"
+			if seed.GetSeed().GetDisabled() {
+				l.Info().Msg("Seed already disabled")
+				return nil
+			}
+			seed.GetSeed().Disabled = true
+		}
+
+		if o.DryRun {
+			l.Info().Msg("Would update seed: " + strings.ToLower(action))
+			return nil
+		}
+		if _, err := client.SaveConfigObject(ctx, seed); err != nil {
+			return fmt.Errorf("failed to update seed '%s': %w", seedId, err)
+		}
+		l.Info().Msg(action)
+		return nil
+	}
+
+	// Create processor function for each URL in input file
+	proc := func(uri string) error {
+		key, err := uriNormalizer.Normalize(uri)
+		if err != nil {
+			return fmt.Errorf("failed to normalize URL '%s': %w", uri, err)
+		}
+
+		seedIds, err := seedDb.Get(key)
+		if err != nil {
+			return err
+		}
+		if len(seedIds) == 0 {
+			return importutil.ErrNotFound(key)
+		}
+		if len(seedIds) > 1 && !o.IncludeAmbiguous {
+			return importutil.ErrAmbiguous{Key: key, Ids: seedIds}
+		}
+
+		for _, seedId := range seedIds {
+			if err := retireSeed(key, seedId); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var m sync.Mutex
+	var unmatched, ambiguous int
+
+	errHandler := func(state importutil.Job[string]) {
+		l := errorLog.With().
+			Str("uri", state.Val).
+			Str("filename", state.GetFilename()).
+			Int("recNum", state.GetRecordNum()).Logger()
+
+		var notFound importutil.ErrNotFound
+		var ambiguousErr importutil.ErrAmbiguous
+		switch {
+		case errors.As(state.GetError(), &notFound):
+			m.Lock()
+			unmatched++
+			m.Unlock()
+			l.Warn().Msg("Unmatched: no seed found")
+		case errors.As(state.GetError(), &ambiguousErr):
+			m.Lock()
+			ambiguous++
+			m.Unlock()
+			l.Warn().Strs("seedIds", ambiguousErr.Ids).Msg("Ambiguous: skipping URL matching more than one seed")
+		default:
+			l.Error().Err(state.GetError()).Msg("")
+		}
+	}
+
+	executor := importutil.NewExecutor(o.Concurrency, proc, errHandler)
+
+	for {
+		var uri string
+		state, err := rr.Next(&uri)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			errorLog.Error().Err(err).Msgf("error decoding record: %v", state)
+			continue
+		}
+		// ignore empty lines and comments
+		if uri == "" || strings.HasPrefix(uri, "#") {
+			continue
+		}
+		executor.Queue <- importutil.Job[string]{State: state, Val: uri}
+	}
+
+	count, success, failed := executor.Wait()
+
+	errorLog.Info().
+		Int("processed", count).
+		Int("retired", success).
+		Int("unmatched", unmatched).
+		Int("ambiguous", ambiguous).
+		Int("errors", failed-unmatched-ambiguous).
+		Msg("Retire completed")
+
+	return nil
+}
+
+// removeJobRefs removes the reference to the crawl job with the given id, or all crawl job references if
+// crawlJobId is empty. It returns true if any reference was removed.
+func removeJobRefs(seed *configV1.ConfigObject, crawlJobId string) bool {
+	spec := seed.GetSeed()
+	if spec == nil || len(spec.JobRef) == 0 {
+		return false
+	}
+	if crawlJobId == "" {
+		spec.JobRef = nil
+		return true
+	}
+	var refs []*configV1.ConfigRef
+	for _, ref := range spec.JobRef {
+		if ref.GetId() != crawlJobId {
+			refs = append(refs, ref)
+		}
+	}
+	removed := len(refs) != len(spec.JobRef)
+	spec.JobRef = refs
+	return removed
+}
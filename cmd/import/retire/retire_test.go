@@ -0,0 +1,53 @@
+package retire
+
+import (
+	"testing"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+)
+
+func TestRemoveJobRefs(t *testing.T) {
+	newSeed := func() *configV1.ConfigObject {
+		return &configV1.ConfigObject{
+			Spec: &configV1.ConfigObject_Seed{
+				Seed: &configV1.Seed{
+					JobRef: []*configV1.ConfigRef{
+						{Kind: configV1.Kind_crawlJob, Id: "job1"},
+						{Kind: configV1.Kind_crawlJob, Id: "job2"},
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		crawlJobId  string
+		wantRemoved bool
+		wantRefs    int
+	}{
+		{"all", "", true, 0},
+		{"one", "job1", true, 1},
+		{"none", "job3", false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed := newSeed()
+			if got := removeJobRefs(seed, tt.crawlJobId); got != tt.wantRemoved {
+				t.Errorf("removeJobRefs() = %v, want %v", got, tt.wantRemoved)
+			}
+			if got := len(seed.GetSeed().GetJobRef()); got != tt.wantRefs {
+				t.Errorf("got %d job refs, want %d", got, tt.wantRefs)
+			}
+			for _, ref := range seed.GetSeed().GetJobRef() {
+				if ref.GetId() == tt.crawlJobId {
+					t.Errorf("job ref %s not removed", tt.crawlJobId)
+				}
+			}
+		})
+	}
+
+	if removeJobRefs(&configV1.ConfigObject{}, "") {
+		t.Error("expected nothing to be removed from object without seed spec")
+	}
+}
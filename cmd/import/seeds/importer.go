@@ -0,0 +1,175 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package seeds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/rs/zerolog"
+)
+
+// locker locks a set of keys.
+type locker interface {
+	Lock(keys ...string) (unlock func())
+}
+
+// record is a record being imported and the result of importing it.
+type record struct {
+	*importutil.SeedDesc
+	// input is the record as decoded from the input, saved in reports of failed records for retries
+	input json.RawMessage
+	// inputUri is the uri of the record before redirects are followed
+	inputUri string
+	key      string
+	seedId   string
+	entityId string
+	outcome  importutil.Outcome
+}
+
+// importer creates or updates the seed of each record.
+//
+// Records are imported concurrently. Only records with the same normalized URI or entity name are
+// serialized, by locking both while the state databases and Veidemann are checked and updated.
+type importer struct {
+	client       configV1.ConfigClient
+	entityDb     *importutil.ImportDb
+	seedDb       *importutil.ImportDb
+	intentLog    *importutil.IntentLog
+	normalizer   importutil.KeyNormalizer
+	uriChecker   *importutil.UriChecker
+	acceptPolicy *importutil.AcceptPolicy
+	crawlJobRef  []*configV1.ConfigRef
+	onExisting   string
+	dryRun       bool
+	locks        locker
+	log          zerolog.Logger
+}
+
+// updateSeed updates an existing seed with values from a record and returns true if the seed changed.
+func (i *importer) updateSeed(sd *importutil.SeedDesc, seedId string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	seed, err := i.client.GetConfigObject(ctx, &configV1.ConfigRef{Kind: configV1.Kind_seed, Id: seedId})
+	if err != nil {
+		return false, fmt.Errorf("failed to get seed '%s' from Veidemann: %w", seedId, err)
+	}
+
+	changed := sd.UpdateSeed(seed, i.onExisting == onExistingReplace)
+
+	l := i.log.With().Str("seedId", seedId).Str("uri", seed.GetMeta().GetName()).Logger()
+	if len(changed) == 0 {
+		l.Info().Msg("Seed unchanged")
+		return false, nil
+	}
+	if i.dryRun {
+		l.Info().Strs("changed", changed).Msg("Would update seed in Veidemann")
+		return true, nil
+	}
+	if _, err := i.client.SaveConfigObject(ctx, seed); err != nil {
+		return false, fmt.Errorf("failed to update seed '%s' in Veidemann: %w", seedId, err)
+	}
+	l.Info().Strs("changed", changed).Msg("Updated seed in Veidemann")
+	return true, nil
+}
+
+// importSeed imports the seed of a record and sets the result of a successful import in the record.
+func (i *importer) importSeed(r *record) error {
+	sd := r.SeedDesc
+	r.inputUri = sd.Uri
+
+	if i.crawlJobRef != nil {
+		sd.CrawlJobRef = i.crawlJobRef
+	}
+
+	if i.uriChecker != nil {
+		// check liveness of uri and follow permanent redirects
+		result := i.uriChecker.Check(sd.Uri)
+		if !i.acceptPolicy.Accept(result) {
+			return importutil.ErrUriCheck{Result: result}
+		}
+		if result.Category != importutil.UriOk {
+			i.log.Warn().Str("uri", sd.Uri).Interface("uriCheck", result).Msg("Accepted uri flagged by uri check")
+		}
+		sd.Uri = result.Uri
+	}
+
+	normalizedUri, err := i.normalizer.Normalize(sd.Uri)
+	if err != nil {
+		return fmt.Errorf("failed to normalize URL '%s': %w", sd.Uri, err)
+	}
+	r.key = normalizedUri
+
+	// Ensure concurrent records with the same seed or entity see the same state by locking both
+	// while checking and updating state database and Veidemann.
+	keys := []string{"seed\x00" + normalizedUri}
+	if sd.EntityId == "" {
+		keys = append(keys, "entity\x00"+sd.EntityName)
+	}
+	unlock := i.locks.Lock(keys...)
+	defer unlock()
+
+	// Check if seed already exists in state database
+	seedIds, err := i.seedDb.Get(normalizedUri)
+	if err != nil {
+		return err
+	} else if len(seedIds) > 0 {
+		if i.onExisting == onExistingSkip {
+			return importutil.ErrAlreadyExists(normalizedUri)
+		}
+		r.outcome = importutil.OutcomeUnchanged
+		for _, seedId := range seedIds {
+			changed, err := i.updateSeed(sd, seedId)
+			if err != nil {
+				return err
+			}
+			if changed {
+				r.outcome = importutil.OutcomeUpdated
+			}
+		}
+		return nil
+	}
+
+	if i.dryRun {
+		r.outcome = importutil.OutcomeCreated
+		return nil
+	}
+
+	if sd.EntityId == "" {
+		entityIds, err := i.entityDb.Get(sd.EntityName)
+		if err != nil {
+			return fmt.Errorf("failed to get entity: %w", err)
+		}
+		if len(entityIds) > 0 {
+			sd.EntityId = entityIds[0]
+		}
+	}
+
+	seed, entity, err := i.intentLog.Create(normalizedUri, sd)
+	if entity != nil {
+		i.log.Info().Str("entityId", entity.Id).Str("entityName", entity.Meta.Name).Msg("Created new entity in Veidemann")
+	}
+	if seed != nil {
+		i.log.Info().Str("key", normalizedUri).Str("seedId", seed.Id).Str("uri", sd.Uri).Msg("Created new seed in Veidemann")
+		r.outcome = importutil.OutcomeCreated
+		r.seedId = seed.Id
+		r.entityId = sd.EntityId
+	}
+	return err
+}
@@ -0,0 +1,210 @@
+package seeds
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeConfigClient stores config objects in a map and takes latency to answer each call
+type fakeConfigClient struct {
+	configV1.ConfigClient
+	latency time.Duration
+
+	mu      sync.Mutex
+	objects map[string]*configV1.ConfigObject
+}
+
+func newFakeConfigClient(latency time.Duration) *fakeConfigClient {
+	return &fakeConfigClient{latency: latency, objects: make(map[string]*configV1.ConfigObject)}
+}
+
+func (c *fakeConfigClient) SaveConfigObject(_ context.Context, o *configV1.ConfigObject, _ ...grpc.CallOption) (*configV1.ConfigObject, error) {
+	time.Sleep(c.latency)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.objects[o.GetId()] = o
+	return o, nil
+}
+
+func (c *fakeConfigClient) GetConfigObject(_ context.Context, ref *configV1.ConfigRef, _ ...grpc.CallOption) (*configV1.ConfigObject, error) {
+	time.Sleep(c.latency)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if o, ok := c.objects[ref.GetId()]; ok {
+		return o, nil
+	}
+	return nil, status.Error(codes.NotFound, "not found")
+}
+
+// count returns the number of objects of the kind with each name.
+func (c *fakeConfigClient) count(kind configV1.Kind) map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := make(map[string]int)
+	for _, o := range c.objects {
+		if o.GetKind() == kind {
+			n[o.GetMeta().GetName()]++
+		}
+	}
+	return n
+}
+
+// globalLock locks all keys with a single mutex
+type globalLock struct {
+	mu sync.Mutex
+}
+
+func (l *globalLock) Lock(...string) func() {
+	l.mu.Lock()
+	return l.mu.Unlock
+}
+
+func newTestImporter(tb testing.TB, client configV1.ConfigClient, locks locker) *importer {
+	entityDb, err := importutil.NewImportDb(importutil.InMemory, false)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	seedDb, err := importutil.NewImportDb(importutil.InMemory, false)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return &importer{
+		client:     client,
+		entityDb:   entityDb,
+		seedDb:     seedDb,
+		intentLog:  &importutil.IntentLog{Client: client, EntityDb: entityDb, SeedDb: seedDb},
+		normalizer: &importutil.UriKeyNormalizer{IgnoreScheme: true},
+		onExisting: onExistingSkip,
+		locks:      locks,
+		log:        zerolog.New(io.Discard),
+	}
+}
+
+// importAll imports the records with concurrent workers and returns the number of failed records.
+func importAll(imp *importer, concurrency int, records []importutil.SeedDesc) int {
+	executor := importutil.NewExecutor(concurrency, imp.importSeed, func(importutil.Job[*record]) {})
+	for i := range records {
+		sd := records[i]
+		executor.Queue <- importutil.Job[*record]{State: &importutil.State{}, Val: &record{SeedDesc: &sd}}
+	}
+	_, _, failed := executor.Wait()
+	return failed
+}
+
+func TestImporterConcurrentDuplicates(t *testing.T) {
+	client := newFakeConfigClient(100 * time.Microsecond)
+	imp := newTestImporter(t, client, &importutil.KeyLocks{})
+
+	// Every seed appears ten times, with and without scheme, and the seeds share a few entities
+	var records []importutil.SeedDesc
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 20; j++ {
+			scheme := "https"
+			if i%2 == 0 {
+				scheme = "http"
+			}
+			records = append(records, importutil.SeedDesc{
+				EntityName: fmt.Sprintf("entity%d", j%5),
+				Uri:        fmt.Sprintf("%s://example%d.com/", scheme, j),
+			})
+		}
+	}
+
+	failed := importAll(imp, 16, records)
+
+	if want := len(records) - 20; failed != want {
+		t.Errorf("Got %d skipped records, want %d", failed, want)
+	}
+	seeds := client.count(configV1.Kind_seed)
+	entities := client.count(configV1.Kind_crawlEntity)
+	if len(seeds) != 20 || len(entities) != 5 {
+		t.Errorf("Got %d seeds and %d entities, want 20 and 5", len(seeds), len(entities))
+	}
+	for name, n := range seeds {
+		if n > 1 {
+			t.Errorf("Seed %s created %d times", name, n)
+		}
+	}
+	for name, n := range entities {
+		if n > 1 {
+			t.Errorf("Entity %s created %d times", name, n)
+		}
+	}
+}
+
+// BenchmarkImporter compares importing unrelated seeds with a global lock and with per-key locks
+// against a config client with 1ms latency.
+func BenchmarkImporter(b *testing.B) {
+	records := make([]importutil.SeedDesc, 64)
+	for i := range records {
+		records[i] = importutil.SeedDesc{EntityName: fmt.Sprintf("entity%d", i), Uri: fmt.Sprintf("https://example%d.com/", i)}
+	}
+
+	benchmarks := []struct {
+		name  string
+		locks func() locker
+	}{
+		{"global-lock", func() locker { return &globalLock{} }},
+		{"key-locks", func() locker { return &importutil.KeyLocks{} }},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				imp := newTestImporter(b, newFakeConfigClient(time.Millisecond), bm.locks())
+				b.StartTimer()
+
+				if failed := importAll(imp, 16, records); failed > 0 {
+					b.Fatalf("%d records failed", failed)
+				}
+			}
+			b.ReportMetric(float64(b.N*len(records))/b.Elapsed().Seconds(), "seeds/s")
+		})
+	}
+}
+
+func TestImporterResult(t *testing.T) {
+	client := newFakeConfigClient(0)
+	imp := newTestImporter(t, client, &importutil.KeyLocks{})
+
+	r := &record{SeedDesc: &importutil.SeedDesc{EntityName: "Example", Uri: "https://example.com/"}}
+	if err := imp.importSeed(r); err != nil {
+		t.Fatal(err)
+	}
+	if r.outcome != importutil.OutcomeCreated || r.key != "//example.com/" || r.inputUri != "https://example.com/" {
+		t.Errorf("Got outcome %q, key %q and uri %q, want created, //example.com/ and https://example.com/", r.outcome, r.key, r.inputUri)
+	}
+	if _, ok := client.objects[r.seedId]; !ok {
+		t.Errorf("Seed id %q of result not in Veidemann", r.seedId)
+	}
+	if _, ok := client.objects[r.entityId]; !ok {
+		t.Errorf("Entity id %q of result not in Veidemann", r.entityId)
+	}
+
+	// An existing seed is updated with a new label, and unchanged the second time
+	imp.onExisting = onExistingMerge
+	for _, want := range []importutil.Outcome{importutil.OutcomeUpdated, importutil.OutcomeUnchanged} {
+		r := &record{SeedDesc: &importutil.SeedDesc{
+			EntityName: "Example",
+			Uri:        "http://example.com/",
+			SeedLabel:  []*configV1.Label{{Key: "topic", Value: "news"}},
+		}}
+		if err := imp.importSeed(r); err != nil {
+			t.Fatal(err)
+		}
+		if r.outcome != want {
+			t.Errorf("Got outcome %q, want %q", r.outcome, want)
+		}
+	}
+}
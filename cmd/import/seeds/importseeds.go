@@ -14,39 +14,65 @@
 package seeds
 
 import (
-	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/spf13/cobra"
 	"io"
 	"os"
-	"path"
-	"sync"
 	"time"
 
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
 	"github.com/nlnwa/veidemannctl/config"
 	"github.com/nlnwa/veidemannctl/connection"
 	"github.com/nlnwa/veidemannctl/importutil"
+	"github.com/nlnwa/veidemannctl/logger"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
 type options struct {
-	Toplevel        bool
-	IgnoreScheme    bool
-	CheckUri        bool
-	Truncate        bool
-	DryRun          bool
-	SkipImport      bool
-	CheckUriTimeout time.Duration
-	Filename        string
-	ErrorFile       string
-	CrawlJobId      string
-	DbDir           string
-	Concurrency     int
+	Toplevel              bool
+	IgnoreScheme          bool
+	NormalizerRules       string
+	CheckUri              bool
+	Truncate              bool
+	Resume                bool
+	DryRun                bool
+	SkipImport            bool
+	CheckUriTimeout       time.Duration
+	CheckUriRate          float64
+	CheckUriHostRate      float64
+	CheckUriRetries       int
+	CheckUriMaxRetryAfter time.Duration
+	CheckUriSoft404       bool
+	Accept                []string
+	Filename              string
+	ErrorFile             string
+	Report                string
+	RetryFrom             string
+	RetryCategories       []string
+	CrawlJobId            string
+	ColumnMap             string
+	OnExisting            string
+	FromSitemap           string
+	FromFeed              string
+	FromHtml              string
+	FetchTimeout          time.Duration
+	EntityName            string
+	EntityId              string
+	EntityLabels          []string
+	SeedLabels            []string
+	DbDir                 string
+	Concurrency           int
 }
 
+const (
+	onExistingSkip    = "skip"
+	onExistingMerge   = "merge"
+	onExistingReplace = "replace"
+)
+
 func NewCmd() *cobra.Command {
 	o := &options{}
 
@@ -60,38 +86,203 @@ func NewCmd() *cobra.Command {
 
 Every record must be formatted on a single line.
 
+Files ending in .csv or .tsv are read as comma or tab separated values with a header row.
+By default column names are used as field names. Use --column-map to map fields to columns,
+where a field on the form seedLabel.<key> or entityLabel.<key> adds a label with the given key.
+
+Use --from-sitemap, --from-feed or --from-html to import every URI found in a sitemap (including
+nested sitemap indexes), an RSS/Atom feed or the links of an HTML page, given as a local file or a URL.
+All seeds are created for the entity given by --entity-name or --entity-id.
+
+By default records matching an existing seed are skipped. Use --on-existing=merge to add new seed labels
+and crawl job references to the existing seed and update its description, or --on-existing=replace to
+replace them with the values of the record. Fields left out of the record are kept on the existing seed.
+
+A checkpoint is stored in the state database as records are processed. If an import is
+interrupted, run the same command again with --resume to skip records that were already processed.
 
+Creating a seed and its entity is recorded in an intent log in the state database. Seeds and entities
+left half-created by an interrupted import are completed or deleted when the command is run again.
+
+Use --report to write the result of each record as a line of JSON with the file name, record number,
+URI, normalized key, outcome (created, updated, unchanged, skipped-duplicate, failed-check or error),
+the ids of a created seed and its entity and any error message. The last line is a summary with the
+number of records per outcome and the elapsed time.
+
+Use --retry-from with the report of a previous import to import only the records that failed, optionally
+limited to some error categories with --retry-categories (e.g. timeout,5xx).
 `,
+		Example: `# Import seeds from a spreadsheet exported as CSV
+veidemannctl import seed -f seeds.csv --column-map uri=URL,entityName=Owner,seedLabel.topic=Topic
+
+# Import every URI in a sitemap as seeds of one entity
+veidemannctl import seed --from-sitemap https://www.example.com/sitemap.xml --entity-name "Example" --seed-label event:election
+
+# Retry records that failed with a timeout or a server error in a previous import
+veidemannctl import seed -f seeds.json --report report.json
+veidemannctl import seed --retry-from report.json --retry-categories timeout,5xx --report retry.json`,
 		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if o.Resume && o.Truncate {
+				return fmt.Errorf("--resume can not be combined with --truncate")
+			}
+			switch o.OnExisting {
+			case onExistingSkip, onExistingMerge, onExistingReplace:
+			default:
+				return fmt.Errorf("invalid value for --on-existing: %s", o.OnExisting)
+			}
+			if len(o.RetryCategories) > 0 && o.RetryFrom == "" {
+				return fmt.Errorf("--retry-categories requires --retry-from")
+			}
+			if o.RetryFrom != "" && o.Report == o.RetryFrom {
+				return fmt.Errorf("--report must be another file than --retry-from")
+			}
+			if o.source() != "" && o.EntityName == "" && o.EntityId == "" {
+				return fmt.Errorf("--entity-name or --entity-id is required when importing from a sitemap, feed or html")
+			}
 			return run(o)
 		},
 	}
 
-	// filename is required
 	cmd.Flags().StringVarP(&o.Filename, "filename", "f", "", "Filename or directory to read from. "+
-		"If input is a directory, all files ending in .yaml or .json will be tried. An input of '-' will read from stdin.")
-	_ = cmd.MarkFlagRequired("filename")
+		"If input is a directory, all files ending in .json, .yaml, .csv or .tsv will be tried. An input of '-' will read from stdin.")
+	cmd.Flags().StringVar(&o.FromSitemap, "from-sitemap", "", "Import URIs from a sitemap file or URL")
+	cmd.Flags().StringVar(&o.FromFeed, "from-feed", "", "Import URIs from an RSS or Atom feed file or URL")
+	cmd.Flags().StringVar(&o.FromHtml, "from-html", "", "Import URIs linked from an HTML file or URL")
+	cmd.Flags().DurationVar(&o.FetchTimeout, "fetch-timeout", 30*time.Second, "Timeout when fetching a sitemap, feed or html from a URL")
+	cmd.Flags().StringVar(&o.EntityName, "entity-name", "", "Entity name for seeds imported from a sitemap, feed or html")
+	cmd.Flags().StringVar(&o.EntityId, "entity-id", "", "Id of existing entity for seeds imported from a sitemap, feed or html")
+	cmd.Flags().StringSliceVar(&o.EntityLabels, "entity-label", nil, "Label (key:value) of new entity for seeds imported from a sitemap, feed or html")
+	cmd.Flags().StringSliceVar(&o.SeedLabels, "seed-label", nil, "Label (key:value) of seeds imported from a sitemap, feed or html")
+	cmd.Flags().StringVar(&o.RetryFrom, "retry-from", "", "Report file of a previous import (see --report). Only records that failed are imported")
+	cmd.Flags().StringSliceVar(&o.RetryCategories, "retry-categories", nil, "Only retry records failing with these categories (timeout, unavailable, error, a uri check category, 4xx, 5xx or a status code)")
 	cmd.Flags().StringVarP(&o.ErrorFile, "err-file", "e", "-", "File to write errors to. \"-\" writes to stderr")
+	cmd.Flags().StringVar(&o.Report, "report", "", "File to write the result of each record to as a line of JSON, followed by a summary. \"-\" writes to stdout")
 	cmd.Flags().BoolVarP(&o.Toplevel, "toplevel", "", false, "Convert URI by removing path")
 	cmd.Flags().BoolVarP(&o.IgnoreScheme, "ignore-scheme", "", true, "Ignore the URL's scheme when checking if this URL is already imported")
+	cmd.Flags().StringVar(&o.NormalizerRules, "normalizer-rules", "", importutil.NormalizerRulesUsage)
 	cmd.Flags().BoolVarP(&o.CheckUri, "check-uri", "", false, "Check the uri for liveness and follow permanent redirects")
 	cmd.Flags().DurationVarP(&o.CheckUriTimeout, "check-uri-timeout", "", 2*time.Second, "Timeout duration when checking uri for liveness")
+	cmd.Flags().Float64Var(&o.CheckUriRate, "check-uri-rate", 0, "Maximum number of requests per second when checking uris, 0 means unlimited")
+	cmd.Flags().Float64Var(&o.CheckUriHostRate, "check-uri-host-rate", 1, "Maximum number of requests per second to each host when checking uris, 0 means unlimited")
+	cmd.Flags().IntVar(&o.CheckUriRetries, "check-uri-retries", 2, "Number of retries when a server responds with 429 or 503 and a Retry-After header")
+	cmd.Flags().DurationVar(&o.CheckUriMaxRetryAfter, "check-uri-max-retry-after", time.Minute, "Longest Retry-After delay to wait for before retrying, 0 means no limit")
+	cmd.Flags().StringSliceVar(&o.Accept, "accept", nil, importutil.AcceptUsage)
+	cmd.Flags().BoolVar(&o.CheckUriSoft404, "check-uri-soft-404", false, "Fetch reachable pages when checking uris to detect not found pages responding with 200")
+	cmd.Flags().StringVar(&o.ColumnMap, "column-map", "", "Map fields to columns in CSV/TSV files (e.g. uri=URL,entityName=Owner,seedLabel.topic=Topic)")
+	cmd.Flags().StringVar(&o.OnExisting, "on-existing", onExistingSkip, "What to do with records matching an existing seed (skip|merge|replace)")
 	cmd.Flags().StringVarP(&o.CrawlJobId, "crawljob-id", "", "", "Set crawlJob ID for new seeds")
-	cmd.Flags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db")
+	cmd.Flags().StringVarP(&o.DbDir, "db-dir", "b", "/tmp/veidemannctl", "Directory for storing state db. \":memory:\" keeps the state in memory for the duration of the command")
 	cmd.Flags().BoolVar(&o.Truncate, "truncate", false, "Truncate state database")
+	cmd.Flags().BoolVar(&o.Resume, "resume", false, "Skip records processed by a previous run of the same import")
 	cmd.Flags().BoolVarP(&o.DryRun, "dry-run", "", false, "Run without actually writing anything to Veidemann")
 	cmd.Flags().BoolVar(&o.SkipImport, "skip-import", false, "Do not import existing seeds into state database")
 	cmd.Flags().IntVarP(&o.Concurrency, "concurrency", "c", 16, "Number of concurrent workers")
 
+	cmd.MarkFlagsOneRequired("filename", "from-sitemap", "from-feed", "from-html", "retry-from")
+	cmd.MarkFlagsMutuallyExclusive("filename", "from-sitemap", "from-feed", "from-html", "retry-from")
+	cmd.MarkFlagsMutuallyExclusive("resume", "retry-from")
+	cmd.MarkFlagsMutuallyExclusive("column-map", "from-sitemap", "from-feed", "from-html")
+
 	return cmd
 }
 
+// source returns the sitemap, feed or html to import from, if any.
+func (o *options) source() string {
+	switch {
+	case o.FromSitemap != "":
+		return o.FromSitemap
+	case o.FromFeed != "":
+		return o.FromFeed
+	default:
+		return o.FromHtml
+	}
+}
+
+// recordReader reads seed descriptions.
+type recordReader interface {
+	Next(v interface{}) (*importutil.State, error)
+}
+
+// newRecordReader creates a reader of seed descriptions from input files, from URIs
+// extracted from a sitemap, feed or html, or from failed records in a report.
+func newRecordReader(o *options) (recordReader, error) {
+	if o.RetryFrom != "" {
+		filter, err := importutil.ParseRetryFilter(o.RetryCategories)
+		if err != nil {
+			return nil, err
+		}
+		return importutil.NewRetryReader(o.RetryFrom, filter)
+	}
+
+	source := o.source()
+	if source == "" {
+		columnMap, err := importutil.ParseColumnMap(o.ColumnMap)
+		if err != nil {
+			return nil, err
+		}
+		csvDecoder := &importutil.CsvDecoder{ColumnMap: columnMap}
+		decoder := &importutil.SuffixDecoder{
+			Default:  &importutil.JsonYamlDecoder{},
+			Decoders: map[string]importutil.RecordDecoder{".csv": csvDecoder, ".tsv": csvDecoder},
+		}
+		return importutil.NewRecordReader(o.Filename, decoder, "*.json", "*.yaml", "*.yml", "*.csv", "*.tsv")
+	}
+
+	entityLabels, err := importutil.ParseLabels(o.EntityLabels)
+	if err != nil {
+		return nil, err
+	}
+	seedLabels, err := importutil.ParseLabels(o.SeedLabels)
+	if err != nil {
+		return nil, err
+	}
+
+	extractor := &importutil.UriExtractor{Client: importutil.NewHttpClient(o.FetchTimeout, true)}
+
+	var uris []string
+	switch {
+	case o.FromSitemap != "":
+		uris, err = extractor.Sitemap(source)
+	case o.FromFeed != "":
+		uris, err = extractor.Feed(source)
+	default:
+		uris, err = extractor.Html(source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log.Info().Str("source", source).Int("uris", len(uris)).Msg("Extracted URIs")
+
+	return importutil.NewSeedUriReader(source, uris, importutil.SeedDesc{
+		EntityId:    o.EntityId,
+		EntityName:  o.EntityName,
+		EntityLabel: entityLabels,
+		SeedLabel:   seedLabels,
+	}), nil
+}
+
 func run(o *options) error {
+	// Load canonicalization rules for URI keys
+	var uriRules *importutil.UriRules
+	if o.NormalizerRules != "" {
+		var err error
+		uriRules, err = importutil.LoadUriRules(o.NormalizerRules)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create record reader for input
+	rr, err := newRecordReader(o)
+	if err != nil {
+		return fmt.Errorf("failed to initialize reader: %w", err)
+	}
+
 	// Create error writer (file or stderr)
 	var errFile io.Writer
 	if o.ErrorFile == "" || o.ErrorFile == "-" {
-		errFile = os.Stderr
+		errFile = logger.Stderr
 	} else {
 		f, err := os.Create(o.ErrorFile)
 		if err != nil {
@@ -101,6 +292,19 @@ func run(o *options) error {
 		errFile = f
 	}
 
+	// Create report writer (file or stdout)
+	var report *importutil.ReportWriter
+	if o.Report == "-" {
+		report = importutil.NewReportWriter(os.Stdout)
+	} else if o.Report != "" {
+		f, err := os.Create(o.Report)
+		if err != nil {
+			return fmt.Errorf("unable to open report file '%v': %w", o.Report, err)
+		}
+		defer f.Close()
+		report = importutil.NewReportWriter(f)
+	}
+
 	// Create Veidemann config client
 	conn, err := connection.Connect()
 	if err != nil {
@@ -110,23 +314,43 @@ func run(o *options) error {
 	client := configV1.NewConfigClient(conn)
 
 	// Create/open state database for entities
-	entityDbDir := path.Join(o.DbDir, config.GetContext(), configV1.Kind_crawlEntity.String())
+	entityDbDir := importutil.StateDbDir(o.DbDir, config.GetContext(), configV1.Kind_crawlEntity.String())
 	entityDb, err := importutil.NewImportDb(entityDbDir, o.Truncate)
 	if err != nil {
 		return fmt.Errorf("failed to initialize entity state db: %w", err)
 	}
 	defer entityDb.Close()
 
-	uriNormalizer := &importutil.UriKeyNormalizer{IgnoreScheme: o.IgnoreScheme, Toplevel: o.Toplevel}
+	uriNormalizer := &importutil.UriKeyNormalizer{IgnoreScheme: o.IgnoreScheme, Toplevel: o.Toplevel, Rules: uriRules}
 
 	// Create/open state database for seeds
-	seedDbDir := path.Join(o.DbDir, config.GetContext(), configV1.Kind_seed.String())
+	seedDbDir := importutil.StateDbDir(o.DbDir, config.GetContext(), configV1.Kind_seed.String())
 	seedDb, err := importutil.NewImportDb(seedDbDir, o.Truncate)
 	if err != nil {
 		return fmt.Errorf("failed to initialize seed state db: %w", err)
 	}
 	defer seedDb.Close()
 
+	// Complete or roll back seeds and entities left half-created by an earlier run
+	intentLog := &importutil.IntentLog{Client: client, EntityDb: entityDb, SeedDb: seedDb}
+	if o.DryRun {
+		pending, err := intentLog.Pending()
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			log.Warn().Int("intents", len(pending)).Msg("Unfinished seed creations from an earlier run are replayed when not in dry run")
+		}
+	} else {
+		completed, rolledBack, err := intentLog.Replay()
+		if err != nil {
+			return fmt.Errorf("failed to replay intent log: %w", err)
+		}
+		if completed+rolledBack > 0 {
+			log.Info().Int("completed", completed).Int("rolledBack", rolledBack).Msg("Replayed intent log")
+		}
+	}
+
 	if !o.SkipImport {
 		// Import entities
 		err = importutil.ImportExisting(entityDb, client, configV1.Kind_crawlEntity, nil)
@@ -141,133 +365,118 @@ func run(o *options) error {
 		}
 	}
 
-	// Create Record reader for file input
-	rr, err := importutil.NewRecordReader(o.Filename, &importutil.JsonYamlDecoder{}, "*.json")
-	if err != nil {
-		return fmt.Errorf("failed to initialize reader: %w", err)
+	// Keep track of processed records (not in dry run since nothing is written to Veidemann, and not when
+	// retrying since records are not processed in input order)
+	var checkpoint *importutil.Checkpoint
+	if !o.DryRun && o.RetryFrom == "" {
+		checkpoint, err = importutil.NewCheckpoint(seedDb, o.Resume)
+		if err != nil {
+			return err
+		}
 	}
 
 	var uriChecker *importutil.UriChecker
 	if o.CheckUri {
 		uriChecker = &importutil.UriChecker{
-			Client: importutil.NewHttpClient(o.CheckUriTimeout, false),
+			Client:        importutil.NewHttpClient(o.CheckUriTimeout, false),
+			Limiter:       importutil.NewRequestLimiter(o.CheckUriRate, o.CheckUriHostRate),
+			MaxRetries:    o.CheckUriRetries,
+			MaxRetryAfter: o.CheckUriMaxRetryAfter,
+			DetectSoft404: o.CheckUriSoft404,
 		}
 	}
-
-	crawlJobRef := []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: o.CrawlJobId}}
-
-	var m sync.Mutex
+	acceptPolicy, err := importutil.ParseAcceptPolicy(o.Accept)
+	if err != nil {
+		return err
+	}
 
 	// Create error logger
 	errorLog := log.Output(zerolog.ConsoleWriter{Out: errFile, TimeFormat: time.RFC3339})
 
-	// Create processor function for each record in input file
-	proc := func(sd *importutil.SeedDesc) error {
-		if o.CrawlJobId != "" {
-			sd.CrawlJobRef = crawlJobRef
-		}
+	imp := &importer{
+		client:       client,
+		entityDb:     entityDb,
+		seedDb:       seedDb,
+		intentLog:    intentLog,
+		normalizer:   uriNormalizer,
+		uriChecker:   uriChecker,
+		acceptPolicy: acceptPolicy,
+		onExisting:   o.OnExisting,
+		dryRun:       o.DryRun,
+		locks:        &importutil.KeyLocks{},
+		log:          errorLog,
+	}
+	if o.CrawlJobId != "" {
+		imp.crawlJobRef = []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: o.CrawlJobId}}
+	}
 
-		if uriChecker != nil {
-			// check liveness of uri and follow permanent redirects
-			uri, err := uriChecker.Check(sd.Uri)
-			if err != nil {
-				return err
-			}
-			sd.Uri = uri
-		}
+	errHandler := func(state importutil.Job[*record]) {
+		l := errorLog.With().
+			Str("uri", state.Val.Uri).
+			Str("filename", state.GetFilename()).
+			Int("recNum", state.GetRecordNum()).Logger()
 
-		normalizedUri, err := uriNormalizer.Normalize(sd.Uri)
-		if err != nil {
-			return fmt.Errorf("failed to normalize URL '%s': %w", sd.Uri, err)
+		var err importutil.ErrAlreadyExists
+		var uriErr importutil.ErrUriCheck
+		if errors.As(state.GetError(), &err) {
+			l.Warn().Msgf("Skipping: %v", err.Error())
+		} else if errors.As(state.GetError(), &uriErr) {
+			l.Warn().Interface("uriCheck", uriErr.Result).Msg("Rejected by uri check")
+		} else {
+			l.Error().Err(state.GetError()).Msg("")
 		}
+	}
 
-		// Ensure every concurrent process can see the same state by locking
-		// while checking and updating state database and Veidemann.
-		m.Lock()
-		defer m.Unlock()
-
-		// Check if seed already exists in state database
-		seedIds, err := seedDb.Get(normalizedUri)
-		if err != nil {
-			return err
-		} else if len(seedIds) > 0 {
-			return importutil.ErrAlreadyExists(normalizedUri)
+	// writeReport writes the result of a record to the report
+	writeReport := func(state *importutil.State, r *record) {
+		if report == nil {
+			return
 		}
-
-		if o.DryRun {
-			return nil
+		rec := importutil.RecordReport{
+			Filename:  state.GetFilename(),
+			RecordNum: state.GetRecordNum(),
+			Outcome:   importutil.OutcomeError,
 		}
-
-		var entity *configV1.ConfigObject
-
-		if sd.EntityId == "" {
-			entityIds, err := entityDb.Get(sd.EntityName)
-			if err != nil {
-				return fmt.Errorf("failed to get entity: %w", err)
-			}
-
-			if len(entityIds) > 0 {
-				sd.EntityId = entityIds[0]
-			} else {
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer cancel()
-
-				entity, err = client.SaveConfigObject(ctx, sd.ToEntity())
-				if err != nil {
-					return fmt.Errorf("failed to create entity in Veidemann: %w", err)
-				}
-
-				_, _, err := entityDb.Set(sd.EntityName, entity.Id)
-				if err != nil {
-					return fmt.Errorf("failed to save new entity to import db: %w", err)
-				}
-
-				sd.EntityId = entity.Id
-				errorLog.Info().Str("entityId", entity.Id).Str("entityName", entity.Meta.Name).Msg("Created new entity in Veidemann")
-			}
+		if r != nil {
+			rec.Uri = r.inputUri
+			rec.Key = r.key
+			rec.Outcome = r.outcome
+			rec.SeedId = r.seedId
+			rec.EntityId = r.entityId
 		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		seed, err := client.SaveConfigObject(ctx, sd.ToSeed())
-		if err != nil {
-			if entity != nil { // Delete created entity if seed creation failed
-				if _, err := client.DeleteConfigObject(ctx, entity); err != nil {
-					errorLog.Error().Err(err).
-						Str("uri", sd.Uri).
-						Str("entityId", entity.Id).
-						Str("entityName", entity.Meta.Name).
-						Msg("Failed to delete new entity from Veidemann after seed creation error")
-				}
+		if err := state.GetError(); err != nil {
+			rec.SetError(err)
+			if r != nil {
+				rec.Record = r.input
 			}
-			return fmt.Errorf("failed to create seed in Veidemann: %w", err)
 		}
-		errorLog.Info().Str("key", normalizedUri).Str("seedId", seed.Id).Str("uri", sd.Uri).Msg("Created new seed in Veidemann")
-
-		_, _, err = seedDb.Set(normalizedUri, seed.Id)
-		if err != nil {
-			return fmt.Errorf("failed to save new seed to import db: %w", err)
+		if err := report.Write(rec); err != nil {
+			errorLog.Error().Err(err).Str("filename", state.GetFilename()).Int("recNum", state.GetRecordNum()).Msg("Failed to write report")
 		}
+	}
 
-		return nil
+	doneHandler := func(job importutil.Job[*record]) {
+		writeReport(job.State, job.Val)
+		if checkpoint == nil {
+			return
+		}
+		if err := checkpoint.Done(job.State); err != nil {
+			errorLog.Error().Err(err).Str("filename", job.GetFilename()).Int("recNum", job.GetRecordNum()).Msg("Failed to store checkpoint")
+		}
 	}
 
-	errHandler := func(state importutil.Job[*importutil.SeedDesc]) {
-		l := errorLog.With().
-			Str("uri", state.Val.Uri).
-			Str("filename", state.GetFilename()).
-			Int("recNum", state.GetRecordNum()).Logger()
+	executor := importutil.NewExecutorWithDone(o.Concurrency, imp.importSeed, errHandler, doneHandler)
 
-		var err importutil.ErrAlreadyExists
-		if errors.As(state.GetError(), &err) {
-			l.Warn().Msgf("Skipping: %v", err.Error())
-		} else {
-			l.Error().Err(state.GetError()).Msg("")
-		}
+	// Report progress while importing
+	progress := importutil.NewProgress("import seed")
+	if input, ok := rr.(importutil.InputProgress); ok {
+		progress.SetInput(input)
 	}
+	progress.SetStats(executor.Stats)
+	progress.Start()
+	defer progress.Stop()
 
-	executor := importutil.NewExecutor(o.Concurrency, proc, errHandler)
+	var skipped int
 
 	// Process each record in input file and add to import db if not already present
 	for {
@@ -280,12 +489,49 @@ func run(o *options) error {
 			errorLog.Error().Err(err).Msgf("error decoding record: %v", state)
 			continue
 		}
-		executor.Queue <- importutil.Job[*importutil.SeedDesc]{State: state, Val: &sd}
+		progress.Read(state)
+		if state.GetError() != nil {
+			errorLog.Error().Err(state.GetError()).Str("filename", state.GetFilename()).Int("recNum", state.GetRecordNum()).Msg("Failed to decode record")
+			writeReport(state, nil)
+			if checkpoint != nil {
+				_ = checkpoint.Done(state)
+			}
+			continue
+		}
+		if o.Resume && checkpoint != nil {
+			processed, err := checkpoint.Processed(state)
+			if err != nil {
+				errorLog.Error().Err(err).Msg("Failed to read checkpoint")
+			} else if processed {
+				skipped++
+				continue
+			}
+		}
+		r := &record{SeedDesc: &sd}
+		if report != nil {
+			// Save the record before it is modified by the import
+			r.input, _ = json.Marshal(&sd)
+		}
+		executor.Queue <- importutil.Job[*record]{State: state, Val: r}
 	}
 
 	count, success, failed := executor.Wait()
+	progress.Stop()
+
+	if retryReader, ok := rr.(*importutil.RetryReader); ok {
+		_ = retryReader.Close()
+		if retryReader.Unavailable > 0 {
+			errorLog.Warn().Int("records", retryReader.Unavailable).Msg("Failed records without a saved record in the report were not retried")
+		}
+	}
+
+	errorLog.Info().Int("processed", count).Int("imported", success).Int("errors", failed).Int("skipped", skipped).Msg("Import completed")
 
-	errorLog.Info().Int("processed", count).Int("imported", success).Int("errors", failed).Msg("Import completed")
+	if report != nil {
+		if err := report.WriteSummary(o.DryRun); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
 
 	return err
 }
@@ -16,15 +16,24 @@ package list
 import (
 	"context"
 	"fmt"
+	"os"
 
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
 	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/nlnwa/veidemannctl/format"
 	"github.com/spf13/cobra"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 )
 
+type options struct {
+	format     string
+	goTemplate string
+}
+
 func NewCmd() *cobra.Command {
-	return &cobra.Command{
+	o := &options{}
+
+	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List configured loggers",
 		Long:  `List configured loggers.`,
@@ -43,11 +52,18 @@ func NewCmd() *cobra.Command {
 				return fmt.Errorf("could not get log config: %w", err)
 			}
 
-			fmt.Printf("%-45s %s\n", "LOGGER", "LEVEL")
-			for _, l := range r.LogLevel {
-				fmt.Printf("%-45s %s\n", l.Logger, l.Level)
+			s, err := format.NewFormatter("LogLevels", os.Stdout, o.format, o.goTemplate)
+			if err != nil {
+				return fmt.Errorf("error creating formatter: %w", err)
 			}
-			return nil
+			defer s.Close()
+
+			return s.WriteRecord(r)
 		},
 	}
+
+	cmd.Flags().StringVarP(&o.format, "output", "o", "table", "Output format (table|json|yaml|template|template-file)")
+	cmd.Flags().StringVarP(&o.goTemplate, "template", "t", "", "A Go template used to format the output")
+
+	return cmd
 }
@@ -15,30 +15,162 @@ package pause
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
+	"github.com/nlnwa/veidemannctl/apiutil"
+	"github.com/nlnwa/veidemannctl/config"
 	"github.com/nlnwa/veidemannctl/connection"
 	"github.com/spf13/cobra"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 )
 
+type options struct {
+	reason   string
+	duration time.Duration
+	resumeAt string
+	timeout  time.Duration
+}
+
 func NewCmd() *cobra.Command {
-	return &cobra.Command{
-		GroupID:      "status",
-		Use:          "pause",
-		Short:        "Request crawler to pause",
-		SilenceUsage: true,
+	o := &options{}
+
+	cmd := &cobra.Command{
+		GroupID: "status",
+		Use:     "pause",
+		Short:   "Request crawler to pause",
+		Long: `Request crawler to pause and wait until the crawler reports that it is paused.
+
+The reason and the planned resume time are recorded locally for the current context and
+shown by the status command until the crawler is unpaused.
+
+If --resume-at is given the command stays in the foreground and unpauses the crawler at the given time.`,
+		Example: `# Pause crawler for a maintenance window
+veidemannctl pause --for 2h --reason "db upgrade"
+
+# Pause crawler and unpause it at 06:00
+veidemannctl pause --resume-at 06:00 --reason "db upgrade"`,
+		Args: cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			conn, err := connection.Connect()
-			if err != nil {
-				return err
+			if o.duration < 0 {
+				return fmt.Errorf("duration must not be negative: %v", o.duration)
+			}
+
+			var resumeAt time.Time
+			if o.resumeAt != "" {
+				var err error
+				resumeAt, err = parseResumeAt(o.resumeAt, time.Now())
+				if err != nil {
+					return err
+				}
+			} else if o.duration > 0 {
+				resumeAt = time.Now().Add(o.duration)
 			}
-			defer conn.Close()
 
-			client := controllerV1.NewControllerClient(conn)
+			cmd.SilenceUsage = true
 
-			_, err = client.PauseCrawler(context.Background(), &empty.Empty{})
-			return err
+			return run(o, resumeAt)
 		},
 	}
+
+	cmd.Flags().StringVar(&o.reason, "reason", "", "Reason for pausing the crawler")
+	cmd.Flags().DurationVar(&o.duration, "for", 0, "Planned duration of the pause")
+	cmd.Flags().StringVar(&o.resumeAt, "resume-at", "", "Stay in the foreground and unpause the crawler at the given time (RFC3339 or HH:MM)")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", time.Minute, "Maximum time to wait for the crawler to report a new run status")
+	cmd.MarkFlagsMutuallyExclusive("for", "resume-at")
+
+	return cmd
+}
+
+func run(o *options, resumeAt time.Time) error {
+	conn, err := connection.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	client := controllerV1.NewControllerClient(conn)
+
+	if _, err := client.PauseCrawler(context.Background(), &empty.Empty{}); err != nil {
+		return fmt.Errorf("failed to pause crawler: %w", err)
+	}
+	if err := waitFor(client, controllerV1.RunStatus_PAUSED, o.timeout); err != nil {
+		return err
+	}
+
+	err = config.SetPauseState(&config.PauseState{
+		Reason:   o.reason,
+		PausedAt: time.Now(),
+		ResumeAt: resumeAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	if resumeAt.IsZero() {
+		fmt.Println("Crawler paused")
+		return nil
+	}
+	fmt.Printf("Crawler paused until %s\n", resumeAt.Local().Format(time.RFC3339))
+
+	if o.resumeAt == "" {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	timer := time.NewTimer(time.Until(resumeAt))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return errors.New("interrupted, crawler is still paused")
+	case <-timer.C:
+	}
+
+	if _, err := client.UnPauseCrawler(context.Background(), &empty.Empty{}); err != nil {
+		return fmt.Errorf("failed to unpause crawler: %w", err)
+	}
+	if err := waitFor(client, controllerV1.RunStatus_RUNNING, o.timeout); err != nil {
+		return err
+	}
+	if err := config.ClearPauseState(); err != nil {
+		return err
+	}
+	fmt.Println("Crawler unpaused")
+
+	return nil
+}
+
+// waitFor waits until the crawler reports the wanted run status or the timeout expires.
+func waitFor(client controllerV1.ControllerClient, want controllerV1.RunStatus, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return apiutil.WaitForRunStatus(ctx, client, want, time.Second)
+}
+
+// parseResumeAt parses a resume time given either as RFC3339 or as HH:MM.
+// A time of day is resolved to the next occurrence after now.
+func parseResumeAt(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		if !t.After(now) {
+			return time.Time{}, fmt.Errorf("resume time is in the past: %s", s)
+		}
+		return t, nil
+	}
+	clock, err := time.ParseInLocation("15:04", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid resume time, expected RFC3339 or HH:MM: %s", s)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
 }
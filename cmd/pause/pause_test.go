@@ -0,0 +1,35 @@
+package pause
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseResumeAt(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"rfc3339", "2024-03-02T06:00:00Z", time.Date(2024, 3, 2, 6, 0, 0, 0, time.UTC), false},
+		{"rfc3339 in the past", "2024-03-01T06:00:00Z", time.Time{}, true},
+		{"later today", "18:30", time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC), false},
+		{"tomorrow", "06:00", time.Date(2024, 3, 2, 6, 0, 0, 0, time.UTC), false},
+		{"now is tomorrow", "12:00", time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC), false},
+		{"invalid", "tomorrow", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseResumeAt(tt.s, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResumeAt() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseResumeAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
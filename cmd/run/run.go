@@ -15,54 +15,171 @@ package run
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"time"
 
 	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
-
+	frontierV1 "github.com/nlnwa/veidemann-api/go/frontier/v1"
+	reportV1 "github.com/nlnwa/veidemann-api/go/report/v1"
 	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/nlnwa/veidemannctl/format"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	empty "google.golang.org/protobuf/types/known/emptypb"
 )
 
+type options struct {
+	jobId   string
+	seedId  string
+	wait    bool
+	timeout time.Duration
+}
+
 func NewCmd() *cobra.Command {
-	return &cobra.Command{
+	o := &options{}
+
+	cmd := &cobra.Command{
 		GroupID: "run",
 		Use:     "run JOB-ID [SEED-ID]",
 		Short:   "Run a crawl job",
 		Long: `Run a crawl job.
-		
+
 If a seed is provided, the job will be created and started with the seed only.
-If the job is already running, the seed will be added to the running job.`,
+If the job is already running, the seed will be added to the running job.
+
+If --wait is given the command will follow the job execution until it completes,
+exiting with a non-zero code if the job execution fails, is aborted or the timeout expires.`,
 		Args: cobra.RangeArgs(1, 2),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			o.jobId = args[0]
+			if len(args) == 2 {
+				o.seedId = args[1]
+			}
+
 			cmd.SilenceUsage = true
 
-			conn, err := connection.Connect()
-			if err != nil {
-				return fmt.Errorf("failed to connect")
-			}
-			defer conn.Close()
-
-			client := controllerV1.NewControllerClient(conn)
-
-			switch len(args) {
-			case 1: // One argument (only jobId)
-				request := controllerV1.RunCrawlRequest{JobId: args[0]}
-				r, err := client.RunCrawl(context.Background(), &request)
-				if err != nil {
-					return fmt.Errorf("could not run job: %w", err)
-				}
-
-				fmt.Printf("Job Execution ID: %v\n", r.GetJobExecutionId())
-			case 2: // Two arguments (jobId and seedId)
-				request := controllerV1.RunCrawlRequest{JobId: args[0], SeedId: args[1]}
-				r, err := client.RunCrawl(context.Background(), &request)
-				if err != nil {
-					return fmt.Errorf("could not run job: %w", err)
-				}
-
-				fmt.Printf("Job Execution ID: %v\n", r.GetJobExecutionId())
-			}
-			return nil
+			return run(o)
 		},
 	}
+
+	cmd.Flags().BoolVarP(&o.wait, "wait", "w", false, "Wait for the job execution to complete")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", 0, "Maximum time to wait for the job execution to complete (0 means no timeout)")
+
+	return cmd
+}
+
+func run(o *options) error {
+	conn, err := connection.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect")
+	}
+	defer conn.Close()
+
+	client := controllerV1.NewControllerClient(conn)
+
+	request := controllerV1.RunCrawlRequest{JobId: o.jobId, SeedId: o.seedId}
+	r, err := client.RunCrawl(context.Background(), &request)
+	if err != nil {
+		return fmt.Errorf("could not run job: %w", err)
+	}
+
+	fmt.Printf("Job Execution ID: %v\n", r.GetJobExecutionId())
+
+	if !o.wait {
+		return nil
+	}
+	return wait(conn, r.GetJobExecutionId(), o.timeout)
+}
+
+// wait follows the job execution with the given id until it reaches a final state or the timeout expires.
+// A progress line is continuously written to stderr.
+func wait(conn *grpc.ClientConn, jobExecutionId string, timeout time.Duration) error {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	reportClient := reportV1.NewReportClient(conn)
+	controllerClient := controllerV1.NewControllerClient(conn)
+
+	request := &reportV1.JobExecutionsListRequest{
+		Id:    []string{jobExecutionId},
+		Watch: true,
+	}
+	stream, err := reportClient.ListJobExecutions(ctx, request)
+	if err != nil {
+		return waitError(ctx, jobExecutionId, timeout, err)
+	}
+
+	for {
+		jes, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("job execution '%s' stopped reporting status before completing", jobExecutionId)
+		}
+		if err != nil {
+			return waitError(ctx, jobExecutionId, timeout, err)
+		}
+
+		// queue size is only available for the crawler as a whole
+		var queueSize int64 = -1
+		if crawlerStatus, err := controllerClient.Status(ctx, &empty.Empty{}); err == nil {
+			queueSize = crawlerStatus.GetQueueSize()
+		}
+
+		// overwrite the previous progress line
+		_, _ = fmt.Fprintf(os.Stderr, "\r\033[K%s", progress(jes, queueSize))
+
+		if done, err := finalState(jes); done {
+			_, _ = fmt.Fprintln(os.Stderr)
+			return err
+		}
+	}
+}
+
+// waitError converts an error from waiting on a job execution into a user-friendly error.
+func waitError(ctx context.Context, jobExecutionId string, timeout time.Duration, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded {
+		_, _ = fmt.Fprintln(os.Stderr)
+		return fmt.Errorf("timed out after %v waiting for job execution '%s' to complete", timeout, jobExecutionId)
+	}
+	return fmt.Errorf("failed to get status of job execution '%s': %w", jobExecutionId, err)
+}
+
+// finalState returns true if the job execution has reached a final state.
+// The returned error is non-nil if the final state is anything other than FINISHED.
+func finalState(jes *frontierV1.JobExecutionStatus) (bool, error) {
+	switch jes.GetState() {
+	case frontierV1.JobExecutionStatus_FINISHED:
+		return true, nil
+	case frontierV1.JobExecutionStatus_FAILED,
+		frontierV1.JobExecutionStatus_DIED,
+		frontierV1.JobExecutionStatus_ABORTED_MANUAL:
+		if e := jes.GetError(); e != nil {
+			return true, fmt.Errorf("job execution '%s' ended in state %s: %s", jes.GetId(), jes.GetState(), e.GetMsg())
+		}
+		return true, fmt.Errorf("job execution '%s' ended in state %s", jes.GetId(), jes.GetState())
+	default:
+		return false, nil
+	}
+}
+
+// progress returns a single line describing the progress of a job execution.
+// The queue size is that of the crawler as a whole, since the job execution does not report its own.
+// A negative queue size is printed as unknown.
+func progress(jes *frontierV1.JobExecutionStatus, queueSize int64) string {
+	queued := "?"
+	if queueSize >= 0 {
+		queued = fmt.Sprintf("%d", queueSize)
+	}
+	return fmt.Sprintf("%-15s Docs: %d  Bytes: %s  Crawler queue (all jobs): %s  Failed: %d",
+		jes.GetState(), jes.GetDocumentsCrawled(), format.Bytes(jes.GetBytesCrawled()), queued, jes.GetDocumentsFailed())
 }
@@ -0,0 +1,64 @@
+// Copyright © 2017 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package run
+
+import (
+	"testing"
+
+	commonsV1 "github.com/nlnwa/veidemann-api/go/commons/v1"
+	frontierV1 "github.com/nlnwa/veidemann-api/go/frontier/v1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFinalState(t *testing.T) {
+	tests := []struct {
+		name     string
+		jes      *frontierV1.JobExecutionStatus
+		wantDone bool
+		wantErr  bool
+	}{
+		{"created", &frontierV1.JobExecutionStatus{State: frontierV1.JobExecutionStatus_CREATED}, false, false},
+		{"running", &frontierV1.JobExecutionStatus{State: frontierV1.JobExecutionStatus_RUNNING}, false, false},
+		{"finished", &frontierV1.JobExecutionStatus{State: frontierV1.JobExecutionStatus_FINISHED}, true, false},
+		{"failed", &frontierV1.JobExecutionStatus{State: frontierV1.JobExecutionStatus_FAILED}, true, true},
+		{"failed with error", &frontierV1.JobExecutionStatus{
+			State: frontierV1.JobExecutionStatus_FAILED,
+			Error: &commonsV1.Error{Msg: "boom"},
+		}, true, true},
+		{"aborted", &frontierV1.JobExecutionStatus{State: frontierV1.JobExecutionStatus_ABORTED_MANUAL}, true, true},
+		{"died", &frontierV1.JobExecutionStatus{State: frontierV1.JobExecutionStatus_DIED}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done, err := finalState(tt.jes)
+			assert.Equal(t, tt.wantDone, done)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestProgress(t *testing.T) {
+	jes := &frontierV1.JobExecutionStatus{
+		State:            frontierV1.JobExecutionStatus_RUNNING,
+		DocumentsCrawled: 42,
+		BytesCrawled:     3 * 1024 * 1024,
+		DocumentsFailed:  2,
+	}
+	assert.Equal(t, "RUNNING         Docs: 42  Bytes: 3.0 MiB  Crawler queue (all jobs): 7  Failed: 2", progress(jes, 7))
+	assert.Equal(t, "RUNNING         Docs: 42  Bytes: 3.0 MiB  Crawler queue (all jobs): ?  Failed: 2", progress(jes, -1))
+}
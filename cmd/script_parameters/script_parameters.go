@@ -16,15 +16,24 @@ package scriptparameters
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/nlnwa/veidemann-api/go/config/v1"
 	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/nlnwa/veidemannctl/format"
 	"github.com/spf13/cobra"
 )
 
+type options struct {
+	format     string
+	goTemplate string
+}
+
 func NewCmd() *cobra.Command {
-	// scriptParametersCmd represents the script-parameters command
-	return &cobra.Command{
+	o := &options{}
+
+	// cmd represents the script-parameters command
+	cmd := &cobra.Command{
 		GroupID: "debug",
 		Use:     "script-parameters JOB-ID [SEED-ID]",
 		Short:   "Get the effective script parameters for a crawl job",
@@ -63,10 +72,18 @@ Examples:
 				return fmt.Errorf("failed getting parameters for %v: %w", args[0], err)
 			}
 
-			for _, a := range response.GetAnnotation() {
-				fmt.Printf("Param: %s = '%s'\n", a.Key, a.Value)
+			s, err := format.NewFormatter("GetScriptAnnotationsResponse", os.Stdout, o.format, o.goTemplate)
+			if err != nil {
+				return fmt.Errorf("error creating formatter: %w", err)
 			}
-			return nil
+			defer s.Close()
+
+			return s.WriteRecord(response)
 		},
 	}
+
+	cmd.Flags().StringVarP(&o.format, "output", "o", "table", "Output format (table|json|yaml|template|template-file)")
+	cmd.Flags().StringVarP(&o.goTemplate, "template", "t", "", "A Go template used to format the output")
+
+	return cmd
 }
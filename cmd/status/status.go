@@ -16,15 +16,27 @@ package status
 import (
 	"context"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/nlnwa/veidemann-api/go/controller/v1"
+	"github.com/nlnwa/veidemannctl/config"
 	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/nlnwa/veidemannctl/format"
 	"github.com/spf13/cobra"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 )
 
+type options struct {
+	format     string
+	goTemplate string
+}
+
 func NewCmd() *cobra.Command {
-	return &cobra.Command{
+	o := &options{}
+
+	cmd := &cobra.Command{
 		GroupID:      "status",
 		Use:          "status",
 		Short:        "Display crawler status",
@@ -43,9 +55,46 @@ func NewCmd() *cobra.Command {
 			if err != nil {
 				return fmt.Errorf("failed to get crawler status: %w", err)
 			}
-			fmt.Printf("Status: %v, Url queue size: %v, Busy crawl host groups: %v\n",
-				crawlerStatus.RunStatus, crawlerStatus.QueueSize, crawlerStatus.BusyCrawlHostGroupCount)
+
+			s, err := format.NewFormatter("CrawlerStatus", os.Stdout, o.format, o.goTemplate)
+			if err != nil {
+				return fmt.Errorf("error creating formatter: %w", err)
+			}
+			if err := s.WriteRecord(crawlerStatus); err != nil {
+				_ = s.Close()
+				return err
+			}
+			if err := s.Close(); err != nil {
+				return err
+			}
+
+			// show why the crawler was paused if recorded by the pause command
+			if o.format != "table" || crawlerStatus.GetRunStatus() != controller.RunStatus_PAUSED {
+				return nil
+			}
+			state, err := config.GetPauseState()
+			if err != nil || state == nil {
+				return err
+			}
+			fmt.Println(pauseInfo(state))
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVarP(&o.format, "output", "o", "table", "Output format (table|json|yaml|template|template-file)")
+	cmd.Flags().StringVarP(&o.goTemplate, "template", "t", "", "A Go template used to format the output")
+
+	return cmd
+}
+
+// pauseInfo returns a line describing a recorded pause.
+func pauseInfo(state *config.PauseState) string {
+	info := []string{"Paused at: " + state.PausedAt.Local().Format(time.RFC3339)}
+	if state.Reason != "" {
+		info = append(info, "Reason: "+state.Reason)
+	}
+	if !state.ResumeAt.IsZero() {
+		info = append(info, "Planned resume: "+state.ResumeAt.Local().Format(time.RFC3339))
+	}
+	return strings.Join(info, ", ")
 }
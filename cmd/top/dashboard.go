@@ -0,0 +1,303 @@
+// Copyright © 2017 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
+	frontierV1 "github.com/nlnwa/veidemann-api/go/frontier/v1"
+	"github.com/nlnwa/veidemannctl/format"
+)
+
+const (
+	esc     = "\x1b"
+	reset   = esc + "[0m"
+	bold    = esc + "[1m"
+	inverse = esc + "[7m"
+	red     = esc + "[31m"
+	green   = esc + "[32m"
+	yellow  = esc + "[33m"
+	clear   = esc + "[H" + esc + "[2J"
+)
+
+// snapshot is the state of the crawler at a point in time.
+type snapshot struct {
+	time            time.Time
+	status          *controllerV1.CrawlerStatus
+	jobExecutions   []*frontierV1.JobExecutionStatus
+	crawlExecutions []*frontierV1.CrawlExecutionStatus
+}
+
+// history holds throughput samples derived from successive snapshots.
+type history struct {
+	size  int
+	docs  []float64
+	bytes []float64
+	queue []float64
+}
+
+// add appends samples derived from the previous and the current snapshot.
+//
+// Throughput is calculated from the difference in documents and bytes crawled by job executions
+// that are present in both snapshots, to avoid spikes when job executions start or end.
+func (h *history) add(prev *snapshot, cur *snapshot) {
+	h.queue = h.push(h.queue, float64(cur.status.GetQueueSize()))
+
+	if prev == nil {
+		return
+	}
+	seconds := cur.time.Sub(prev.time).Seconds()
+	if seconds <= 0 {
+		return
+	}
+
+	previous := make(map[string]*frontierV1.JobExecutionStatus, len(prev.jobExecutions))
+	for _, jes := range prev.jobExecutions {
+		previous[jes.GetId()] = jes
+	}
+
+	var docs, bytes int64
+	for _, jes := range cur.jobExecutions {
+		p, ok := previous[jes.GetId()]
+		if !ok {
+			continue
+		}
+		if d := jes.GetDocumentsCrawled() - p.GetDocumentsCrawled(); d > 0 {
+			docs += d
+		}
+		if b := jes.GetBytesCrawled() - p.GetBytesCrawled(); b > 0 {
+			bytes += b
+		}
+	}
+	h.docs = h.push(h.docs, float64(docs)/seconds)
+	h.bytes = h.push(h.bytes, float64(bytes)/seconds)
+}
+
+// push appends v to samples and drops the oldest samples exceeding the history size.
+func (h *history) push(samples []float64, v float64) []float64 {
+	samples = append(samples, v)
+	if len(samples) > h.size {
+		samples = samples[len(samples)-h.size:]
+	}
+	return samples
+}
+
+// last returns the last sample or 0 if there are no samples.
+func last(samples []float64) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	return samples[len(samples)-1]
+}
+
+// sparkTicks are the characters used to draw sparklines, from lowest to highest.
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders the last width samples as a sparkline scaled to the largest sample.
+func sparkline(samples []float64, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	if len(samples) > width {
+		samples = samples[len(samples)-width:]
+	}
+	var max float64
+	for _, v := range samples {
+		if v > max {
+			max = v
+		}
+	}
+	var b strings.Builder
+	for _, v := range samples {
+		i := 0
+		if max > 0 && v > 0 {
+			i = int(v / max * float64(len(sparkTicks)-1))
+		}
+		b.WriteRune(sparkTicks[i])
+	}
+	return b.String()
+}
+
+// execution identifies a job execution or a crawl execution that can be selected in the dashboard.
+type execution struct {
+	id  string
+	job bool
+}
+
+// dashboard holds the state of the dashboard.
+type dashboard struct {
+	current  *snapshot
+	history  history
+	selected int
+	// pendingAbort is the execution the user has requested to abort while confirmation is pending.
+	pendingAbort *execution
+	// message is shown at the bottom of the dashboard.
+	message string
+	// err is the error from the last refresh, if any.
+	err error
+}
+
+func newDashboard(historySize int) *dashboard {
+	return &dashboard{history: history{size: historySize}}
+}
+
+// update replaces the current snapshot and records throughput samples.
+func (d *dashboard) update(s *snapshot) {
+	d.history.add(d.current, s)
+	d.current = s
+	d.err = nil
+	if n := len(d.executions()); d.selected >= n {
+		d.selected = n - 1
+	}
+	if d.selected < 0 {
+		d.selected = 0
+	}
+}
+
+// executions returns the selectable executions: running job executions followed by fetching crawl executions.
+func (d *dashboard) executions() []execution {
+	if d.current == nil {
+		return nil
+	}
+	var e []execution
+	for _, jes := range d.current.jobExecutions {
+		e = append(e, execution{id: jes.GetId(), job: true})
+	}
+	for _, ces := range d.current.crawlExecutions {
+		e = append(e, execution{id: ces.GetId()})
+	}
+	return e
+}
+
+// selection returns the selected execution.
+func (d *dashboard) selection() (execution, bool) {
+	e := d.executions()
+	if d.selected < 0 || d.selected >= len(e) {
+		return execution{}, false
+	}
+	return e[d.selected], true
+}
+
+// requestAbort asks for confirmation to abort the selected execution. The execution is kept until the
+// request is answered, so refreshes can not change what is aborted.
+func (d *dashboard) requestAbort() {
+	if e, ok := d.selection(); ok {
+		d.pendingAbort = &e
+	}
+}
+
+// move moves the selection by delta.
+func (d *dashboard) move(delta int) {
+	n := len(d.executions())
+	d.selected += delta
+	if d.selected >= n {
+		d.selected = n - 1
+	}
+	if d.selected < 0 {
+		d.selected = 0
+	}
+}
+
+// render writes the dashboard to w, limited to the given terminal width and height.
+func (d *dashboard) render(w io.Writer, width int, height int) error {
+	var lines []string
+	add := func(layout string, a ...any) {
+		lines = append(lines, fmt.Sprintf(layout, a...))
+	}
+
+	add("%sveidemannctl top%s - %s", bold, reset, time.Now().Format(time.RFC3339))
+	if d.current == nil {
+		add("Waiting for data...")
+	} else {
+		s := d.current.status
+		runStatus := green + s.GetRunStatus().String() + reset
+		if s.GetRunStatus() == controllerV1.RunStatus_PAUSED {
+			runStatus = yellow + s.GetRunStatus().String() + reset
+		}
+		add("Status: %s  Url queue size: %d  Busy crawl host groups: %d", runStatus, s.GetQueueSize(), s.GetBusyCrawlHostGroupCount())
+		add("")
+
+		sparkWidth := width - 32
+		add("%-14s %14s %s", "Docs/s", fmt.Sprintf("%.1f", last(d.history.docs)), sparkline(d.history.docs, sparkWidth))
+		add("%-14s %14s %s", "Bytes/s", format.Bytes(int64(last(d.history.bytes))), sparkline(d.history.bytes, sparkWidth))
+		add("%-14s %14d %s", "Queue", int64(last(d.history.queue)), sparkline(d.history.queue, sparkWidth))
+		add("")
+
+		idx := 0
+		row := func(line string) {
+			if idx == d.selected {
+				line = inverse + line + reset
+			}
+			lines = append(lines, line)
+			idx++
+		}
+
+		add("%sJob executions (%d running)%s", bold, len(d.current.jobExecutions), reset)
+		add("%-36.36s %-36.36s %8s %10s %8s %-20s", "Id", "JobId", "Docs", "Bytes", "Failed", "Start time")
+		for _, jes := range d.current.jobExecutions {
+			row(fmt.Sprintf("%-36.36s %-36.36s %8d %10s %8d %-20s", jes.GetId(), jes.GetJobId(),
+				jes.GetDocumentsCrawled(), format.Bytes(jes.GetBytesCrawled()), jes.GetDocumentsFailed(),
+				formatTime(jes.GetStartTime().AsTime())))
+		}
+		add("")
+
+		add("%sCrawl executions (%d fetching)%s", bold, len(d.current.crawlExecutions), reset)
+		add("%-36.36s %-36.36s %8s %10s %8s %-20s", "Id", "SeedId", "Docs", "Bytes", "Failed", "Start time")
+		for _, ces := range d.current.crawlExecutions {
+			row(fmt.Sprintf("%-36.36s %-36.36s %8d %10s %8d %-20s", ces.GetId(), ces.GetSeedId(),
+				ces.GetDocumentsCrawled(), format.Bytes(ces.GetBytesCrawled()), ces.GetDocumentsFailed(),
+				formatTime(ces.GetStartTime().AsTime())))
+		}
+	}
+
+	// reserve space for the footer
+	footer := []string{""}
+	if d.err != nil {
+		footer = append(footer, red+"Error: "+d.err.Error()+reset)
+	}
+	if e := d.pendingAbort; e != nil {
+		footer = append(footer, fmt.Sprintf("%sAbort %s %s? (y/n)%s", yellow, kindOf(*e), e.id, reset))
+	} else if d.message != "" {
+		footer = append(footer, d.message)
+	}
+	footer = append(footer, "q: quit  p: pause  u: unpause  ↑/↓: select  a: abort selected  r: refresh")
+
+	if max := height - len(footer); max >= 0 && len(lines) > max {
+		lines = lines[:max]
+	}
+	lines = append(lines, footer...)
+
+	_, err := io.WriteString(w, clear+strings.Join(lines, "\r\n"))
+	return err
+}
+
+// kindOf returns a human-readable kind of execution.
+func kindOf(e execution) string {
+	if e.job {
+		return "job execution"
+	}
+	return "crawl execution"
+}
+
+// formatTime formats a time for display in the dashboard.
+func formatTime(t time.Time) string {
+	if t.IsZero() || t.Unix() == 0 {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
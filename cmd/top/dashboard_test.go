@@ -0,0 +1,160 @@
+// Copyright © 2017 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
+	frontierV1 "github.com/nlnwa/veidemann-api/go/frontier/v1"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func TestSparkline(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float64
+		width   int
+		want    string
+	}{
+		{"empty", nil, 10, ""},
+		{"zero width", []float64{1, 2, 3}, 0, ""},
+		{"all zero", []float64{0, 0, 0}, 10, "▁▁▁"},
+		{"scaled", []float64{0, 7, 14}, 10, "▁▄█"},
+		{"truncated", []float64{100, 1, 2}, 2, "▄█"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sparkline(tt.samples, tt.width))
+		})
+	}
+}
+
+func TestHistoryAdd(t *testing.T) {
+	now := time.Now()
+	prev := &snapshot{
+		time:   now,
+		status: &controllerV1.CrawlerStatus{QueueSize: 10},
+		jobExecutions: []*frontierV1.JobExecutionStatus{
+			{Id: "a", DocumentsCrawled: 10, BytesCrawled: 1000},
+			{Id: "b", DocumentsCrawled: 5, BytesCrawled: 500},
+		},
+	}
+	cur := &snapshot{
+		time:   now.Add(2 * time.Second),
+		status: &controllerV1.CrawlerStatus{QueueSize: 20},
+		jobExecutions: []*frontierV1.JobExecutionStatus{
+			{Id: "a", DocumentsCrawled: 20, BytesCrawled: 3000},
+			// new job executions are not counted
+			{Id: "c", DocumentsCrawled: 100, BytesCrawled: 100000},
+		},
+	}
+
+	h := history{size: 2}
+	h.add(nil, prev)
+	assert.Equal(t, []float64{10}, h.queue)
+	assert.Empty(t, h.docs)
+
+	h.add(prev, cur)
+	assert.Equal(t, []float64{10, 20}, h.queue)
+	assert.Equal(t, []float64{5}, h.docs)
+	assert.Equal(t, []float64{1000}, h.bytes)
+
+	h.add(cur, &snapshot{time: now.Add(3 * time.Second), status: &controllerV1.CrawlerStatus{QueueSize: 30}})
+	assert.Equal(t, []float64{20, 30}, h.queue, "history should be limited to size")
+}
+
+func TestDashboardSelection(t *testing.T) {
+	d := newDashboard(10)
+	_, ok := d.selection()
+	assert.False(t, ok)
+
+	d.update(&snapshot{
+		time:            time.Now(),
+		status:          &controllerV1.CrawlerStatus{},
+		jobExecutions:   []*frontierV1.JobExecutionStatus{{Id: "job1"}},
+		crawlExecutions: []*frontierV1.CrawlExecutionStatus{{Id: "crawl1"}, {Id: "crawl2"}},
+	})
+
+	e, ok := d.selection()
+	assert.True(t, ok)
+	assert.Equal(t, execution{id: "job1", job: true}, e)
+
+	d.move(5)
+	e, _ = d.selection()
+	assert.Equal(t, execution{id: "crawl2"}, e)
+
+	// selection is kept within bounds when executions disappear
+	d.update(&snapshot{
+		time:          time.Now(),
+		status:        &controllerV1.CrawlerStatus{},
+		jobExecutions: []*frontierV1.JobExecutionStatus{{Id: "job1"}},
+	})
+	e, _ = d.selection()
+	assert.Equal(t, execution{id: "job1", job: true}, e)
+
+	var buf bytes.Buffer
+	assert.NoError(t, d.render(&buf, 120, 40))
+	assert.Contains(t, buf.String(), "job1")
+}
+
+// fakeControllerClient records aborted executions
+type fakeControllerClient struct {
+	controllerV1.ControllerClient
+	aborted []execution
+}
+
+func (c *fakeControllerClient) AbortJobExecution(_ context.Context, in *controllerV1.ExecutionId, _ ...grpc.CallOption) (*frontierV1.JobExecutionStatus, error) {
+	c.aborted = append(c.aborted, execution{id: in.GetId(), job: true})
+	return &frontierV1.JobExecutionStatus{Id: in.GetId()}, nil
+}
+
+func (c *fakeControllerClient) AbortCrawlExecution(_ context.Context, in *controllerV1.ExecutionId, _ ...grpc.CallOption) (*frontierV1.CrawlExecutionStatus, error) {
+	c.aborted = append(c.aborted, execution{id: in.GetId()})
+	return &frontierV1.CrawlExecutionStatus{Id: in.GetId()}, nil
+}
+
+func TestDashboardAbortAfterRefresh(t *testing.T) {
+	d := newDashboard(10)
+	d.update(&snapshot{
+		time:            time.Now(),
+		status:          &controllerV1.CrawlerStatus{},
+		jobExecutions:   []*frontierV1.JobExecutionStatus{{Id: "job1"}},
+		crawlExecutions: []*frontierV1.CrawlExecutionStatus{{Id: "crawl1"}, {Id: "crawl2"}},
+	})
+	d.move(1)
+	d.requestAbort()
+
+	// A refresh between 'a' and 'y' puts another execution at the selected row
+	d.update(&snapshot{
+		time:            time.Now(),
+		status:          &controllerV1.CrawlerStatus{},
+		jobExecutions:   []*frontierV1.JobExecutionStatus{{Id: "job1"}, {Id: "job2"}},
+		crawlExecutions: []*frontierV1.CrawlExecutionStatus{{Id: "crawl1"}, {Id: "crawl2"}},
+	})
+	e, _ := d.selection()
+	assert.Equal(t, execution{id: "job2", job: true}, e)
+
+	var buf bytes.Buffer
+	assert.NoError(t, d.render(&buf, 120, 40))
+	assert.Contains(t, buf.String(), "Abort crawl execution crawl1? (y/n)")
+
+	client := &fakeControllerClient{}
+	assert.Equal(t, "Aborted crawl execution crawl1", abort(client, *d.pendingAbort))
+	assert.Equal(t, []execution{{id: "crawl1"}}, client.aborted)
+}
@@ -0,0 +1,275 @@
+// Copyright © 2017 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package top
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
+	frontierV1 "github.com/nlnwa/veidemann-api/go/frontier/v1"
+	reportV1 "github.com/nlnwa/veidemann-api/go/report/v1"
+	"github.com/nlnwa/veidemannctl/connection"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"google.golang.org/grpc"
+	empty "google.golang.org/protobuf/types/known/emptypb"
+)
+
+type options struct {
+	interval time.Duration
+	pageSize int32
+}
+
+func NewCmd() *cobra.Command {
+	o := &options{}
+
+	cmd := &cobra.Command{
+		GroupID: "status",
+		Use:     "top",
+		Short:   "Display a live dashboard of crawler activity",
+		Long: `Display a live dashboard of crawler activity.
+
+The dashboard shows crawler status, running job executions and fetching crawl executions
+together with throughput sparklines derived from successive snapshots.
+
+Keybindings:
+  q, Ctrl-C   quit
+  p           pause crawler
+  u           unpause crawler
+  ↑/k, ↓/j    select execution
+  a           abort selected execution (asks for confirmation)
+  r           refresh now`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+				return errors.New("top requires an interactive terminal")
+			}
+			if o.interval < time.Second {
+				return fmt.Errorf("interval must be at least 1s: %v", o.interval)
+			}
+
+			cmd.SilenceUsage = true
+
+			return run(o)
+		},
+	}
+
+	cmd.Flags().DurationVarP(&o.interval, "interval", "n", 2*time.Second, "Refresh interval")
+	cmd.Flags().Int32VarP(&o.pageSize, "pagesize", "s", 50, "Maximum number of crawl executions to list")
+
+	return cmd
+}
+
+func run(o *options) error {
+	conn, err := connection.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	controllerClient := controllerV1.NewControllerClient(conn)
+	reportClient := reportV1.NewReportClient(conn)
+
+	// put terminal in raw mode to read single key presses
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("failed to initialize terminal: %w", err)
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+
+	// use alternate screen buffer and hide cursor
+	_, _ = io.WriteString(os.Stdout, esc+"[?1049h"+esc+"[?25l")
+	defer func() { _, _ = io.WriteString(os.Stdout, esc+"[?25h"+esc+"[?1049l") }()
+
+	keys := make(chan key)
+	go readKeys(os.Stdin, keys)
+
+	d := newDashboard(120)
+
+	refresh := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), o.interval)
+		defer cancel()
+		s, err := fetch(ctx, controllerClient, reportClient, o.pageSize)
+		if err != nil {
+			d.err = err
+			return
+		}
+		d.update(s)
+	}
+
+	draw := func() {
+		width, height, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			width, height = 120, 40
+		}
+		_ = d.render(os.Stdout, width, height)
+	}
+
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+
+	draw()
+	refresh()
+	draw()
+
+	for {
+		select {
+		case <-ticker.C:
+			refresh()
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			if e := d.pendingAbort; e != nil {
+				d.pendingAbort = nil
+				if k == 'y' || k == 'Y' {
+					d.message = abort(controllerClient, *e)
+					refresh()
+				} else {
+					d.message = "Abort cancelled"
+				}
+				break
+			}
+			switch k {
+			case 'q', keyCtrlC:
+				return nil
+			case 'p':
+				d.message = call("Pause", controllerClient.PauseCrawler)
+				refresh()
+			case 'u':
+				d.message = call("Unpause", controllerClient.UnPauseCrawler)
+				refresh()
+			case 'a':
+				d.requestAbort()
+			case 'r':
+				refresh()
+			case 'k', keyUp:
+				d.move(-1)
+			case 'j', keyDown:
+				d.move(1)
+			}
+		}
+		draw()
+	}
+}
+
+// fetch gets a snapshot of the crawler status, running job executions and fetching crawl executions.
+func fetch(ctx context.Context, controllerClient controllerV1.ControllerClient, reportClient reportV1.ReportClient, pageSize int32) (*snapshot, error) {
+	s := &snapshot{time: time.Now()}
+
+	status, err := controllerClient.Status(ctx, &empty.Empty{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get crawler status: %w", err)
+	}
+	s.status = status
+
+	jr, err := reportClient.ListJobExecutions(ctx, &reportV1.JobExecutionsListRequest{
+		State: []frontierV1.JobExecutionStatus_State{frontierV1.JobExecutionStatus_RUNNING},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job executions: %w", err)
+	}
+	for {
+		jes, err := jr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list job executions: %w", err)
+		}
+		s.jobExecutions = append(s.jobExecutions, jes)
+	}
+
+	cr, err := reportClient.ListExecutions(ctx, &reportV1.CrawlExecutionsListRequest{
+		State:    []frontierV1.CrawlExecutionStatus_State{frontierV1.CrawlExecutionStatus_FETCHING},
+		PageSize: pageSize,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list crawl executions: %w", err)
+	}
+	for {
+		ces, err := cr.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list crawl executions: %w", err)
+		}
+		s.crawlExecutions = append(s.crawlExecutions, ces)
+	}
+
+	return s, nil
+}
+
+// call calls a controller method without arguments and returns a message describing the result.
+func call[T any](name string, fn func(context.Context, *empty.Empty, ...grpc.CallOption) (T, error)) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := fn(ctx, &empty.Empty{}); err != nil {
+		return fmt.Sprintf("%s failed: %v", name, err)
+	}
+	return fmt.Sprintf("%s requested", name)
+}
+
+// abort aborts the execution and returns a message describing the result.
+func abort(client controllerV1.ControllerClient, e execution) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var err error
+	if e.job {
+		_, err = client.AbortJobExecution(ctx, &controllerV1.ExecutionId{Id: e.id})
+	} else {
+		_, err = client.AbortCrawlExecution(ctx, &controllerV1.ExecutionId{Id: e.id})
+	}
+	if err != nil {
+		return fmt.Sprintf("Failed to abort %s %s: %v", kindOf(e), e.id, err)
+	}
+	return fmt.Sprintf("Aborted %s %s", kindOf(e), e.id)
+}
+
+// key is a key press.
+type key rune
+
+const (
+	keyCtrlC key = 3
+	keyUp    key = -1
+	keyDown  key = -2
+)
+
+// readKeys reads key presses from r and sends them to keys until r is closed.
+func readKeys(r io.Reader, keys chan<- key) {
+	defer close(keys)
+	buf := make([]byte, 8)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		switch {
+		case n >= 3 && buf[0] == 0x1b && buf[1] == '[' && buf[2] == 'A':
+			keys <- keyUp
+		case n >= 3 && buf[0] == 0x1b && buf[1] == '[' && buf[2] == 'B':
+			keys <- keyDown
+		case n == 1:
+			keys <- key(buf[0])
+		}
+	}
+}
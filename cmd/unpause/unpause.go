@@ -15,18 +15,32 @@ package unpause
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
+	"github.com/nlnwa/veidemannctl/apiutil"
+	"github.com/nlnwa/veidemannctl/config"
 	"github.com/nlnwa/veidemannctl/connection"
 	"github.com/spf13/cobra"
 	empty "google.golang.org/protobuf/types/known/emptypb"
 )
 
+type options struct {
+	timeout time.Duration
+}
+
 func NewCmd() *cobra.Command {
-	return &cobra.Command{
-		GroupID:      "status",
-		Use:          "unpause",
-		Short:        "Request crawler to unpause",
+	o := &options{}
+
+	cmd := &cobra.Command{
+		GroupID: "status",
+		Use:     "unpause",
+		Short:   "Request crawler to unpause",
+		Long: `Request crawler to unpause and wait until the crawler reports that it is running.
+
+Any pause reason recorded by the pause command is cleared.`,
+		Args:         cobra.NoArgs,
 		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			conn, err := connection.Connect()
@@ -37,8 +51,21 @@ func NewCmd() *cobra.Command {
 
 			client := controllerV1.NewControllerClient(conn)
 
-			_, err = client.UnPauseCrawler(context.Background(), &empty.Empty{})
-			return err
+			if _, err := client.UnPauseCrawler(context.Background(), &empty.Empty{}); err != nil {
+				return fmt.Errorf("failed to unpause crawler: %w", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+			defer cancel()
+			if err := apiutil.WaitForRunStatus(ctx, client, controllerV1.RunStatus_RUNNING, time.Second); err != nil {
+				return err
+			}
+
+			return config.ClearPauseState()
 		},
 	}
+
+	cmd.Flags().DurationVar(&o.timeout, "timeout", time.Minute, "Maximum time to wait for the crawler to report that it is running")
+
+	return cmd
 }
@@ -0,0 +1,87 @@
+// Copyright © 2017 National Library of Norway.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PauseState records why and for how long the crawler was paused.
+type PauseState struct {
+	Reason   string    `yaml:"reason,omitempty"`
+	PausedAt time.Time `yaml:"paused-at"`
+	ResumeAt time.Time `yaml:"resume-at,omitempty"`
+}
+
+// getPauseStatePath returns the path of the pause state file of the current context.
+func getPauseStatePath() (string, error) {
+	return GetConfigPath(filepath.Join("contexts", GetContext(), "pause.yaml"))
+}
+
+// GetPauseState returns the recorded pause state of the current context or nil if there is none.
+func GetPauseState() (*PauseState, error) {
+	path, err := getPauseStatePath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pause state \"%s\": %w", path, err)
+	}
+	state := new(PauseState)
+	if err := yaml.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("failed to parse pause state \"%s\": %w", path, err)
+	}
+	return state, nil
+}
+
+// SetPauseState records the pause state of the current context.
+func SetPauseState(state *PauseState) error {
+	path, err := getPauseStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return fmt.Errorf("failed to create directory for pause state: %w", err)
+	}
+	b, err := yaml.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pause state: %w", err)
+	}
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		return fmt.Errorf("failed to write pause state \"%s\": %w", path, err)
+	}
+	return nil
+}
+
+// ClearPauseState removes the recorded pause state of the current context.
+func ClearPauseState() error {
+	path, err := getPauseStatePath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove pause state \"%s\": %w", path, err)
+	}
+	return nil
+}
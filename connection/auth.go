@@ -19,6 +19,7 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -26,6 +27,8 @@ import (
 	"net/http"
 	"os/exec"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -308,22 +311,103 @@ func openBrowserFlow(authCodeURL string, state string) (string, error) {
 }
 
 // oidcCredentials implements credentials.PerRPCCredentials for oidc authentication.
+//
+// If a refresh token is available, the id token is refreshed when it is about to expire
+// and the new tokens are saved to the config file.
 type oidcCredentials struct {
-	idToken string
+	mu     sync.Mutex
+	config config.OIDCConfig
 }
 
+// tokenExpiryMargin is how long before expiry an id token is refreshed.
+const tokenExpiryMargin = 30 * time.Second
+
 // GetRequestMetadata implements credentials.PerRPCCredentials.
-func (oc oidcCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+func (oc *oidcCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	if oc.config.RefreshToken != "" {
+		if expiry, err := tokenExpiry(oc.config.IdToken); err == nil && time.Until(expiry) < tokenExpiryMargin {
+			if err := oc.refresh(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to refresh id token")
+			}
+		}
+	}
+
 	return map[string]string{
-		"authorization": "Bearer" + " " + oc.idToken,
+		"authorization": "Bearer" + " " + oc.config.IdToken,
 	}, nil
 }
 
 // RequireTransportSecurity implements credentials.PerRPCCredentials.
-func (oc oidcCredentials) RequireTransportSecurity() bool {
+func (oc *oidcCredentials) RequireTransportSecurity() bool {
 	return true
 }
 
+// refresh uses the refresh token to get a new id token from the identity provider.
+func (oc *oidcCredentials) refresh(ctx context.Context) error {
+	if oc.config.IdpIssuerUrl == "" {
+		return errors.New("missing identity provider issuer url")
+	}
+	client := httpClientForRootCAs()
+	ctx = oidc.ClientContext(ctx, client)
+
+	p, err := oidc.NewProvider(ctx, oc.config.IdpIssuerUrl)
+	if err != nil {
+		return fmt.Errorf("could not connect to identity provider \"%s\": %w", oc.config.IdpIssuerUrl, err)
+	}
+	oauth2Config := &oauth2.Config{
+		ClientID:     oc.config.ClientID,
+		ClientSecret: oc.config.ClientSecret,
+		Endpoint:     p.Endpoint(),
+	}
+	token, err := oauth2Config.TokenSource(ctx, &oauth2.Token{RefreshToken: oc.config.RefreshToken}).Token()
+	if err != nil {
+		return err
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return errors.New("token not found")
+	}
+	if _, err := p.Verifier(&oidc.Config{ClientID: oc.config.ClientID}).Verify(ctx, rawIDToken); err != nil {
+		return err
+	}
+
+	oc.config.IdToken = rawIDToken
+	if token.RefreshToken != "" {
+		oc.config.RefreshToken = token.RefreshToken
+	}
+	log.Debug().Msg("Refreshed id token")
+
+	return config.SetAuthProvider(&config.AuthProvider{
+		Name:   config.ProviderOIDC,
+		Config: oc.config,
+	})
+}
+
+// tokenExpiry returns the expiry time of a JWT without verifying it.
+func tokenExpiry(rawToken string) (time.Time, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("malformed jwt")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed jwt payload: %w", err)
+	}
+	var c struct {
+		Expiry int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return time.Time{}, fmt.Errorf("malformed jwt claims: %w", err)
+	}
+	if c.Expiry == 0 {
+		return time.Time{}, errors.New("missing exp claim")
+	}
+	return time.Unix(c.Expiry, 0), nil
+}
+
 // claims represent custom claims.
 type claims struct {
 	Email    string   `json:"email"`
@@ -0,0 +1,53 @@
+package connection
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func testToken(payload string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(`{"alg":"none"}`)) + "." + enc.EncodeToString([]byte(payload)) + ".sig"
+}
+
+func TestTokenExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"valid", testToken(`{"exp":1700000000}`), time.Unix(1700000000, 0), false},
+		{"missing exp", testToken(`{"sub":"foo"}`), time.Time{}, true},
+		{"malformed", "foo.bar", time.Time{}, true},
+		{"bad payload", "foo.!!!.bar", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tokenExpiry(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("tokenExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("tokenExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOidcCredentialsWithoutRefreshToken(t *testing.T) {
+	// An expired token without a refresh token is used as is
+	token := testToken(`{"exp":1}`)
+	oc := &oidcCredentials{}
+	oc.config.IdToken = token
+
+	md, err := oc.GetRequestMetadata(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := md["authorization"]; got != "Bearer "+token {
+		t.Errorf("want %s, got %s", "Bearer "+token, got)
+	}
+}
@@ -44,7 +44,7 @@ func Connect() (*grpc.ClientConn, error) {
 		if err != nil {
 			return nil, err
 		}
-		creds = oidcCredentials{idToken: oidcConfig.IdToken}
+		creds = &oidcCredentials{config: *oidcConfig}
 	default:
 		return nil, fmt.Errorf("unknown auth provider: %s", ap.Name)
 	}
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	controllerV1 "github.com/nlnwa/veidemann-api/go/controller/v1"
 	frontierV1 "github.com/nlnwa/veidemann-api/go/frontier/v1"
 	"github.com/stretchr/testify/assert"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -66,6 +67,14 @@ func TestNewFormatter(t *testing.T) {
 
 	json := "{\"foo\": \"bar\", \"val\": 42}"
 
+	crawlerStatus := &controllerV1.CrawlerStatus{RunStatus: controllerV1.RunStatus_PAUSED, QueueSize: 42, BusyCrawlHostGroupCount: 3}
+
+	roleList := &controllerV1.RoleList{Role: []configV1.Role{configV1.Role_ADMIN, configV1.Role_CURATOR}}
+
+	annotations := &configV1.GetScriptAnnotationsResponse{Annotation: []*configV1.Annotation{{Key: "foo", Value: "bar"}}}
+
+	logLevels := &configV1.LogLevels{LogLevel: []*configV1.LogLevels_LogLevel{{Logger: "no.nb.nna", Level: configV1.LogLevels_DEBUG}}}
+
 	type args struct {
 		kind     string
 		format   string
@@ -186,6 +195,32 @@ seed:
 			seed,
 			`ID: id1, Url: http://www.example.com`},
 
+		{"CrawlerStatus-table", args{format: "table", kind: "CrawlerStatus"},
+			crawlerStatus,
+			`Status: PAUSED, Url queue size: 42, Busy crawl host groups: 3
+`},
+
+		{"CrawlerStatus-json", args{format: "json"},
+			crawlerStatus,
+			`{"runStatus": "PAUSED", "queueSize": "42", "busyCrawlHostGroupCount": "3"}`},
+
+		{"RoleList-table", args{format: "table", kind: "RoleList"},
+			roleList,
+			`ADMIN
+CURATOR
+`},
+
+		{"GetScriptAnnotationsResponse-table", args{format: "table", kind: "GetScriptAnnotationsResponse"},
+			annotations,
+			`Param: foo = 'bar'
+`},
+
+		{"LogLevels-table", args{format: "table", kind: "LogLevels"},
+			logLevels,
+			`LOGGER                                        LEVEL
+no.nb.nna                                     DEBUG
+`},
+
 		{"Json-json", args{format: "json"},
 			json,
 			`{"foo": "bar", "val": 42}`},
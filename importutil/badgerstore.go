@@ -0,0 +1,204 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// badgerLogger is a log adapter that implements badger.Logger
+type badgerLogger struct {
+	prefix string
+}
+
+func (l badgerLogger) Errorf(fmt string, args ...interface{}) {
+	log.Error().Msgf(l.prefix+fmt, args...)
+}
+
+func (l badgerLogger) Warningf(fmt string, args ...interface{}) {
+	log.Warn().Msgf(l.prefix+fmt, args...)
+}
+
+func (l badgerLogger) Infof(fmt string, args ...interface{}) {
+	log.Debug().Msgf(l.prefix+fmt, args...)
+}
+
+func (l badgerLogger) Debugf(fmt string, args ...interface{}) {
+	log.Trace().Msgf(l.prefix+fmt, args...)
+}
+
+// badgerStore is a StateStore backed by a badger database on disk.
+type badgerStore struct {
+	db *badger.DB
+	gc *time.Ticker
+}
+
+func openBadgerStore(dbDir string, truncate bool) (*badgerStore, error) {
+	if err := os.MkdirAll(dbDir, 0777); err != nil {
+		return nil, fmt.Errorf("failed to create db dir %s: %w", dbDir, err)
+	}
+	opts := badger.DefaultOptions(dbDir)
+	opts.Logger = badgerLogger{prefix: "Badger: "}
+
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not open db %s: %w", dbDir, err)
+	}
+
+	if truncate {
+		err = db.DropAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to reset db %s: %w", dbDir, err)
+		}
+	}
+
+	s := &badgerStore{
+		db: db,
+		gc: time.NewTicker(5 * time.Minute),
+	}
+
+	// Run GC in background
+	go func() {
+		for range s.gc.C {
+			s.runValueLogGC(0.7)
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *badgerStore) runValueLogGC(discardRatio float64) {
+	var err error
+	for err == nil {
+		err = s.db.RunValueLogGC(discardRatio)
+	}
+}
+
+// Compact runs value log garbage collection until no more files can be rewritten and returns
+// the number of rewritten files.
+func (s *badgerStore) Compact(discardRatio float64) (int, error) {
+	var n int
+	for {
+		err := s.db.RunValueLogGC(discardRatio)
+		if errors.Is(err, badger.ErrNoRewrite) || errors.Is(err, badger.ErrRejected) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Size returns the size of the LSM tree and the value log in bytes.
+func (s *badgerStore) Size() (lsm int64, vlog int64) {
+	return s.db.Size()
+}
+
+func (s *badgerStore) Get(key []byte) (value []byte, err error) {
+	err = s.db.View(func(txn *badger.Txn) error {
+		value, err = badgerTxn{txn}.Get(key)
+		return err
+	})
+	return
+}
+
+func (s *badgerStore) Set(key []byte, value []byte) error {
+	return s.Update(func(txn StoreTxn) error {
+		return txn.Set(key, value)
+	})
+}
+
+func (s *badgerStore) Delete(key []byte) error {
+	return s.Update(func(txn StoreTxn) error {
+		return txn.Delete(key)
+	})
+}
+
+func (s *badgerStore) Iterate(prefix []byte, fn func(key []byte, value []byte) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = prefix
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			if err := fn(item.KeyCopy(nil), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *badgerStore) DropPrefix(prefix []byte) error {
+	return s.db.DropPrefix(prefix)
+}
+
+// Update calls fn in a badger transaction, calling it again if the transaction conflicts with another.
+func (s *badgerStore) Update(fn func(txn StoreTxn) error) error {
+	for {
+		err := s.db.Update(func(txn *badger.Txn) error {
+			return fn(badgerTxn{txn})
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			return err
+		}
+	}
+}
+
+// Close runs GC, stops the GC ticker and closes the database.
+func (s *badgerStore) Close() error {
+	_ = s.db.RunValueLogGC(0.7)
+	s.gc.Stop()
+	return s.db.Close()
+}
+
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+func (t badgerTxn) Get(key []byte) ([]byte, error) {
+	item, err := t.txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, err := item.ValueCopy(nil)
+	if value == nil && err == nil {
+		value = []byte{}
+	}
+	return value, err
+}
+
+func (t badgerTxn) Set(key []byte, value []byte) error {
+	return t.txn.Set(key, value)
+}
+
+func (t badgerTxn) Delete(key []byte) error {
+	return t.txn.Delete(key)
+}
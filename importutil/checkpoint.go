@@ -0,0 +1,169 @@
+// Copyright © 2019 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// internalKeyPrefix is the prefix of keys used for bookkeeping in the import db.
+// Keys are normally URIs or names, which never start with a NUL byte.
+const internalKeyPrefix = "\x00"
+
+// checkpointKeyPrefix is the prefix of keys holding checkpoints.
+const checkpointKeyPrefix = internalKeyPrefix + "checkpoint\x00"
+
+// isInternalKey returns true if the key is used for bookkeeping.
+func isInternalKey(key []byte) bool {
+	return strings.HasPrefix(string(key), internalKeyPrefix)
+}
+
+// GetCheckpoint returns the stored checkpoint for the file or 0 if there is none.
+func (d *ImportDb) GetCheckpoint(fileName string) (int, error) {
+	v, err := d.store.Get([]byte(checkpointKeyPrefix + fileName))
+	if err == nil && v == nil {
+		return 0, nil
+	}
+	var recNum int
+	if err == nil {
+		recNum, err = strconv.Atoi(string(v))
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get checkpoint for '%s': %w", fileName, err)
+	}
+	return recNum, nil
+}
+
+// SetCheckpoint stores the checkpoint for the file.
+func (d *ImportDb) SetCheckpoint(fileName string, recNum int) error {
+	err := d.store.Set([]byte(checkpointKeyPrefix+fileName), []byte(strconv.Itoa(recNum)))
+	if err != nil {
+		return fmt.Errorf("failed to set checkpoint for '%s': %w", fileName, err)
+	}
+	return nil
+}
+
+// ResetCheckpoints removes all stored checkpoints.
+func (d *ImportDb) ResetCheckpoints() error {
+	if err := d.store.DropPrefix([]byte(checkpointKeyPrefix)); err != nil {
+		return fmt.Errorf("failed to reset checkpoints: %w", err)
+	}
+	return nil
+}
+
+// Checkpoint keeps track of processed records and stores a checkpoint in the import db for each input file.
+//
+// Records are processed concurrently and may complete out of order, so the stored checkpoint is the
+// highest record number for which all records up to and including it have been processed.
+// When resuming, records up to and including the checkpoint are skipped. Records completed after the
+// checkpoint are processed again, which is safe since the import db already knows about them.
+type Checkpoint struct {
+	db    *ImportDb
+	mu    sync.Mutex
+	files map[string]*fileProgress
+}
+
+// fileProgress tracks processed records of a single file.
+type fileProgress struct {
+	// checkpoint is the highest record number for which all records before it have been processed
+	checkpoint int
+	// done holds processed record numbers above the checkpoint
+	done map[int]bool
+}
+
+// NewCheckpoint creates a checkpoint backed by db.
+//
+// If resume is false, existing checkpoints are removed so processing starts from the beginning.
+func NewCheckpoint(db *ImportDb, resume bool) (*Checkpoint, error) {
+	if !resume {
+		if err := db.ResetCheckpoints(); err != nil {
+			return nil, err
+		}
+	}
+	return &Checkpoint{
+		db:    db,
+		files: make(map[string]*fileProgress),
+	}, nil
+}
+
+// progress returns the progress of a file, loading the stored checkpoint the first time the file is seen.
+// Must be called with the lock held.
+func (c *Checkpoint) progress(fileName string) (*fileProgress, error) {
+	if p, ok := c.files[fileName]; ok {
+		return p, nil
+	}
+	checkpoint, err := c.db.GetCheckpoint(fileName)
+	if err != nil {
+		return nil, err
+	}
+	p := &fileProgress{checkpoint: checkpoint, done: make(map[int]bool)}
+	c.files[fileName] = p
+	return p, nil
+}
+
+// Processed returns true if the record was processed by a previous run.
+func (c *Checkpoint) Processed(state *State) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, err := c.progress(checkpointFileName(state))
+	if err != nil {
+		return false, err
+	}
+	return state.GetRecordNum() <= p.checkpoint, nil
+}
+
+// Done marks the record as processed and stores a new checkpoint if it can be advanced.
+func (c *Checkpoint) Done(state *State) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fileName := checkpointFileName(state)
+	p, err := c.progress(fileName)
+	if err != nil {
+		return err
+	}
+	if state.GetRecordNum() <= p.checkpoint {
+		return nil
+	}
+	p.done[state.GetRecordNum()] = true
+
+	checkpoint := p.checkpoint
+	for p.done[checkpoint+1] {
+		checkpoint++
+		delete(p.done, checkpoint)
+	}
+	if checkpoint == p.checkpoint {
+		return nil
+	}
+	p.checkpoint = checkpoint
+
+	return c.db.SetCheckpoint(fileName, checkpoint)
+}
+
+// checkpointFileName returns the name used to identify the file of a record.
+func checkpointFileName(state *State) string {
+	fileName := state.GetFilename()
+	if fileName == "" {
+		return fileName
+	}
+	if abs, err := filepath.Abs(fileName); err == nil {
+		return abs
+	}
+	return fileName
+}
@@ -0,0 +1,93 @@
+// Copyright © 2019 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"testing"
+)
+
+func TestCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	db, err := NewImportDb(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := db.Set("http://example.com/", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCheckpoint(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// records complete out of order
+	for _, recNum := range []int{2, 1, 4, 5} {
+		if err := c.Done(&State{fileName: "seeds.json", recNum: recNum}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, _ := db.GetCheckpoint(checkpointFileName(&State{fileName: "seeds.json"})); got != 2 {
+		t.Errorf("Expected checkpoint 2, got %d", got)
+	}
+
+	// checkpoints must not show up when iterating
+	var keys []string
+	if err := db.Iterate(func(key []byte, _ []byte) { keys = append(keys, string(key)) }); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "http://example.com/" {
+		t.Errorf("Expected only seed key when iterating, got %q", keys)
+	}
+	db.Close()
+
+	// resume from stored checkpoint
+	db, err = NewImportDb(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = NewCheckpoint(db, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for recNum, want := range map[int]bool{1: true, 2: true, 3: false, 4: false} {
+		got, err := c.Processed(&State{fileName: "seeds.json", recNum: recNum})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("Processed(%d) = %v, want %v", recNum, got, want)
+		}
+	}
+	if got, _ := c.Processed(&State{fileName: "other.json", recNum: 1}); got {
+		t.Error("Expected record in other file not to be processed")
+	}
+	db.Close()
+
+	// start over when not resuming
+	db, err = NewImportDb(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	c, err = NewCheckpoint(db, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := c.Processed(&State{fileName: "seeds.json", recNum: 1}); got {
+		t.Error("Expected checkpoints to be reset")
+	}
+}
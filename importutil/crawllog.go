@@ -0,0 +1,147 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	commonsV1 "github.com/nlnwa/veidemann-api/go/commons/v1"
+	logV1 "github.com/nlnwa/veidemann-api/go/log/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// Crawl log status codes of uris excluded from a crawl.
+const (
+	StatusOutOfScope               int32 = -5000
+	StatusBlocked                  int32 = -5001
+	StatusBlockedByCustomProcessor int32 = -5002
+)
+
+// ExcludedStatusCodes are the status codes of crawl log entries for uris that were out of scope or blocked.
+var ExcludedStatusCodes = []int32{StatusOutOfScope, StatusBlocked, StatusBlockedByCustomProcessor}
+
+// CrawlLogReader reads the crawl log entries of a crawl or job execution with one of a set of status codes.
+//
+// The crawl log is queried once for every status code. Records are numbered in the order they are received.
+// Errors querying or reading the crawl log are fatal: after Next has returned one, it returns it again on
+// every call.
+type CrawlLogReader struct {
+	ctx         context.Context
+	client      logV1.LogClient
+	name        string
+	template    *logV1.CrawlLog
+	statusCodes []int32
+	status      int32
+	stream      logV1.Log_ListCrawlLogsClient
+	recNum      int
+	err         error
+}
+
+// NewCrawlLogReader creates a reader of the crawl log of a crawl execution, or of a job execution if jobExecution is true.
+func NewCrawlLogReader(ctx context.Context, client logV1.LogClient, executionId string, jobExecution bool, statusCodes []int32) (*CrawlLogReader, error) {
+	if executionId == "" {
+		return nil, errors.New("missing execution id")
+	}
+	if len(statusCodes) == 0 {
+		return nil, errors.New("missing status codes")
+	}
+	r := &CrawlLogReader{
+		ctx:         ctx,
+		client:      client,
+		statusCodes: statusCodes,
+	}
+	if jobExecution {
+		r.name = "jobExecution:" + executionId
+		r.template = &logV1.CrawlLog{JobExecutionId: executionId}
+	} else {
+		r.name = "crawlExecution:" + executionId
+		r.template = &logV1.CrawlLog{ExecutionId: executionId}
+	}
+	return r, nil
+}
+
+// next opens the query for the next status code.
+func (r *CrawlLogReader) next() error {
+	if len(r.statusCodes) == 0 {
+		return io.EOF
+	}
+	template := &logV1.CrawlLog{
+		ExecutionId:    r.template.ExecutionId,
+		JobExecutionId: r.template.JobExecutionId,
+		StatusCode:     r.statusCodes[0],
+	}
+	mask := &commonsV1.FieldMask{Paths: []string{"statusCode"}}
+	if template.JobExecutionId != "" {
+		mask.Paths = append(mask.Paths, "jobExecutionId")
+	} else {
+		mask.Paths = append(mask.Paths, "executionId")
+	}
+	stream, err := r.client.ListCrawlLogs(r.ctx, &logV1.CrawlLogListRequest{
+		QueryTemplate: template,
+		QueryMask:     mask,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list crawl log of %s: %w", r.name, err)
+	}
+	r.stream = stream
+	r.status = template.StatusCode
+	r.statusCodes = r.statusCodes[1:]
+	return nil
+}
+
+// Next reads the next crawl log entry into v, which must be a *string for the requested uri or a *logV1.CrawlLog.
+// It returns io.EOF when there are no more entries. A value of unsupported type is reported as the error of the
+// returned state.
+func (r *CrawlLogReader) Next(v interface{}) (*State, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	for {
+		if r.stream == nil {
+			if err := r.next(); err != nil {
+				r.err = err
+				return nil, err
+			}
+		}
+		crawlLog, err := r.stream.Recv()
+		if errors.Is(err, io.EOF) {
+			r.stream = nil
+			continue
+		}
+		if err != nil {
+			r.stream = nil
+			r.err = fmt.Errorf("failed to read crawl log of %s: %w", r.name, err)
+			return nil, r.err
+		}
+		// Guard against servers ignoring the status code in the query
+		if crawlLog.GetStatusCode() != r.status {
+			continue
+		}
+		r.recNum++
+		state := &State{fileName: r.name, recNum: r.recNum}
+		switch v := v.(type) {
+		case *string:
+			*v = crawlLog.GetRequestedUri()
+		case *logV1.CrawlLog:
+			proto.Reset(v)
+			proto.Merge(v, crawlLog)
+		default:
+			state.err = fmt.Errorf("unsupported type %T", v)
+		}
+		return state, nil
+	}
+}
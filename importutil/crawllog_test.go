@@ -0,0 +1,138 @@
+package importutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	logV1 "github.com/nlnwa/veidemann-api/go/log/v1"
+	"google.golang.org/grpc"
+)
+
+// fakeLogClient lists crawl logs matching the execution ids of the query template, ignoring the status code
+type fakeLogClient struct {
+	logV1.LogClient
+	crawlLogs []*logV1.CrawlLog
+	requests  []*logV1.CrawlLogListRequest
+	// listErr is returned by ListCrawlLogs
+	listErr error
+	// recvErr is returned by streams after the matching crawl logs
+	recvErr error
+}
+
+func (c *fakeLogClient) ListCrawlLogs(_ context.Context, req *logV1.CrawlLogListRequest, _ ...grpc.CallOption) (logV1.Log_ListCrawlLogsClient, error) {
+	c.requests = append(c.requests, req)
+	if c.listErr != nil {
+		return nil, c.listErr
+	}
+	var items []*logV1.CrawlLog
+	for _, crawlLog := range c.crawlLogs {
+		if crawlLog.GetExecutionId() == req.GetQueryTemplate().GetExecutionId() ||
+			crawlLog.GetJobExecutionId() == req.GetQueryTemplate().GetJobExecutionId() {
+			items = append(items, crawlLog)
+		}
+	}
+	return &crawlLogStream{items: items, err: c.recvErr}, nil
+}
+
+type crawlLogStream struct {
+	grpc.ClientStream
+	items []*logV1.CrawlLog
+	err   error
+}
+
+func (s *crawlLogStream) Recv() (*logV1.CrawlLog, error) {
+	if len(s.items) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	return item, nil
+}
+
+func TestCrawlLogReader(t *testing.T) {
+	client := &fakeLogClient{crawlLogs: []*logV1.CrawlLog{
+		{ExecutionId: "ce1", JobExecutionId: "je1", RequestedUri: "https://a.example.com/x", StatusCode: StatusOutOfScope},
+		{ExecutionId: "ce1", JobExecutionId: "je1", RequestedUri: "https://example.com/", StatusCode: 200},
+		{ExecutionId: "ce2", JobExecutionId: "je1", RequestedUri: "https://b.example.com/", StatusCode: StatusBlocked},
+		{ExecutionId: "ce3", JobExecutionId: "je2", RequestedUri: "https://c.example.com/", StatusCode: StatusOutOfScope},
+	}}
+
+	rr, err := NewCrawlLogReader(context.Background(), client, "je1", true, []int32{StatusOutOfScope, StatusBlocked})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		var uri string
+		state, err := rr.Next(&uri)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.GetFilename() != "jobExecution:je1" || state.GetRecordNum() != len(got)+1 {
+			t.Errorf("got state %s:%d", state.GetFilename(), state.GetRecordNum())
+		}
+		got = append(got, uri)
+	}
+	want := []string{"https://a.example.com/x", "https://b.example.com/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got uris %v, want %v", got, want)
+	}
+
+	if len(client.requests) != 2 {
+		t.Fatalf("got %d requests, want one per status code", len(client.requests))
+	}
+	req := client.requests[1]
+	if req.GetQueryTemplate().GetStatusCode() != StatusBlocked ||
+		!reflect.DeepEqual(req.GetQueryMask().GetPaths(), []string{"statusCode", "jobExecutionId"}) {
+		t.Errorf("got request %v", req)
+	}
+}
+
+func TestCrawlLogReaderError(t *testing.T) {
+	unavailable := errors.New("unavailable")
+	crawlLogs := []*logV1.CrawlLog{
+		{ExecutionId: "ce1", RequestedUri: "https://a.example.com/", StatusCode: StatusOutOfScope},
+	}
+	tests := []struct {
+		name   string
+		client *fakeLogClient
+		// records is the number of records read before the error
+		records int
+	}{
+		{"list", &fakeLogClient{crawlLogs: crawlLogs, listErr: unavailable}, 0},
+		{"recv", &fakeLogClient{crawlLogs: crawlLogs, recvErr: unavailable}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr, err := NewCrawlLogReader(context.Background(), tt.client, "ce1", false, ExcludedStatusCodes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var uri string
+			for i := 0; i < tt.records; i++ {
+				if _, err := rr.Next(&uri); err != nil {
+					t.Fatalf("record %d: %v", i+1, err)
+				}
+			}
+			// The error is returned again instead of moving on to the next status code
+			for i := 0; i < 3; i++ {
+				state, err := rr.Next(&uri)
+				if !errors.Is(err, unavailable) || state != nil {
+					t.Fatalf("Next() = %v, %v, want error %v", state, err, unavailable)
+				}
+			}
+			if len(tt.client.requests) != 1 {
+				t.Errorf("got %d requests, want 1", len(tt.client.requests))
+			}
+		})
+	}
+}
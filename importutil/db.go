@@ -20,36 +20,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
+	"strings"
 	"time"
 
-	"github.com/dgraph-io/badger/v4"
-	"github.com/dgraph-io/ristretto/z"
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
 	"github.com/rs/zerolog/log"
 )
 
-// badgerLogger is a log adapter that implements badger.Logger
-type badgerLogger struct {
-	prefix string
-}
-
-func (l badgerLogger) Errorf(fmt string, args ...interface{}) {
-	log.Error().Msgf(l.prefix+fmt, args...)
-}
-
-func (l badgerLogger) Warningf(fmt string, args ...interface{}) {
-	log.Warn().Msgf(l.prefix+fmt, args...)
-}
-
-func (l badgerLogger) Infof(fmt string, args ...interface{}) {
-	log.Debug().Msgf(l.prefix+fmt, args...)
-}
-
-func (l badgerLogger) Debugf(fmt string, args ...interface{}) {
-	log.Trace().Msgf(l.prefix+fmt, args...)
-}
-
 type ExistsCode int
 
 const (
@@ -80,90 +57,127 @@ type KeyNormalizer interface {
 	Normalize(key string) (string, error)
 }
 
+// ObjectKeyer creates keys from whole config objects. ImportExisting uses ObjectKey rather than
+// Normalize of key normalizers implementing it.
+type ObjectKeyer interface {
+	ObjectKey(obj *configV1.ConfigObject) (string, error)
+}
+
+// ImportDb maps keys, e.g. normalized URIs, to the ids of the objects in Veidemann with that key.
 type ImportDb struct {
-	db *badger.DB
-	gc *time.Ticker
+	store StateStore
 }
 
+// NewImportDb opens the import db in dbDir, or an in-memory import db if dbDir is InMemory.
+// If truncate is true, the db is emptied.
 func NewImportDb(dbDir string, truncate bool) (*ImportDb, error) {
-	if err := os.MkdirAll(dbDir, 0777); err != nil {
-		return nil, fmt.Errorf("failed to create db dir %s: %w", dbDir, err)
-	}
-	opts := badger.DefaultOptions(dbDir)
-	opts.Logger = badgerLogger{prefix: "Badger: "}
-
-	db, err := badger.Open(opts)
+	store, err := OpenStateStore(dbDir, truncate)
 	if err != nil {
-		return nil, fmt.Errorf("could not open db %s: %w", dbDir, err)
+		return nil, err
 	}
+	return NewImportDbFromStore(store), nil
+}
 
-	if truncate {
-		err = db.DropAll()
-		if err != nil {
-			return nil, fmt.Errorf("failed to reset db %s: %w", dbDir, err)
-		}
-	}
+// NewImportDbFromStore creates an import db backed by store.
+func NewImportDbFromStore(store StateStore) *ImportDb {
+	return &ImportDb{store: store}
+}
 
-	d := &ImportDb{
-		db: db,
-		gc: time.NewTicker(5 * time.Minute),
+func (d *ImportDb) RunValueLogGC(discardRatio float64) {
+	if s, ok := d.store.(*badgerStore); ok {
+		s.runValueLogGC(discardRatio)
 	}
-
-	// Run GC in background
-	go func() {
-		for range d.gc.C {
-			d.RunValueLogGC(0.7)
-		}
-	}()
-
-	return d, nil
 }
 
-func (d *ImportDb) RunValueLogGC(discardRatio float64) {
-	var err error
-	for err == nil {
-		err = d.db.RunValueLogGC(discardRatio)
+// Compact runs value log garbage collection until no more files can be rewritten and returns
+// the number of rewritten files. Stores without a value log are left as is.
+func (d *ImportDb) Compact(discardRatio float64) (int, error) {
+	if s, ok := d.store.(interface {
+		Compact(discardRatio float64) (int, error)
+	}); ok {
+		return s.Compact(discardRatio)
 	}
+	return 0, nil
 }
 
-// Close closes the database, stops the GC ticker and waits for
+// Close closes the database.
 func (d *ImportDb) Close() {
-	_ = d.db.RunValueLogGC(0.7)
-	d.gc.Stop()
-	_ = d.db.Close()
+	_ = d.store.Close()
 }
 
+// ImportExisting imports the objects of the kind from Veidemann into the db.
+//
+// The first time, and whenever the key normalizer changes, all objects are imported. Otherwise only objects
+// modified since the previous import are fetched: the query template of a list request only matches equal
+// values, so objects are listed by last modified time, newest first, and listing stops at the high-water mark
+// stored by the previous import, less syncOverlap to allow for clock skew between the writers. Objects with a
+// last modified time equal to the mark are fetched again. Objects deleted in Veidemann are found with an id-only
+// listing and removed, and objects in that listing unknown to the db are fetched one by one.
 func ImportExisting(db *ImportDb, client configV1.ConfigClient, kind configV1.Kind, keyNormalizer KeyNormalizer) error {
+	state, err := db.getSyncState()
+	if err != nil {
+		return err
+	}
+	normalizer := normalizerName(keyNormalizer)
+	incremental := state != nil && state.Normalizer == normalizer
+
+	var since time.Time
 	req := &configV1.ListRequest{
 		Kind: kind,
 	}
-	r, err := client.ListConfigObjects(context.Background(), req)
+	if incremental {
+		since = state.LastModified
+		req.OrderByPath = "meta.lastModified"
+		req.OrderDescending = true
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := client.ListConfigObjects(ctx, req)
 	if err != nil {
 		return fmt.Errorf("failed to list %s from Veidemann: %w", kind.String(), err)
 	}
 
 	var count, imported, failed int
 
-	start := time.Now()
-	for {
-		msg, err := r.Recv()
-		if errors.Is(err, io.EOF) {
-			break
-		}
-		if err != nil {
-			return fmt.Errorf("error reading %s from Veidemann: %w", kind.String(), err)
+	highWaterMark := since
+	// ids of all objects in Veidemann, known after a full import
+	existing := make(map[string]bool)
+
+	importObject := func(msg *configV1.ConfigObject) error {
+		if lastModified := msg.GetMeta().GetLastModified().AsTime(); lastModified.After(highWaterMark) {
+			highWaterMark = lastModified
 		}
 
 		id := msg.GetId()
 		key := msg.GetMeta().GetName()
+		existing[id] = true
 
-		if keyNormalizer != nil {
+		var err error
+		if keyer, ok := keyNormalizer.(ObjectKeyer); ok {
+			key, err = keyer.ObjectKey(msg)
+		} else if keyNormalizer != nil {
 			key, err = keyNormalizer.Normalize(key)
-			if err != nil {
-				failed++
-				log.Error().Err(err).Str("key", msg.GetMeta().GetName()).Str("id", id).Msg("Normalization failed")
-				continue
+		}
+		if err != nil {
+			failed++
+			log.Error().Err(err).Str("key", msg.GetMeta().GetName()).Str("id", id).Msg("Normalization failed")
+			return nil
+		}
+
+		l := log.With().Str("key", key).Str("id", id).Str("kind", kind.String()).Logger()
+
+		// Remove the previous key of an object that has been renamed
+		oldKey, err := db.KeyOf(id)
+		if err != nil {
+			return fmt.Errorf("error reading from db: %w", err)
+		}
+		if oldKey != "" && oldKey != key {
+			if err := db.Delete(oldKey, id); err != nil {
+				return fmt.Errorf("error writing to db: %w", err)
 			}
+			l.Info().Str("oldKey", oldKey).Msg("Key changed in Veidemann")
 		}
 
 		code, _, err := db.Set(key, id)
@@ -171,8 +185,6 @@ func ImportExisting(db *ImportDb, client configV1.ConfigClient, kind configV1.Ki
 			return fmt.Errorf("error writing to db: %w", err)
 		}
 
-		l := log.With().Str("key", key).Str("id", id).Str("kind", kind.String()).Logger()
-
 		count++
 		switch code {
 		case Undefined:
@@ -185,100 +197,189 @@ func ImportExisting(db *ImportDb, client configV1.ConfigClient, kind configV1.Ki
 		case Exists:
 			l.Info().Msg("Already imported from Veidemann")
 		}
+		return nil
 	}
-	elapsed := time.Since(start)
-	log.Info().Str("kind", kind.String()).Int("total", count).Int("imported", imported).Int("errors", failed).Str("elapsed", elapsed.String()).Msg("Import from Veidemann complete")
 
-	return nil
-}
+	// Listing stops at objects imported by a previous import, unless the listing turns out not to be ordered
+	stop := since.Add(-syncOverlap)
+	ordered := true
+	var prev time.Time
 
-// Iterate iterates over all keys in the db and calls the function with the key and value.
-// The function is not called in parallel.
-func (d *ImportDb) Iterate(fn func([]byte, []byte)) error {
-	stream := d.db.NewStream()
+	start := time.Now()
+	for {
+		msg, err := r.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading %s from Veidemann: %w", kind.String(), err)
+		}
 
-	// -- Optional settings
-	stream.NumGo = 16                     // Set number of goroutines to use for iteration.
-	stream.LogPrefix = "Badger.Streaming" // For identifying stream logs. Outputs to Logger.
-	// -- End of optional settings.
+		if lastModified := msg.GetMeta().GetLastModified().AsTime(); incremental && ordered {
+			if !prev.IsZero() && lastModified.After(prev) {
+				ordered = false
+				log.Warn().Str("kind", kind.String()).Msg("Objects from Veidemann not ordered by last modified time, listing all objects")
+			} else if lastModified.Before(stop) {
+				// the rest of the objects were imported by a previous import
+				break
+			}
+			prev = lastModified
+		}
 
-	// Send is called serially, while Stream.Orchestrate is running.
-	stream.Send = func(buf *z.Buffer) error {
-		list, err := badger.BufferToKVList(buf)
-		if err != nil {
+		if err := importObject(msg); err != nil {
 			return err
 		}
-		for _, kv := range list.GetKv() {
-			fn(kv.Key, kv.Value)
-		}
-		return nil
 	}
+	cancel()
 
-	// Run the stream
-	return stream.Orchestrate(context.Background())
-}
-
-// Get returns the ids for the key
-func (d *ImportDb) Get(key string) (ids []string, err error) {
-	for {
-		err = d.db.View(func(txn *badger.Txn) error {
-			item, err := txn.Get([]byte(key))
-			if errors.Is(err, badger.ErrKeyNotFound) {
-				return nil
+	// Reconcile deletions and fetch objects missed by the listing
+	if incremental {
+		ids, err := listIds(context.Background(), client, kind)
+		if err != nil {
+			return err
+		}
+		for id := range ids {
+			if existing[id] {
+				continue
+			}
+			key, err := db.KeyOf(id)
+			if err != nil {
+				return fmt.Errorf("error reading from db: %w", err)
+			}
+			if key != "" {
+				continue
 			}
+			msg, err := client.GetConfigObject(context.Background(), &configV1.ConfigRef{Kind: kind, Id: id})
 			if err != nil {
+				return fmt.Errorf("failed to get %s %s from Veidemann: %w", kind.String(), id, err)
+			}
+			if err := importObject(msg); err != nil {
 				return err
 			}
+		}
+		existing = ids
+	}
+	removed, err := db.removeStale(existing)
+	if err != nil {
+		return fmt.Errorf("failed to remove deleted %s from db: %w", kind.String(), err)
+	}
 
-			return item.Value(func(v []byte) error {
-				ids = d.bytesToStringArray(v)
-				return nil
-			})
-		})
-		if !errors.Is(err, badger.ErrConflict) {
-			break
+	if err := db.setSyncState(syncState{LastModified: highWaterMark, Normalizer: normalizer}); err != nil {
+		return err
+	}
+
+	elapsed := time.Since(start)
+	log.Info().Str("kind", kind.String()).Bool("incremental", incremental).Int("total", count).Int("imported", imported).Int("removed", removed).Int("errors", failed).Str("elapsed", elapsed.String()).Msg("Import from Veidemann complete")
+
+	return nil
+}
+
+// Iterate iterates over all keys in the db and calls the function with the key and value.
+// The function is not called in parallel.
+func (d *ImportDb) Iterate(fn func([]byte, []byte)) error {
+	return d.store.Iterate(nil, func(k []byte, v []byte) error {
+		// Skip keys used for bookkeeping
+		if !isInternalKey(k) {
+			fn(k, v)
 		}
+		return nil
+	})
+}
+
+// IterateIds iterates over all keys in the db and calls the function with the key and its ids.
+// The function is not called in parallel.
+func (d *ImportDb) IterateIds(fn func(key string, ids []string)) error {
+	return d.Iterate(func(k []byte, v []byte) {
+		fn(string(k), d.bytesToStringArray(v))
+	})
+}
+
+// Get returns the ids for the key
+func (d *ImportDb) Get(key string) ([]string, error) {
+	v, err := d.store.Get([]byte(key))
+	if err != nil || v == nil {
+		return nil, err
 	}
-	return ids, err
+	return d.bytesToStringArray(v), nil
 }
 
 // Set sets the id as a value for the key.
 func (d *ImportDb) Set(key string, id string) (code ExistsCode, ids []string, err error) {
-	for {
-		err = d.db.Update(func(txn *badger.Txn) error {
-			item, err := txn.Get([]byte(key))
-			if errors.Is(err, badger.ErrKeyNotFound) {
-				code = NewKey
-				ids = append(ids, id)
-				v := d.stringArrayToBytes(ids)
-				return txn.Set([]byte(key), v)
-			}
-			if err != nil {
+	err = d.store.Update(func(txn StoreTxn) error {
+		code, ids = Undefined, nil
+
+		// Keep the SURT index up to date, also for keys set before the index existed
+		if k := surtIndexKey(key); k != nil {
+			if err := txn.Set(k, nil); err != nil {
 				return err
 			}
+		}
+		if err := txn.Set([]byte(idKeyPrefix+id), []byte(key)); err != nil {
+			return err
+		}
+
+		v, err := txn.Get([]byte(key))
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			code = NewKey
+			ids = append(ids, id)
+			return txn.Set([]byte(key), d.stringArrayToBytes(ids))
+		}
+
+		ids = d.bytesToStringArray(v)
+		if !stringArrayContains(ids, id) {
+			code = NewId
+			ids = append(ids, id)
+			return txn.Set([]byte(key), d.stringArrayToBytes(ids))
+		}
+		code = Exists
+		return nil
+	})
+	return
+}
+
+// Delete removes the id from the values of the key. The key is removed when it has no ids left.
+func (d *ImportDb) Delete(key string, id string) error {
+	return d.store.Update(func(txn StoreTxn) error {
+		v, err := txn.Get([]byte(key))
+		if err != nil || v == nil {
+			return err
+		}
+
+		ids := d.bytesToStringArray(v)
+		var remaining []string
+		for _, i := range ids {
+			if i != id {
+				remaining = append(remaining, i)
+			}
+		}
+		if len(remaining) == len(ids) {
+			return nil
+		}
 
-			err = item.Value(func(v []byte) error {
-				ids = d.bytesToStringArray(v)
-				return nil
-			})
-			if err != nil {
+		// Remove the id from the id index if it points to this key
+		indexed, err := txn.Get([]byte(idKeyPrefix + id))
+		if err != nil {
+			return err
+		}
+		if string(indexed) == key {
+			if err := txn.Delete([]byte(idKeyPrefix + id)); err != nil {
 				return err
 			}
-			if !stringArrayContains(ids, id) {
-				code = NewId
-				ids = append(ids, id)
-				v := d.stringArrayToBytes(ids)
-				return txn.Set([]byte(key), v)
-			} else {
-				code = Exists
+		}
+
+		if len(remaining) == 0 {
+			if k := surtIndexKey(key); k != nil {
+				if err := txn.Delete(k); err != nil {
+					return err
+				}
 			}
-			return nil
-		})
-		if !errors.Is(err, badger.ErrConflict) {
-			break
+			return txn.Delete([]byte(key))
 		}
-	}
-	return
+		return txn.Set([]byte(key), d.stringArrayToBytes(remaining))
+	})
 }
 
 // stringArrayToBytes returns a byte array from a string array
@@ -309,3 +410,48 @@ func stringArrayContains(s []string, e string) bool {
 	}
 	return false
 }
+
+// DbStats holds counts of the entries in the db.
+type DbStats struct {
+	// Keys is the number of keys
+	Keys int
+	// Ids is the number of ids of all keys
+	Ids int
+	// DuplicateKeys is the number of keys with more than one id
+	DuplicateKeys int
+	// Checkpoints is the number of stored checkpoints
+	Checkpoints int
+	// SurtIndexEntries is the number of entries in the SURT index
+	SurtIndexEntries int
+	// LsmSize is the size of the LSM tree in bytes
+	LsmSize int64
+	// VlogSize is the size of the value log in bytes
+	VlogSize int64
+}
+
+// Stats counts the entries in the db.
+func (d *ImportDb) Stats() (DbStats, error) {
+	var stats DbStats
+	err := d.store.Iterate(nil, func(k []byte, v []byte) error {
+		key := string(k)
+		switch {
+		case strings.HasPrefix(key, checkpointKeyPrefix):
+			stats.Checkpoints++
+		case strings.HasPrefix(key, surtKeyPrefix):
+			stats.SurtIndexEntries++
+		case isInternalKey(k):
+		default:
+			n := len(d.bytesToStringArray(v))
+			stats.Keys++
+			stats.Ids += n
+			if n > 1 {
+				stats.DuplicateKeys++
+			}
+		}
+		return nil
+	})
+	if s, ok := d.store.(interface{ Size() (int64, int64) }); ok {
+		stats.LsmSize, stats.VlogSize = s.Size()
+	}
+	return stats, err
+}
@@ -59,3 +59,70 @@ func TestExistsCode_ExistsInVeidemann(t *testing.T) {
 		})
 	}
 }
+
+func TestImportDbDelete(t *testing.T) {
+	db, err := NewImportDb(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, _, _ = db.Set("key", "1")
+	_, _, _ = db.Set("key", "2")
+
+	if err := db.Delete("key", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := db.Get("key"); !reflect.DeepEqual(ids, []string{"2"}) {
+		t.Errorf("Expected [2], got %v", ids)
+	}
+	if err := db.Delete("key", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := db.Get("key"); len(ids) != 0 {
+		t.Errorf("Expected key to be deleted, got %v", ids)
+	}
+	if err := db.Delete("missing", "1"); err != nil {
+		t.Errorf("Expected no error deleting missing key, got %v", err)
+	}
+}
+
+func TestImportDbStats(t *testing.T) {
+	db, err := NewImportDb(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, _, _ = db.Set("http://example.com/", "1")
+	_, _, _ = db.Set("http://example.com/", "2")
+	_, _, _ = db.Set("http://example.org/", "3")
+	_, _, _ = db.Set("Some entity", "4")
+	_ = db.SetCheckpoint("file", 1)
+
+	stats, err := db.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats.LsmSize, stats.VlogSize = 0, 0
+	want := DbStats{Keys: 3, Ids: 4, DuplicateKeys: 1, Checkpoints: 1, SurtIndexEntries: 2}
+	if stats != want {
+		t.Errorf("Stats() = %+v, want %+v", stats, want)
+	}
+
+	got := make(map[string][]string)
+	err = db.IterateIds(func(key string, ids []string) {
+		got[key] = ids
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantIds := map[string][]string{
+		"http://example.com/": {"1", "2"},
+		"http://example.org/": {"3"},
+		"Some entity":         {"4"},
+	}
+	if !reflect.DeepEqual(got, wantIds) {
+		t.Errorf("IterateIds() = %v, want %v", got, wantIds)
+	}
+}
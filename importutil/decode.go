@@ -15,7 +15,10 @@ package importutil
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"reflect"
@@ -35,7 +38,8 @@ func (l *LineAsStringDecoder) Init(r io.Reader, suffix string) {
 
 func (l *LineAsStringDecoder) Read(v interface{}) error {
 	s, err := l.r.ReadString('\n')
-	if err != nil {
+	// a last line without a line break is still a line
+	if err != nil && !(errors.Is(err, io.EOF) && s != "") {
 		return err
 	}
 
@@ -75,3 +79,156 @@ func (j *JsonYamlDecoder) Init(r io.Reader, suffix string) {
 func (j *JsonYamlDecoder) Read(v interface{}) error {
 	return j.Decode(v)
 }
+
+// SuffixDecoder is a decoder that delegates to a decoder chosen by the suffix of the input file.
+type SuffixDecoder struct {
+	// Decoders maps file suffixes (e.g. ".csv") to decoders
+	Decoders map[string]RecordDecoder
+	// Default is used for suffixes not in Decoders
+	Default RecordDecoder
+
+	current RecordDecoder
+}
+
+func (s *SuffixDecoder) Init(r io.Reader, suffix string) {
+	d, ok := s.Decoders[strings.ToLower(suffix)]
+	if !ok {
+		d = s.Default
+	}
+	d.Init(r, suffix)
+	s.current = d
+}
+
+func (s *SuffixDecoder) Read(v interface{}) error {
+	return s.current.Read(v)
+}
+
+// CsvDecoder is a decoder that reads records from CSV or TSV input with a header row.
+//
+// Columns are mapped to fields of the target struct by their JSON name. A field name on the form
+// <field>.<key> adds a label with the given key and the column value to the label list <field>.
+// Empty cells are ignored.
+type CsvDecoder struct {
+	// ColumnMap maps field names to column names. If empty, column names are used as field names.
+	ColumnMap map[string]string
+
+	r *csv.Reader
+	// fields holds the field names for each column
+	fields [][]string
+	// done is set when the rest of the input must be skipped
+	done bool
+}
+
+func (c *CsvDecoder) Init(r io.Reader, suffix string) {
+	c.r = csv.NewReader(r)
+	if strings.ToLower(suffix) == ".tsv" {
+		c.r.Comma = '\t'
+		c.r.LazyQuotes = true
+	}
+	c.r.FieldsPerRecord = -1
+	c.r.TrimLeadingSpace = true
+	c.fields = nil
+	c.done = false
+}
+
+// readHeader reads the header row and resolves which fields each column maps to.
+func (c *CsvDecoder) readHeader() error {
+	header, err := c.r.Read()
+	if err != nil {
+		return err
+	}
+	if len(header) > 0 {
+		// spreadsheet applications often prefix exports with a byte order mark
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	c.fields = make([][]string, len(header))
+	if len(c.ColumnMap) == 0 {
+		for i, column := range header {
+			c.fields[i] = []string{column}
+		}
+		return nil
+	}
+
+	index := make(map[string]int, len(header))
+	for i, column := range header {
+		index[column] = i
+	}
+	for field, column := range c.ColumnMap {
+		i, ok := index[column]
+		if !ok {
+			return fmt.Errorf("column '%s' mapped to '%s' not found in header: %v", column, field, header)
+		}
+		c.fields[i] = append(c.fields[i], field)
+	}
+	return nil
+}
+
+func (c *CsvDecoder) Read(v interface{}) error {
+	if c.done {
+		return io.EOF
+	}
+	if c.fields == nil {
+		if err := c.readHeader(); err != nil {
+			// no records can be read without a valid header, so report the error once and skip the input
+			c.done = true
+			return err
+		}
+	}
+
+	row, err := c.r.Read()
+	if err != nil {
+		return err
+	}
+
+	record := make(map[string]interface{})
+	for i, fields := range c.fields {
+		if i >= len(row) {
+			break
+		}
+		value := strings.TrimSpace(row[i])
+		if value == "" {
+			continue
+		}
+		for _, field := range fields {
+			if name, key, ok := strings.Cut(field, "."); ok {
+				labels, _ := record[name].([]interface{})
+				record[name] = append(labels, map[string]string{"key": key, "value": value})
+			} else {
+				record[field] = value
+			}
+		}
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// ParseColumnMap parses a column map on the form field=column[,field=column...].
+func ParseColumnMap(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	if s == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		field, column, ok := strings.Cut(pair, "=")
+		field = strings.TrimSpace(field)
+		column = strings.TrimSpace(column)
+		if !ok || field == "" || column == "" {
+			return nil, fmt.Errorf("invalid column mapping '%s', expected field=column", pair)
+		}
+		if _, ok := m[field]; ok {
+			return nil, fmt.Errorf("field '%s' is mapped more than once", field)
+		}
+		m[field] = column
+	}
+	return m, nil
+}
@@ -0,0 +1,161 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+)
+
+func TestCsvDecoder(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		suffix    string
+		columnMap string
+		want      []SeedDesc
+		wantErr   bool
+	}{
+		{
+			name:   "column names as fields",
+			input:  "uri,entityName\nhttps://www.example.com/,Example\n",
+			suffix: ".csv",
+			want:   []SeedDesc{{Uri: "https://www.example.com/", EntityName: "Example"}},
+		},
+		{
+			name:      "column map",
+			input:     "\ufeffURL,Owner,Topic,Comment\nhttps://www.example.com/,Example,news,ignored\nhttps://www.example.org/,Other,,\n",
+			suffix:    ".csv",
+			columnMap: "uri=URL,entityName=Owner,seedLabel.topic=Topic",
+			want: []SeedDesc{
+				{
+					Uri:        "https://www.example.com/",
+					EntityName: "Example",
+					SeedLabel:  []*configV1.Label{{Key: "topic", Value: "news"}},
+				},
+				{Uri: "https://www.example.org/", EntityName: "Other"},
+			},
+		},
+		{
+			name:   "tab separated",
+			input:  "uri\tseedDescription\nhttps://www.example.com/\ta \"quoted\" description\n",
+			suffix: ".tsv",
+			want:   []SeedDesc{{Uri: "https://www.example.com/", SeedDescription: "a \"quoted\" description"}},
+		},
+		{
+			name:      "missing column",
+			input:     "URL\nhttps://www.example.com/\n",
+			suffix:    ".csv",
+			columnMap: "uri=Link",
+			wantErr:   true,
+		},
+		{
+			name:    "unknown field",
+			input:   "url\nhttps://www.example.com/\n",
+			suffix:  ".csv",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columnMap, err := ParseColumnMap(tt.columnMap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := &CsvDecoder{ColumnMap: columnMap}
+			d.Init(strings.NewReader(tt.input), tt.suffix)
+
+			var got []SeedDesc
+			for {
+				var sd SeedDesc
+				err := d.Read(&sd)
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				if err != nil {
+					if !tt.wantErr {
+						t.Fatalf("unexpected error: %v", err)
+					}
+					return
+				}
+				got = append(got, sd)
+			}
+			if tt.wantErr {
+				t.Fatal("expected error")
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d records, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i].String() != tt.want[i].String() {
+					t.Errorf("record %d: got %s, want %s", i, got[i].String(), tt.want[i].String())
+				}
+			}
+		})
+	}
+}
+
+func TestParseColumnMap(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    map[string]string
+		wantErr bool
+	}{
+		{"empty", "", map[string]string{}, false},
+		{"pairs", "uri=URL, seedLabel.topic=Topic", map[string]string{"uri": "URL", "seedLabel.topic": "Topic"}, false},
+		{"missing column", "uri=", nil, true},
+		{"missing separator", "uri", nil, true},
+		{"duplicate field", "uri=A,uri=B", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseColumnMap(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColumnMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseColumnMap() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLineAsStringDecoder(t *testing.T) {
+	for _, input := range []string{"a\n b \n\nc", "a\n b \n\nc\n"} {
+		d := &LineAsStringDecoder{}
+		d.Init(strings.NewReader(input), "")
+		var got []string
+		for {
+			var s string
+			err := d.Read(&s)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, s)
+		}
+		// The last line is read with or without a line break
+		if want := []string{"a", "b", "", "c"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %q from %q, want %q", got, input, want)
+		}
+	}
+}
@@ -16,10 +16,14 @@ package importutil
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"sort"
+	"strings"
 
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/net/publicsuffix"
 )
 
 type DuplicateReportRecord struct {
@@ -81,6 +85,18 @@ func (d DuplicateKindReporter) Report(w io.Writer) error {
 	return nil
 }
 
+// IterateDuplicates calls fn with every key having more than one id.
+// The function is not called in parallel.
+func (d *ImportDb) IterateDuplicates(fn func(key string, ids []string)) error {
+	return d.IterateIds(func(key string, ids []string) {
+		// If there is only one id, it is not a duplicate
+		if len(ids) < 2 {
+			return
+		}
+		fn(key, ids)
+	})
+}
+
 type SeedDuplicateReportRecord struct {
 	Host  string
 	Seeds []SeedRecord
@@ -121,28 +137,12 @@ func (d SeedReporter) Report(w io.Writer) error {
 		l := log.With().Str("key", rec.Host).Logger()
 
 		for _, id := range ids {
-			l = l.With().Str("id", id).Logger()
-			ref := &configV1.ConfigRef{Id: id, Kind: configV1.Kind_seed}
-			seed, err := d.Client.GetConfigObject(context.Background(), ref)
+			sr, err := getSeedRecord(d.Client, id)
 			if err != nil {
-				l.Error().Err(err).Msg("failed to get seed from Veidemann")
+				l.Error().Err(err).Str("id", id).Msg("failed to get seed from Veidemann")
 				continue
 			}
-			sr := SeedRecord{
-				SeedId:          seed.GetId(),
-				Uri:             seed.GetMeta().GetName(),
-				SeedDescription: seed.GetMeta().GetDescription(),
-				EntityId:        seed.GetSeed().GetEntityRef().GetId(),
-			}
 			rec.Seeds = append(rec.Seeds, sr)
-
-			entity, err := d.Client.GetConfigObject(context.Background(), seed.GetSeed().GetEntityRef())
-			if err != nil {
-				l.Warn().Err(err).Str("key", rec.Host).Str("entityId", sr.EntityId).Msg("failed to get entity from Veidemann")
-				continue
-			}
-			sr.EntityName = entity.GetMeta().GetName()
-			sr.EntityDescription = entity.GetMeta().GetDescription()
 		}
 
 		b, err := json.Marshal(rec)
@@ -168,3 +168,224 @@ func (d SeedReporter) Report(w io.Writer) error {
 	log.Info().Int32("duplicate keys", nrOfDuplicateKeys).Int32("duplicate values", nrOfDuplicateValues).Msg("Duplicate report completed")
 	return nil
 }
+
+// getSeedRecord returns a report record for the seed with the given id.
+// A failure to get the seed's entity is logged and the record is returned without entity name and description.
+func getSeedRecord(client configV1.ConfigClient, id string) (SeedRecord, error) {
+	ref := &configV1.ConfigRef{Id: id, Kind: configV1.Kind_seed}
+	seed, err := client.GetConfigObject(context.Background(), ref)
+	if err != nil {
+		return SeedRecord{}, err
+	}
+	sr := SeedRecord{
+		SeedId:          seed.GetId(),
+		Uri:             seed.GetMeta().GetName(),
+		SeedDescription: seed.GetMeta().GetDescription(),
+		EntityId:        seed.GetSeed().GetEntityRef().GetId(),
+	}
+
+	entity, err := client.GetConfigObject(context.Background(), seed.GetSeed().GetEntityRef())
+	if err != nil {
+		log.Warn().Err(err).Str("id", id).Str("entityId", sr.EntityId).Msg("failed to get entity from Veidemann")
+		return sr, nil
+	}
+	sr.EntityName = entity.GetMeta().GetName()
+	sr.EntityDescription = entity.GetMeta().GetDescription()
+
+	return sr, nil
+}
+
+// GroupBy selects how seeds with overlapping scope are clustered.
+type GroupBy string
+
+const (
+	// GroupByRegisteredDomain clusters seeds on the same registered domain (e.g. www.example.com and news.example.com)
+	GroupByRegisteredDomain GroupBy = "registered-domain"
+	// GroupByHost clusters seeds on the same host (including port)
+	GroupByHost GroupBy = "host"
+	// GroupByPrefix clusters a seed with every seed whose SURT starts with the seed's SURT (e.g. example.com/ and example.com/news/)
+	GroupByPrefix GroupBy = "prefix"
+)
+
+// ParseGroupBy returns the GroupBy of the given name.
+func ParseGroupBy(s string) (GroupBy, error) {
+	switch g := GroupBy(s); g {
+	case GroupByRegisteredDomain, GroupByHost, GroupByPrefix:
+		return g, nil
+	default:
+		return "", fmt.Errorf("invalid group by: %s (must be one of %s, %s or %s)", s, GroupByRegisteredDomain, GroupByHost, GroupByPrefix)
+	}
+}
+
+type SeedClusterRecord struct {
+	Group string
+	Seeds []SeedRecord
+}
+
+// SeedClusterReporter reports clusters of seeds with overlapping scope.
+//
+// It scans the SURT index of the import db, so seeds must have been imported into the db with a URI key normalizer.
+type SeedClusterReporter struct {
+	*ImportDb
+	Client  configV1.ConfigClient
+	GroupBy GroupBy
+}
+
+// seedCluster is a group of seeds with overlapping scope.
+type seedCluster struct {
+	group string
+	ids   []string
+}
+
+func (c *seedCluster) add(ids []string) {
+	for _, id := range ids {
+		if !stringArrayContains(c.ids, id) {
+			c.ids = append(c.ids, id)
+		}
+	}
+}
+
+func (d SeedClusterReporter) Report(w io.Writer) error {
+	var nrOfClusters int32
+	var nrOfSeeds int32
+
+	writeCluster := func(c *seedCluster) error {
+		// A single seed does not overlap with anything
+		if c == nil || len(c.ids) < 2 {
+			return nil
+		}
+		nrOfClusters++
+		nrOfSeeds += int32(len(c.ids))
+
+		l := log.With().Str("group", c.group).Logger()
+
+		rec := SeedClusterRecord{Group: c.group}
+		for _, id := range c.ids {
+			sr, err := getSeedRecord(d.Client, id)
+			if err != nil {
+				l.Error().Err(err).Str("id", id).Msg("failed to get seed from Veidemann")
+				continue
+			}
+			rec.Seeds = append(rec.Seeds, sr)
+		}
+
+		b, err := json.Marshal(&rec)
+		if err != nil {
+			return fmt.Errorf("failed to marshal record to json: %w", err)
+		}
+		if _, err := w.Write(append(b, '\n')); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+		return nil
+	}
+
+	var err error
+	switch d.GroupBy {
+	case GroupByPrefix:
+		// Keys are visited in SURT order, so every key having the SURT of a cluster as prefix comes right
+		// after it, but other keys with the same string prefix may come in between, e.g. /news-archive
+		// between /news and /news/a. The open clusters are kept in a stack, each a string prefix of
+		// the next, and a cluster is written when a key no longer has it as string prefix.
+		var open []*seedCluster
+		err = d.ScanSurtPrefix("", func(surt string, key string, ids []string) error {
+			for len(open) > 0 && !strings.HasPrefix(surt, open[len(open)-1].group) {
+				if err := writeCluster(open[len(open)-1]); err != nil {
+					return err
+				}
+				open = open[:len(open)-1]
+			}
+			for _, c := range open {
+				if surtContains(c.group, surt) {
+					c.add(ids)
+					return nil
+				}
+			}
+			c := &seedCluster{group: surt}
+			c.add(ids)
+			open = append(open, c)
+			return nil
+		})
+		for len(open) > 0 && err == nil {
+			err = writeCluster(open[len(open)-1])
+			open = open[:len(open)-1]
+		}
+	case GroupByHost, GroupByRegisteredDomain:
+		clusters := make(map[string]*seedCluster)
+		err = d.ScanSurtPrefix("", func(surt string, key string, ids []string) error {
+			group := surtHost(surt)
+			if d.GroupBy == GroupByRegisteredDomain {
+				group = registeredDomain(group)
+			}
+			c, ok := clusters[group]
+			if !ok {
+				c = &seedCluster{group: group}
+				clusters[group] = c
+			}
+			c.add(ids)
+			return nil
+		})
+		if err != nil {
+			break
+		}
+		groups := make([]string, 0, len(clusters))
+		for group := range clusters {
+			groups = append(groups, group)
+		}
+		sort.Strings(groups)
+		for _, group := range groups {
+			if err = writeCluster(clusters[group]); err != nil {
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("invalid group by: %s", d.GroupBy)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Info().Str("groupBy", string(d.GroupBy)).Int32("clusters", nrOfClusters).Int32("seeds", nrOfSeeds).Msg("Cluster report completed")
+	return nil
+}
+
+// surtContains returns true if the SURT prefix covers surt, i.e. surt starts with prefix at a path boundary:
+// "(no,example,)/news" covers "(no,example,)/news/sport" and "(no,example,)/news?page=2", but not
+// "(no,example,)/newsletter".
+func surtContains(prefix string, surt string) bool {
+	if !strings.HasPrefix(surt, prefix) {
+		return false
+	}
+	if len(surt) == len(prefix) || strings.HasSuffix(prefix, "/") || strings.HasSuffix(prefix, ")") {
+		return true
+	}
+	switch surt[len(prefix)] {
+	case '/', '?', '#':
+		return true
+	}
+	return false
+}
+
+// surtHost returns the host (and port, if any) of a SURT in its usual form, e.g. "com,example,www:8080)/" becomes "www.example.com:8080".
+func surtHost(surt string) string {
+	host, _, _ := strings.Cut(surt, ")")
+	host, port, hasPort := strings.Cut(host, ":")
+	labels := strings.Split(host, ",")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	host = strings.Join(labels, ".")
+	if hasPort {
+		host += ":" + port
+	}
+	return host
+}
+
+// registeredDomain returns the registered domain of host (e.g. "example.co.uk" for "www.example.co.uk:8080").
+// If it cannot be determined (e.g. for an IP address), the host name is returned.
+func registeredDomain(host string) string {
+	hostname, _, _ := strings.Cut(host, ":")
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(hostname); err == nil {
+		return domain
+	}
+	return hostname
+}
@@ -0,0 +1,159 @@
+package importutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"google.golang.org/grpc"
+)
+
+// fakeConfigClient returns config objects from a map
+type fakeConfigClient struct {
+	configV1.ConfigClient
+	objects map[string]*configV1.ConfigObject
+}
+
+func (c *fakeConfigClient) GetConfigObject(_ context.Context, ref *configV1.ConfigRef, _ ...grpc.CallOption) (*configV1.ConfigObject, error) {
+	if o, ok := c.objects[ref.GetId()]; ok {
+		return o, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func TestSeedClusterReporter(t *testing.T) {
+	seeds := map[string]string{
+		"1": "https://example.com/",
+		"2": "https://example.com/news/",
+		"3": "https://www.example.com/",
+		"4": "https://www.example.com/",
+		"5": "https://example.org/",
+		"6": "https://example.co.uk/",
+		"7": "https://shop.example.co.uk/",
+		// /newsletter and /news-archive do not overlap /news
+		"8":  "https://example.no/news",
+		"9":  "https://example.no/newsletter",
+		"10": "https://example.no/news-archive",
+		"11": "https://example.no/news/sport",
+	}
+
+	db, err := NewImportDb(InMemory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	client := &fakeConfigClient{objects: map[string]*configV1.ConfigObject{
+		"entity": {Id: "entity", Kind: configV1.Kind_crawlEntity, Meta: &configV1.Meta{Name: "Example"}},
+	}}
+	normalizer := &UriKeyNormalizer{IgnoreScheme: true}
+	for id, uri := range seeds {
+		client.objects[id] = &configV1.ConfigObject{
+			Id:   id,
+			Kind: configV1.Kind_seed,
+			Meta: &configV1.Meta{Name: uri},
+			Spec: &configV1.ConfigObject_Seed{Seed: &configV1.Seed{
+				EntityRef: &configV1.ConfigRef{Kind: configV1.Kind_crawlEntity, Id: "entity"},
+			}},
+		}
+		key, err := normalizer.Normalize(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, _ = db.Set(key, id)
+	}
+
+	tests := []struct {
+		groupBy GroupBy
+		want    map[string][]string
+	}{
+		{GroupByRegisteredDomain, map[string][]string{
+			"example.co.uk": {"6", "7"},
+			"example.com":   {"1", "2", "3", "4"},
+			"example.no":    {"10", "11", "8", "9"},
+		}},
+		{GroupByHost, map[string][]string{
+			"example.com":     {"1", "2"},
+			"www.example.com": {"3", "4"},
+			"example.no":      {"10", "11", "8", "9"},
+		}},
+		{GroupByPrefix, map[string][]string{
+			"com,example)/":     {"1", "2"},
+			"com,example,www)/": {"3", "4"},
+			"no,example)/news":  {"11", "8"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.groupBy), func(t *testing.T) {
+			var buf bytes.Buffer
+			r := SeedClusterReporter{ImportDb: db, Client: client, GroupBy: tt.groupBy}
+			if err := r.Report(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string][]string)
+			dec := json.NewDecoder(&buf)
+			for dec.More() {
+				var rec SeedClusterRecord
+				if err := dec.Decode(&rec); err != nil {
+					t.Fatal(err)
+				}
+				for _, sr := range rec.Seeds {
+					if sr.EntityName != "Example" {
+						t.Errorf("Expected entity name of seed %s to be Example, got %q", sr.SeedId, sr.EntityName)
+					}
+					got[rec.Group] = append(got[rec.Group], sr.SeedId)
+				}
+			}
+			for _, ids := range got {
+				sort.Strings(ids)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Report() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSurtContains(t *testing.T) {
+	tests := []struct {
+		prefix string
+		surt   string
+		want   bool
+	}{
+		{"no,example)/news", "no,example)/news", true},
+		{"no,example)/news", "no,example)/news/sport", true},
+		{"no,example)/news", "no,example)/news?page=2", true},
+		{"no,example)/news", "no,example)/news#top", true},
+		{"no,example)/news", "no,example)/newsletter", false},
+		{"no,example)/news", "no,example)/news-archive", false},
+		{"no,example)/news/", "no,example)/news/sport", true},
+		{"no,example)", "no,example)/news", true},
+		{"no,example)/", "no,example,www)/", false},
+	}
+	for _, tt := range tests {
+		if got := surtContains(tt.prefix, tt.surt); got != tt.want {
+			t.Errorf("surtContains(%q, %q) = %v, want %v", tt.prefix, tt.surt, got, tt.want)
+		}
+	}
+}
+
+func TestSurtHost(t *testing.T) {
+	tests := []struct {
+		surt string
+		want string
+	}{
+		{"com,example,www)/foo", "www.example.com"},
+		{"com,example:8080)/", "example.com:8080"},
+	}
+	for _, tt := range tests {
+		if got := surtHost(tt.surt); got != tt.want {
+			t.Errorf("surtHost(%q) = %q, want %q", tt.surt, got, tt.want)
+		}
+	}
+}
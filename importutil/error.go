@@ -20,3 +20,31 @@ type ErrAlreadyExists string
 func (e ErrAlreadyExists) Error() string {
 	return fmt.Sprintf("already exists: %s", string(e))
 }
+
+type ErrNotFound string
+
+func (e ErrNotFound) Error() string {
+	return fmt.Sprintf("not found: %s", string(e))
+}
+
+// ErrAmbiguous is returned when a key matches more than one id.
+type ErrAmbiguous struct {
+	Key string
+	Ids []string
+}
+
+func (e ErrAmbiguous) Error() string {
+	return fmt.Sprintf("ambiguous: %s matches %d ids %v", e.Key, len(e.Ids), e.Ids)
+}
+
+// ErrUriCheck is returned when a uri is rejected by the uri check.
+type ErrUriCheck struct {
+	Result *UriCheckResult
+}
+
+func (e ErrUriCheck) Error() string {
+	if e.Result.Error == "" {
+		return fmt.Sprintf("uri check failed: %s", e.Result.Category)
+	}
+	return fmt.Sprintf("uri check failed: %s: %s", e.Result.Category, e.Result.Error)
+}
@@ -0,0 +1,383 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/net/html"
+)
+
+// maxSitemapDepth is the maximum depth of nested sitemap indexes.
+const maxSitemapDepth = 5
+
+// UriExtractor extracts URIs from local files or remote documents.
+type UriExtractor struct {
+	// Client is used to fetch remote documents
+	*http.Client
+}
+
+// Sitemap returns the URIs of a sitemap. Sitemap indexes are followed recursively.
+//
+// Sitemaps referenced from a local sitemap index are read from the same directory as the index
+// if a file with the same name exists there, otherwise they are fetched.
+func (e *UriExtractor) Sitemap(source string) ([]string, error) {
+	var uris []string
+	visited := make(map[string]bool)
+
+	var extract func(source string, depth int) error
+	extract = func(source string, depth int) error {
+		if visited[source] {
+			return nil
+		}
+		visited[source] = true
+
+		if depth > maxSitemapDepth {
+			return fmt.Errorf("sitemap index nested too deep: %s", source)
+		}
+
+		r, base, err := e.open(source)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		locs, sitemaps, err := parseSitemap(r)
+		if err != nil {
+			return fmt.Errorf("failed to parse sitemap '%s': %w", source, err)
+		}
+		uris = append(uris, resolveAll(base, locs)...)
+
+		for _, sitemap := range resolveAll(base, sitemaps) {
+			if err := extract(localSibling(source, sitemap), depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := extract(source, 0); err != nil {
+		return nil, err
+	}
+	return dedup(uris), nil
+}
+
+// Feed returns the URIs of the items in an RSS or Atom feed.
+func (e *UriExtractor) Feed(source string) ([]string, error) {
+	r, base, err := e.open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	links, err := parseFeed(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feed '%s': %w", source, err)
+	}
+	return dedup(resolveAll(base, links)), nil
+}
+
+// Html returns the URIs of the links in an HTML document.
+func (e *UriExtractor) Html(source string) ([]string, error) {
+	r, base, err := e.open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	links, docBase, err := parseHtmlLinks(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse html '%s': %w", source, err)
+	}
+	if docBase != "" {
+		if u, err := url.Parse(docBase); err == nil {
+			if base != nil {
+				u = base.ResolveReference(u)
+			}
+			base = u
+		}
+	}
+	return dedup(resolveAll(base, links)), nil
+}
+
+// open opens a local file or fetches a remote document.
+// The returned base URL is used to resolve relative URIs and is nil for local files.
+// Gzip compressed content is decompressed.
+func (e *UriExtractor) open(source string) (io.ReadCloser, *url.URL, error) {
+	var rc io.ReadCloser
+	var base *url.URL
+
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		if e.Client == nil {
+			return nil, nil, fmt.Errorf("no http client to fetch '%s'", source)
+		}
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, source, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, err := e.Client.Do(req)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to fetch '%s': %w", source, err)
+		}
+		if resp.StatusCode >= 400 {
+			_ = resp.Body.Close()
+			return nil, nil, fmt.Errorf("failed to fetch '%s': %s", source, resp.Status)
+		}
+		log.Info().Str("uri", source).Msg("Fetched document")
+		rc = resp.Body
+		base = resp.Request.URL
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not open file '%s': %w", source, err)
+		}
+		log.Info().Str("filename", source).Msg("Reading file")
+		rc = f
+	}
+
+	br := bufio.NewReader(rc)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			_ = rc.Close()
+			return nil, nil, fmt.Errorf("failed to decompress '%s': %w", source, err)
+		}
+		return readCloser{Reader: gz, Closer: rc}, base, nil
+	}
+	return readCloser{Reader: br, Closer: rc}, base, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// localSibling returns the path of a local file with the same name as the sitemap uri in the
+// directory of a local source, if it exists. Otherwise, the uri is returned.
+func localSibling(source string, uri string) string {
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return uri
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return uri
+	}
+	sibling := filepath.Join(filepath.Dir(source), name)
+	if _, err := os.Stat(sibling); err == nil {
+		return sibling
+	}
+	return uri
+}
+
+// parseSitemap parses a sitemap or a sitemap index and returns page locations and sitemap locations.
+func parseSitemap(r io.Reader) (locs []string, sitemaps []string, err error) {
+	var doc struct {
+		XMLName xml.Name
+		Urls    []struct {
+			Loc string `xml:"loc"`
+		} `xml:"url"`
+		Sitemaps []struct {
+			Loc string `xml:"loc"`
+		} `xml:"sitemap"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+	default:
+		return nil, nil, fmt.Errorf("not a sitemap: unexpected root element <%s>", doc.XMLName.Local)
+	}
+	for _, u := range doc.Urls {
+		locs = append(locs, strings.TrimSpace(u.Loc))
+	}
+	for _, s := range doc.Sitemaps {
+		sitemaps = append(sitemaps, strings.TrimSpace(s.Loc))
+	}
+	return locs, sitemaps, nil
+}
+
+// parseFeed parses an RSS 1.0, RSS 2.0 or Atom feed and returns the links of the items.
+func parseFeed(r io.Reader) ([]string, error) {
+	type item struct {
+		Link string `xml:"link"`
+	}
+	var doc struct {
+		XMLName xml.Name
+		// RSS 2.0
+		Channel struct {
+			Items []item `xml:"item"`
+		} `xml:"channel"`
+		// RSS 1.0
+		Items []item `xml:"item"`
+		// Atom
+		Entries []struct {
+			Links []struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var links []string
+	switch doc.XMLName.Local {
+	case "rss", "RDF":
+		for _, i := range append(doc.Channel.Items, doc.Items...) {
+			links = append(links, strings.TrimSpace(i.Link))
+		}
+	case "feed":
+		for _, entry := range doc.Entries {
+			for _, link := range entry.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					links = append(links, strings.TrimSpace(link.Href))
+					break
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("not a feed: unexpected root element <%s>", doc.XMLName.Local)
+	}
+	return links, nil
+}
+
+// parseHtmlLinks returns the href of every anchor in an HTML document and the href of the base element, if any.
+func parseHtmlLinks(r io.Reader) (links []string, base string, err error) {
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return links, base, nil
+			}
+			return nil, "", z.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.Data != "a" && t.Data != "base" {
+				continue
+			}
+			for _, attr := range t.Attr {
+				if attr.Key != "href" {
+					continue
+				}
+				href := strings.TrimSpace(attr.Val)
+				if t.Data == "base" {
+					if base == "" {
+						base = href
+					}
+				} else {
+					links = append(links, href)
+				}
+			}
+		}
+	}
+}
+
+// resolveAll resolves URIs against base and returns the absolute http and https URIs.
+func resolveAll(base *url.URL, uris []string) []string {
+	var result []string
+	for _, uri := range uris {
+		if uri == "" {
+			continue
+		}
+		u, err := url.Parse(uri)
+		if err != nil {
+			log.Warn().Err(err).Str("uri", uri).Msg("Skipping invalid URI")
+			continue
+		}
+		if base != nil {
+			u = base.ResolveReference(u)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+		u.Fragment = ""
+		result = append(result, u.String())
+	}
+	return result
+}
+
+// dedup removes duplicates while keeping the order.
+func dedup(uris []string) []string {
+	seen := make(map[string]bool, len(uris))
+	result := uris[:0]
+	for _, uri := range uris {
+		if seen[uri] {
+			continue
+		}
+		seen[uri] = true
+		result = append(result, uri)
+	}
+	return result
+}
+
+// seedUriReader returns a seed description for each uri.
+type seedUriReader struct {
+	source   string
+	uris     []string
+	template SeedDesc
+	recNum   int
+	read     atomic.Int64
+}
+
+// NewSeedUriReader creates a record reader that returns a copy of template with the uri set for each uri.
+// The source is used as file name in the returned state.
+func NewSeedUriReader(source string, uris []string, template SeedDesc) *seedUriReader {
+	return &seedUriReader{source: source, uris: uris, template: template}
+}
+
+// InputProgress returns the number of uris read and the total number of uris.
+func (s *seedUriReader) InputProgress() (int64, int64) {
+	return s.read.Load(), int64(len(s.uris))
+}
+
+// Next reads the next seed description into v, which must be a *SeedDesc.
+func (s *seedUriReader) Next(v interface{}) (*State, error) {
+	if s.recNum >= len(s.uris) {
+		return nil, io.EOF
+	}
+	sd, ok := v.(*SeedDesc)
+	if !ok {
+		return nil, fmt.Errorf("invalid target: %T", v)
+	}
+	*sd = s.template
+	sd.Uri = s.uris[s.recNum]
+	s.recNum++
+	s.read.Store(int64(s.recNum))
+
+	return &State{
+		fileName: s.source,
+		recNum:   s.recNum,
+	}, nil
+}
@@ -0,0 +1,176 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, name string, content string, compress bool) string {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if compress {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		_, err = gz.Write([]byte(content))
+	} else {
+		_, err = f.WriteString(content)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestUriExtractorSitemap(t *testing.T) {
+	dir := t.TempDir()
+
+	index := writeFile(t, filepath.Join(dir, "sitemap.xml"), `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://www.example.com/sitemap-news.xml</loc></sitemap>
+  <sitemap><loc>https://www.example.com/sitemap-pages.xml.gz</loc></sitemap>
+</sitemapindex>`, false)
+
+	writeFile(t, filepath.Join(dir, "sitemap-news.xml"), `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://www.example.com/news/1</loc></url>
+  <url><loc> https://www.example.com/news/2 </loc></url>
+</urlset>`, false)
+
+	writeFile(t, filepath.Join(dir, "sitemap-pages.xml.gz"), `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://www.example.com/about</loc></url>
+  <url><loc>https://www.example.com/news/1</loc></url>
+</urlset>`, true)
+
+	e := &UriExtractor{}
+	got, err := e.Sitemap(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://www.example.com/news/1",
+		"https://www.example.com/news/2",
+		"https://www.example.com/about",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	notSitemap := writeFile(t, filepath.Join(dir, "feed.xml"), `<rss><channel></channel></rss>`, false)
+	if _, err := e.Sitemap(notSitemap); err == nil {
+		t.Error("expected error when parsing a feed as sitemap")
+	}
+}
+
+func TestUriExtractorFeed(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{
+			name: "rss",
+			content: `<?xml version="1.0"?>
+<rss version="2.0"><channel>
+  <link>https://www.example.com/</link>
+  <item><link>https://www.example.com/a</link></item>
+  <item><link>https://www.example.com/b#comments</link></item>
+</channel></rss>`,
+			want: []string{"https://www.example.com/a", "https://www.example.com/b"},
+		},
+		{
+			name: "atom",
+			content: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <link href="https://www.example.com/"/>
+  <entry>
+    <link rel="edit" href="https://www.example.com/edit/a"/>
+    <link rel="alternate" href="https://www.example.com/a"/>
+  </entry>
+  <entry><link href="https://www.example.com/b"/></entry>
+</feed>`,
+			want: []string{"https://www.example.com/a", "https://www.example.com/b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := writeFile(t, filepath.Join(dir, tt.name+".xml"), tt.content, false)
+			got, err := (&UriExtractor{}).Feed(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUriExtractorHtml(t *testing.T) {
+	name := writeFile(t, filepath.Join(t.TempDir(), "links.html"), `<!DOCTYPE html>
+<html><head><base href="https://www.example.com/events/"></head>
+<body>
+  <a href="https://www.example.org/">Org</a>
+  <a href="2024/">Relative</a>
+  <a href="/about">Absolute path</a>
+  <a href="mailto:post@example.com">Mail</a>
+  <a href="https://www.example.org/">Duplicate</a>
+  <a name="anchor">No href</a>
+</body></html>`, false)
+
+	got, err := (&UriExtractor{}).Html(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://www.example.org/",
+		"https://www.example.com/events/2024/",
+		"https://www.example.com/about",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSeedUriReader(t *testing.T) {
+	template := SeedDesc{EntityName: "Example"}
+	r := NewSeedUriReader("sitemap.xml", []string{"https://www.example.com/a", "https://www.example.com/b"}, template)
+
+	var got []SeedDesc
+	for {
+		var sd SeedDesc
+		state, err := r.Next(&sd)
+		if err != nil {
+			break
+		}
+		if state.GetFilename() != "sitemap.xml" || state.GetRecordNum() != len(got)+1 {
+			t.Errorf("unexpected state: %s %d", state.GetFilename(), state.GetRecordNum())
+		}
+		got = append(got, sd)
+	}
+	if len(got) != 2 || got[1].Uri != "https://www.example.com/b" || got[1].EntityName != "Example" {
+		t.Errorf("unexpected records: %v", got)
+	}
+}
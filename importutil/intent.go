@@ -0,0 +1,361 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	commonsV1 "github.com/nlnwa/veidemann-api/go/commons/v1"
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// intentKeyPrefix is the prefix of keys holding intents.
+const intentKeyPrefix = internalKeyPrefix + "intent\x00"
+
+// IntentStage is the progress of an intent.
+type IntentStage int
+
+const (
+	// IntentStarted means no object is known to be created yet
+	IntentStarted IntentStage = iota
+	// IntentEntityCreated means the entity is created, but not the seed
+	IntentEntityCreated
+	// IntentSeedCreated means the seed is created, but the state dbs are not updated
+	IntentSeedCreated
+	// IntentCommitted means everything is done. Committed intents are removed from the log.
+	IntentCommitted
+)
+
+func (s IntentStage) String() string {
+	if s < IntentStarted || s > IntentCommitted {
+		return "UNKNOWN"
+	}
+	names := []string{
+		"STARTED",
+		"ENTITY_CREATED",
+		"SEED_CREATED",
+		"COMMITTED"}
+
+	return names[s]
+}
+
+// Intent records the creation of a seed, and possibly of its entity, in Veidemann.
+//
+// The ids of the objects are chosen before they are created, so after a crash the log knows which objects
+// may exist even if their creation was never confirmed.
+type Intent struct {
+	Id    string      `json:"id"`
+	Stage IntentStage `json:"stage"`
+	// Key is the key of the seed in the seed db
+	Key        string `json:"key"`
+	SeedId     string `json:"seedId"`
+	EntityName string `json:"entityName"`
+	EntityId   string `json:"entityId"`
+	// NewEntity is true if the entity is created by this intent
+	NewEntity bool `json:"newEntity"`
+}
+
+// IntentLog is a write-ahead log, kept in the seed db, of seeds and entities being created in Veidemann.
+//
+// A seed is created in steps: the intent is stored, the entity is created if needed, the seed is created and
+// finally the state dbs are updated. An intent left behind by a crash is replayed by Replay: if the seed
+// exists the intent is completed, otherwise it is rolled back by deleting what was created.
+type IntentLog struct {
+	Client   configV1.ConfigClient
+	EntityDb *ImportDb
+	SeedDb   *ImportDb
+}
+
+// Create creates the seed described by sd with the given key, and its entity if sd has no entity id.
+// It returns the created seed and entity, where the entity is nil if it already existed.
+//
+// If creation fails, whatever was created is deleted again. An intent that can not be rolled back is kept
+// in the log and handled by the next Replay.
+func (l *IntentLog) Create(key string, sd *SeedDesc) (seed *configV1.ConfigObject, entity *configV1.ConfigObject, err error) {
+	intent := &Intent{
+		Id:         newObjectId(),
+		Key:        key,
+		SeedId:     newObjectId(),
+		EntityName: sd.EntityName,
+		EntityId:   sd.EntityId,
+	}
+	if intent.EntityId == "" {
+		intent.EntityId = newObjectId()
+		intent.NewEntity = true
+	}
+	if err := l.save(intent); err != nil {
+		return nil, nil, err
+	}
+
+	// rollback undoes the intent and returns err
+	rollback := func(err error) error {
+		if rerr := l.rollback(intent); rerr != nil {
+			log.Error().Err(rerr).Str("intentId", intent.Id).Msg("Failed to roll back, will retry on next run")
+		}
+		return err
+	}
+
+	if intent.NewEntity {
+		obj := sd.ToEntity()
+		obj.Id = intent.EntityId
+		entity, err = l.saveObject(obj)
+		if err != nil {
+			return nil, nil, rollback(fmt.Errorf("failed to create entity in Veidemann: %w", err))
+		}
+		if err := l.advance(intent, IntentEntityCreated); err != nil {
+			return nil, nil, rollback(err)
+		}
+		if _, _, err := l.EntityDb.Set(intent.EntityName, intent.EntityId); err != nil {
+			return nil, nil, rollback(fmt.Errorf("failed to save new entity to import db: %w", err))
+		}
+	}
+
+	sd.EntityId = intent.EntityId
+	obj := sd.ToSeed()
+	obj.Id = intent.SeedId
+	seed, err = l.saveObject(obj)
+	if err != nil {
+		return nil, nil, rollback(fmt.Errorf("failed to create seed in Veidemann: %w", err))
+	}
+
+	// From here on the seed exists, so a failing intent is completed by the next Replay
+	if err := l.advance(intent, IntentSeedCreated); err != nil {
+		return seed, entity, err
+	}
+	if err := l.complete(intent); err != nil {
+		return seed, entity, err
+	}
+	return seed, entity, nil
+}
+
+// Pending returns the intents in the log.
+func (l *IntentLog) Pending() ([]*Intent, error) {
+	var intents []*Intent
+	err := l.SeedDb.store.Iterate([]byte(intentKeyPrefix), func(_ []byte, v []byte) error {
+		intent := &Intent{}
+		if err := json.Unmarshal(v, intent); err != nil {
+			return err
+		}
+		intents = append(intents, intent)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read intent log: %w", err)
+	}
+	return intents, nil
+}
+
+// Replay completes or rolls back the intents left in the log by an earlier run and returns the number of
+// completed and rolled back intents. Intents that fail are kept in the log.
+func (l *IntentLog) Replay() (completed int, rolledBack int, err error) {
+	intents, err := l.Pending()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var failed int
+	for _, intent := range intents {
+		logger := log.With().Str("intentId", intent.Id).Str("key", intent.Key).Str("seedId", intent.SeedId).
+			Str("stage", intent.Stage.String()).Logger()
+
+		seedCreated := intent.Stage >= IntentSeedCreated
+		if !seedCreated {
+			// the seed may have been created without the log knowing it
+			seedCreated, err = ObjectExists(l.Client, configV1.Kind_seed, intent.SeedId)
+			if err != nil {
+				failed++
+				logger.Error().Err(err).Msg("Failed to replay intent")
+				continue
+			}
+		}
+
+		if seedCreated {
+			err = l.complete(intent)
+		} else {
+			err = l.rollback(intent)
+		}
+		switch {
+		case err != nil:
+			failed++
+			logger.Error().Err(err).Msg("Failed to replay intent")
+		case seedCreated:
+			completed++
+			logger.Info().Msg("Completed unfinished seed creation")
+		default:
+			rolledBack++
+			logger.Info().Msg("Rolled back unfinished seed creation")
+		}
+	}
+	if failed > 0 {
+		return completed, rolledBack, fmt.Errorf("failed to replay %d of %d intents", failed, len(intents))
+	}
+	return completed, rolledBack, nil
+}
+
+// complete updates the state dbs with the created objects and removes the intent.
+func (l *IntentLog) complete(intent *Intent) error {
+	if intent.NewEntity {
+		if _, _, err := l.EntityDb.Set(intent.EntityName, intent.EntityId); err != nil {
+			return fmt.Errorf("failed to save new entity to import db: %w", err)
+		}
+	}
+	if _, _, err := l.SeedDb.Set(intent.Key, intent.SeedId); err != nil {
+		return fmt.Errorf("failed to save new seed to import db: %w", err)
+	}
+	return l.advance(intent, IntentCommitted)
+}
+
+// rollback deletes the objects the intent may have created and removes the intent.
+func (l *IntentLog) rollback(intent *Intent) error {
+	if err := l.deleteObject(configV1.Kind_seed, intent.SeedId); err != nil {
+		return fmt.Errorf("failed to delete seed '%s' from Veidemann: %w", intent.SeedId, err)
+	}
+	if err := l.SeedDb.Delete(intent.Key, intent.SeedId); err != nil {
+		return err
+	}
+	if intent.NewEntity {
+		// Remove the entity from the entity db first, so no more seeds are attached to it
+		if err := l.EntityDb.Delete(intent.EntityName, intent.EntityId); err != nil {
+			return err
+		}
+		// Seeds may have been attached to the entity while it was in the entity db, e.g. if an earlier
+		// rollback failed after the entity was created. Those seeds keep the entity.
+		n, err := l.countSeeds(intent.EntityId)
+		if err != nil {
+			return fmt.Errorf("failed to count seeds of entity '%s': %w", intent.EntityId, err)
+		}
+		if n > 0 {
+			if _, _, err := l.EntityDb.Set(intent.EntityName, intent.EntityId); err != nil {
+				return fmt.Errorf("failed to save entity to import db: %w", err)
+			}
+			log.Warn().Str("intentId", intent.Id).Str("entityId", intent.EntityId).Int64("seeds", n).
+				Msg("Kept entity of rolled back seed creation, it has other seeds")
+		} else if err := l.deleteObject(configV1.Kind_crawlEntity, intent.EntityId); err != nil {
+			return fmt.Errorf("failed to delete entity '%s' from Veidemann: %w", intent.EntityId, err)
+		}
+	}
+	return l.remove(intent)
+}
+
+// countSeeds returns the number of seeds of the entity in Veidemann.
+func (l *IntentLog) countSeeds(entityId string) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req := &configV1.ListRequest{
+		Kind: configV1.Kind_seed,
+		QueryTemplate: &configV1.ConfigObject{
+			Spec: &configV1.ConfigObject_Seed{Seed: &configV1.Seed{
+				EntityRef: &configV1.ConfigRef{Kind: configV1.Kind_crawlEntity, Id: entityId},
+			}},
+		},
+		QueryMask: &commonsV1.FieldMask{Paths: []string{"seed.entityRef"}},
+	}
+	res, err := l.Client.CountConfigObjects(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	return res.GetCount(), nil
+}
+
+// advance moves the intent to the stage. A committed intent is removed from the log.
+func (l *IntentLog) advance(intent *Intent, stage IntentStage) error {
+	intent.Stage = stage
+	if stage == IntentCommitted {
+		return l.remove(intent)
+	}
+	return l.save(intent)
+}
+
+func (l *IntentLog) save(intent *Intent) error {
+	b, err := json.Marshal(intent)
+	if err == nil {
+		err = l.SeedDb.store.Set([]byte(intentKeyPrefix+intent.Id), b)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write intent log: %w", err)
+	}
+	return nil
+}
+
+func (l *IntentLog) remove(intent *Intent) error {
+	if err := l.SeedDb.store.Delete([]byte(intentKeyPrefix + intent.Id)); err != nil {
+		return fmt.Errorf("failed to write intent log: %w", err)
+	}
+	return nil
+}
+
+// saveObject saves the object with the id chosen by the intent. Rolling back relies on the id, so an object
+// saved with another id is deleted again and an error is returned.
+func (l *IntentLog) saveObject(obj *configV1.ConfigObject) (*configV1.ConfigObject, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	saved, err := l.Client.SaveConfigObject(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	if saved.GetId() != obj.GetId() {
+		if err := l.deleteObject(obj.GetKind(), saved.GetId()); err != nil {
+			log.Error().Err(err).Str("kind", obj.GetKind().String()).Str("id", saved.GetId()).Msg("Failed to delete object saved with unexpected id")
+		}
+		return nil, fmt.Errorf("veidemann saved %s with id '%s' instead of '%s'", obj.GetKind().String(), saved.GetId(), obj.GetId())
+	}
+	return saved, nil
+}
+
+// deleteObject deletes the object from Veidemann. A missing object is not an error.
+func (l *IntentLog) deleteObject(kind configV1.Kind, id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := l.Client.DeleteConfigObject(ctx, &configV1.ConfigObject{ApiVersion: "v1", Kind: kind, Id: id})
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
+
+// ObjectExists returns true if the object exists in Veidemann.
+func ObjectExists(client configV1.ConfigClient, kind configV1.Kind, id string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	obj, err := client.GetConfigObject(ctx, &configV1.ConfigRef{Kind: kind, Id: id})
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return obj.GetId() != "", nil
+}
+
+// newObjectId returns a random (version 4) UUID, the form of ids Veidemann gives new objects.
+func newObjectId() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
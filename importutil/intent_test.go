@@ -0,0 +1,260 @@
+package importutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeObjectClient saves, gets and deletes config objects in a map
+type fakeObjectClient struct {
+	configV1.ConfigClient
+	objects map[string]*configV1.ConfigObject
+	// failSeed makes saving seeds fail after the seed is stored, like a timeout
+	failSeed bool
+	// failDelete makes deleting objects fail
+	failDelete bool
+	// assignIds makes the client save objects with ids of its own
+	assignIds bool
+}
+
+func (c *fakeObjectClient) SaveConfigObject(_ context.Context, o *configV1.ConfigObject, _ ...grpc.CallOption) (*configV1.ConfigObject, error) {
+	if c.assignIds {
+		o = proto.Clone(o).(*configV1.ConfigObject)
+		o.Id = fmt.Sprintf("assigned-%d", len(c.objects))
+	}
+	c.objects[o.GetId()] = o
+	if c.failSeed && o.GetKind() == configV1.Kind_seed {
+		return nil, errors.New("timeout")
+	}
+	return o, nil
+}
+
+func (c *fakeObjectClient) GetConfigObject(_ context.Context, ref *configV1.ConfigRef, _ ...grpc.CallOption) (*configV1.ConfigObject, error) {
+	if o, ok := c.objects[ref.GetId()]; ok {
+		return o, nil
+	}
+	return nil, status.Error(codes.NotFound, "not found")
+}
+
+func (c *fakeObjectClient) CountConfigObjects(_ context.Context, req *configV1.ListRequest, _ ...grpc.CallOption) (*configV1.ListCountResponse, error) {
+	var count int64
+	for _, o := range c.objects {
+		if o.GetKind() == req.GetKind() &&
+			o.GetSeed().GetEntityRef().GetId() == req.GetQueryTemplate().GetSeed().GetEntityRef().GetId() {
+			count++
+		}
+	}
+	return &configV1.ListCountResponse{Count: count}, nil
+}
+
+func (c *fakeObjectClient) DeleteConfigObject(_ context.Context, o *configV1.ConfigObject, _ ...grpc.CallOption) (*configV1.DeleteResponse, error) {
+	if c.failDelete {
+		return nil, errors.New("unavailable")
+	}
+	_, ok := c.objects[o.GetId()]
+	delete(c.objects, o.GetId())
+	return &configV1.DeleteResponse{Deleted: ok}, nil
+}
+
+func newTestIntentLog(t *testing.T) (*IntentLog, *fakeObjectClient) {
+	entityDb, err := NewImportDb(InMemory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedDb, err := NewImportDb(InMemory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &fakeObjectClient{objects: make(map[string]*configV1.ConfigObject)}
+	return &IntentLog{Client: client, EntityDb: entityDb, SeedDb: seedDb}, client
+}
+
+func assertIds(t *testing.T, db *ImportDb, key string, want []string) {
+	t.Helper()
+	got, err := db.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get(%q) = %v, want %v", key, got, want)
+	}
+}
+
+func assertNoPending(t *testing.T, l *IntentLog) {
+	t.Helper()
+	pending, err := l.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("Pending() = %v, want none", pending)
+	}
+}
+
+func TestIntentLogCreate(t *testing.T) {
+	l, client := newTestIntentLog(t)
+
+	sd := &SeedDesc{EntityName: "Example", Uri: "https://example.com/"}
+	seed, entity, err := l.Create("example.com/", sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entity == nil || seed.GetSeed().GetEntityRef().GetId() != entity.GetId() {
+		t.Fatalf("Create() returned seed %v and entity %v, want seed of new entity", seed, entity)
+	}
+	if len(client.objects) != 2 {
+		t.Errorf("Got %d objects in Veidemann, want 2", len(client.objects))
+	}
+	assertIds(t, l.EntityDb, "Example", []string{entity.GetId()})
+	assertIds(t, l.SeedDb, "example.com/", []string{seed.GetId()})
+	assertNoPending(t, l)
+
+	// A seed of an existing entity
+	sd = &SeedDesc{EntityId: entity.GetId(), EntityName: "Example", Uri: "https://example.com/news/"}
+	seed, newEntity, err := l.Create("example.com/news/", sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newEntity != nil {
+		t.Errorf("Create() created entity %v for seed of existing entity", newEntity)
+	}
+	assertIds(t, l.SeedDb, "example.com/news/", []string{seed.GetId()})
+	assertIds(t, l.EntityDb, "Example", []string{entity.GetId()})
+}
+
+func TestIntentLogCreateRollback(t *testing.T) {
+	l, client := newTestIntentLog(t)
+	client.failSeed = true
+
+	sd := &SeedDesc{EntityName: "Example", Uri: "https://example.com/"}
+	if _, _, err := l.Create("example.com/", sd); err == nil {
+		t.Fatal("Expected error creating seed")
+	}
+	if len(client.objects) != 0 {
+		t.Errorf("Got objects %v in Veidemann after rollback, want none", client.objects)
+	}
+	assertIds(t, l.EntityDb, "Example", nil)
+	assertIds(t, l.SeedDb, "example.com/", nil)
+	assertNoPending(t, l)
+}
+
+func TestIntentLogCreateIdNotKept(t *testing.T) {
+	l, client := newTestIntentLog(t)
+	client.assignIds = true
+
+	sd := &SeedDesc{EntityName: "Example", Uri: "https://example.com/"}
+	if _, _, err := l.Create("example.com/", sd); err == nil {
+		t.Fatal("Expected error when Veidemann does not keep the chosen id")
+	}
+	if len(client.objects) != 0 {
+		t.Errorf("Got objects %v in Veidemann, want none", client.objects)
+	}
+	assertIds(t, l.EntityDb, "Example", nil)
+	assertNoPending(t, l)
+}
+
+func TestIntentLogRollbackKeepsEntityWithSeeds(t *testing.T) {
+	l, client := newTestIntentLog(t)
+
+	// Creating the seed fails, and so does the rollback, leaving the new entity in the entity db
+	client.failSeed = true
+	client.failDelete = true
+	sd := &SeedDesc{EntityName: "Example", Uri: "https://example.com/"}
+	if _, _, err := l.Create("example.com/", sd); err == nil {
+		t.Fatal("Expected error creating seed")
+	}
+	entityIds, err := l.EntityDb.Get("Example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entityIds) != 1 {
+		t.Fatalf("Get(%q) = %v, want the new entity", "Example", entityIds)
+	}
+	entityId := entityIds[0]
+	// The seed never reached Veidemann
+	for id, o := range client.objects {
+		if o.GetKind() == configV1.Kind_seed {
+			delete(client.objects, id)
+		}
+	}
+
+	// A later seed is attached to the entity
+	client.failSeed = false
+	client.failDelete = false
+	sd = &SeedDesc{EntityId: entityId, EntityName: "Example", Uri: "https://example.com/news/"}
+	seed, _, err := l.Create("example.com/news/", sd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	completed, rolledBack, err := l.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed != 0 || rolledBack != 1 {
+		t.Errorf("Replay() = %d completed, %d rolled back, want 0 and 1", completed, rolledBack)
+	}
+	assertNoPending(t, l)
+	if _, ok := client.objects[entityId]; !ok {
+		t.Error("Entity with seeds deleted from Veidemann")
+	}
+	assertIds(t, l.EntityDb, "Example", []string{entityId})
+	assertIds(t, l.SeedDb, "example.com/news/", []string{seed.GetId()})
+}
+
+func TestIntentLogReplay(t *testing.T) {
+	l, client := newTestIntentLog(t)
+
+	entity := &configV1.ConfigObject{Id: "e1", Kind: configV1.Kind_crawlEntity}
+	seed := &configV1.ConfigObject{Id: "s2", Kind: configV1.Kind_seed}
+	client.objects["e1"] = entity
+	client.objects["e2"] = &configV1.ConfigObject{Id: "e2", Kind: configV1.Kind_crawlEntity}
+	client.objects["s2"] = seed
+	client.objects["s3"] = &configV1.ConfigObject{Id: "s3", Kind: configV1.Kind_seed}
+
+	intents := []*Intent{
+		// crashed before anything was created
+		{Id: "1", Stage: IntentStarted, Key: "a/", SeedId: "s0", EntityName: "A", EntityId: "e0", NewEntity: true},
+		// crashed after the entity was created
+		{Id: "2", Stage: IntentEntityCreated, Key: "b/", SeedId: "s1", EntityName: "B", EntityId: "e1", NewEntity: true},
+		// crashed after the seed was created, but before it was logged
+		{Id: "3", Stage: IntentEntityCreated, Key: "c/", SeedId: "s2", EntityName: "C", EntityId: "e2", NewEntity: true},
+		// crashed before the state dbs were updated
+		{Id: "4", Stage: IntentSeedCreated, Key: "d/", SeedId: "s3", EntityName: "D", EntityId: "e3"},
+	}
+	for _, intent := range intents {
+		if err := l.save(intent); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := l.EntityDb.Set("B", "e1"); err != nil {
+		t.Fatal(err)
+	}
+
+	completed, rolledBack, err := l.Replay()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if completed != 2 || rolledBack != 2 {
+		t.Errorf("Replay() = %d completed, %d rolled back, want 2 and 2", completed, rolledBack)
+	}
+	assertNoPending(t, l)
+
+	if _, ok := client.objects["e1"]; ok {
+		t.Error("Entity of rolled back intent not deleted from Veidemann")
+	}
+	assertIds(t, l.EntityDb, "B", nil)
+	assertIds(t, l.EntityDb, "C", []string{"e2"})
+	assertIds(t, l.SeedDb, "c/", []string{"s2"})
+	assertIds(t, l.EntityDb, "D", nil)
+	assertIds(t, l.SeedDb, "d/", []string{"s3"})
+}
@@ -0,0 +1,86 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"sort"
+	"sync"
+)
+
+// KeyLocks is a set of mutexes, one for each key in use.
+// The zero value is ready to use.
+type KeyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is the mutex of a key and the number of goroutines holding or waiting for it.
+type keyLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock locks the keys and returns a function unlocking them.
+//
+// Keys are locked in sorted order, so goroutines locking overlapping sets of keys do not deadlock.
+// Duplicate keys are locked once.
+func (l *KeyLocks) Lock(keys ...string) (unlock func()) {
+	keys = append([]string(nil), keys...)
+	sort.Strings(keys)
+
+	var held []string
+	for i, key := range keys {
+		if i > 0 && key == keys[i-1] {
+			continue
+		}
+		l.acquire(key).Lock()
+		held = append(held, key)
+	}
+
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			l.release(held[i])
+		}
+	}
+}
+
+// acquire returns the mutex of the key, creating it if needed.
+func (l *KeyLocks) acquire(key string) *keyLock {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.locks == nil {
+		l.locks = make(map[string]*keyLock)
+	}
+	k, ok := l.locks[key]
+	if !ok {
+		k = &keyLock{}
+		l.locks[key] = k
+	}
+	k.refs++
+	return k
+}
+
+// release unlocks the mutex of the key and forgets it when no one else uses it.
+func (l *KeyLocks) release(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	k := l.locks[key]
+	k.Unlock()
+	k.refs--
+	if k.refs == 0 {
+		delete(l.locks, key)
+	}
+}
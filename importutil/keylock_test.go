@@ -0,0 +1,51 @@
+package importutil
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyLocks(t *testing.T) {
+	var locks KeyLocks
+
+	// Overlapping keys in different order must not deadlock
+	var wg sync.WaitGroup
+	counters := map[string]int{}
+	for i := 0; i < 100; i++ {
+		keys := []string{"a", "b"}
+		if i%2 == 0 {
+			keys = []string{"b", "a", "b"}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := locks.Lock(keys...)
+			defer unlock()
+			for _, k := range keys {
+				counters[k]++
+			}
+		}()
+	}
+	wg.Wait()
+	if counters["a"] != 100 || counters["b"] != 150 {
+		t.Errorf("Got counters %v, want a=100 and b=150", counters)
+	}
+	if len(locks.locks) != 0 {
+		t.Errorf("Got %d locks after unlocking all keys, want 0", len(locks.locks))
+	}
+
+	// Different keys do not block each other
+	unlock := locks.Lock("a")
+	done := make(chan struct{})
+	go func() {
+		locks.Lock("c")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Lock of other key blocked")
+	}
+	unlock()
+}
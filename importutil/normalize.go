@@ -18,8 +18,17 @@ package importutil
 
 import (
 	"errors"
+	"fmt"
+	"net"
 	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+
+	"golang.org/x/net/idna"
+	"gopkg.in/yaml.v3"
 )
 
 type UriKeyNormalizer struct {
@@ -27,6 +36,17 @@ type UriKeyNormalizer struct {
 	Toplevel bool
 	// IgnoreScheme will ignore the scheme when normalizing
 	IgnoreScheme bool
+	// Rules are additional canonicalization rules applied before Toplevel and IgnoreScheme
+	Rules *UriRules
+}
+
+// String describes the normalizer. Keys normalized by normalizers with the same description are equal.
+func (u *UriKeyNormalizer) String() string {
+	var rules string
+	if u.Rules != nil {
+		rules = u.Rules.String()
+	}
+	return fmt.Sprintf("uri toplevel=%t ignoreScheme=%t rules=%s", u.Toplevel, u.IgnoreScheme, rules)
 }
 
 func (u *UriKeyNormalizer) Normalize(s string) (string, error) {
@@ -42,6 +62,12 @@ func (u *UriKeyNormalizer) Normalize(s string) (string, error) {
 		return "", errors.New("missing hostname")
 	}
 
+	if u.Rules != nil {
+		if err := u.Rules.Apply(uri); err != nil {
+			return "", err
+		}
+	}
+
 	if u.Toplevel {
 		uri.Path = "/"
 		uri.RawQuery = ""
@@ -51,9 +77,266 @@ func (u *UriKeyNormalizer) Normalize(s string) (string, error) {
 		uri.Path = "/"
 	}
 
+	if u.Rules != nil && u.Rules.surt {
+		return Surt(uri), nil
+	}
+
 	if u.IgnoreScheme {
 		uri.Scheme = ""
 	}
 
 	return uri.String(), nil
 }
+
+// UriRule is a canonicalization rule applied to a parsed uri.
+type UriRule interface {
+	Apply(uri *url.URL) error
+}
+
+// UriRuleFunc is a function implementing UriRule.
+type UriRuleFunc func(uri *url.URL) error
+
+func (f UriRuleFunc) Apply(uri *url.URL) error {
+	return f(uri)
+}
+
+// UriRules is a chain of canonicalization rules.
+type UriRules struct {
+	rules []UriRule
+	// surt is set if keys should be formatted as SURT
+	surt bool
+	// names are the names and arguments of the rules, used to describe the rules
+	names []string
+}
+
+// String describes the rules, e.g. "strip-www,drop-params(utm_*),surt".
+func (r *UriRules) String() string {
+	return strings.Join(r.names, ",")
+}
+
+// rulesFile is the format of a rules file.
+type rulesFile struct {
+	Rules []yaml.Node `yaml:"rules"`
+}
+
+// LoadUriRules reads canonicalization rules from a YAML file on the following format:
+//
+//	rules:
+//	  - strip-www
+//	  - strip-default-port
+//	  - strip-index: [index.html, index.php]
+//	  - drop-params: [utm_*, fbclid]
+//	  - sort-query
+//	  - surt
+//
+// Rules are applied in the given order. The surt rule must be the last rule.
+func LoadUriRules(filename string) (*UriRules, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %w", err)
+	}
+	rules, err := ParseUriRules(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rules file '%s': %w", filename, err)
+	}
+	return rules, nil
+}
+
+// ParseUriRules parses canonicalization rules. See LoadUriRules for the format.
+func ParseUriRules(b []byte) (*UriRules, error) {
+	var f rulesFile
+	if err := yaml.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+
+	r := &UriRules{}
+	for i, node := range f.Rules {
+		if r.surt {
+			return nil, errors.New("surt must be the last rule")
+		}
+
+		var name string
+		var args []string
+		switch node.Kind {
+		case yaml.ScalarNode:
+			name = node.Value
+		case yaml.MappingNode:
+			if len(node.Content) != 2 {
+				return nil, fmt.Errorf("rule %d: expected a single rule name", i+1)
+			}
+			name = node.Content[0].Value
+			switch value := node.Content[1]; value.Kind {
+			case yaml.ScalarNode:
+				args = []string{value.Value}
+			case yaml.SequenceNode:
+				if err := value.Decode(&args); err != nil {
+					return nil, fmt.Errorf("rule %d (%s): %w", i+1, name, err)
+				}
+			default:
+				return nil, fmt.Errorf("rule %d (%s): expected a value or a list of values", i+1, name)
+			}
+		default:
+			return nil, fmt.Errorf("rule %d: expected a rule name", i+1)
+		}
+
+		if len(args) > 0 {
+			r.names = append(r.names, name+"("+strings.Join(args, " ")+")")
+		} else {
+			r.names = append(r.names, name)
+		}
+
+		if name == "surt" {
+			r.surt = true
+			continue
+		}
+		rule, err := newUriRule(name, args)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		r.rules = append(r.rules, rule)
+	}
+	return r, nil
+}
+
+// UriRuleNames are the names of the canonicalization rules.
+var UriRuleNames = []string{"strip-www", "strip-default-port", "strip-trailing-slash", "strip-index", "sort-query", "drop-params", "punycode", "surt"}
+
+// NormalizerRulesUsage is the usage of the flag for a canonicalization rules file shared by the import commands.
+var NormalizerRulesUsage = "YAML file with URL canonicalization rules applied when creating keys (" + strings.Join(UriRuleNames, ", ") + ")"
+
+// defaultIndexFiles are the file names removed by the strip-index rule when none are given.
+var defaultIndexFiles = []string{"index.html", "index.htm", "index.php", "index.asp", "default.asp", "default.aspx"}
+
+// wwwPrefix matches www prefixes like www. and www2.
+var wwwPrefix = regexp.MustCompile(`^www\d*\.`)
+
+// newUriRule creates a rule by name.
+func newUriRule(name string, args []string) (UriRule, error) {
+	switch name {
+	case "strip-www":
+		return UriRuleFunc(func(uri *url.URL) error {
+			uri.Host = wwwPrefix.ReplaceAllString(uri.Host, "")
+			return nil
+		}), nil
+	case "strip-default-port":
+		return UriRuleFunc(func(uri *url.URL) error {
+			port := uri.Port()
+			if (uri.Scheme == "http" && port == "80") || (uri.Scheme == "https" && port == "443") {
+				uri.Host = uri.Hostname()
+			}
+			return nil
+		}), nil
+	case "strip-trailing-slash":
+		return UriRuleFunc(func(uri *url.URL) error {
+			if len(uri.Path) > 1 {
+				uri.Path = strings.TrimRight(uri.Path, "/")
+				uri.RawPath = ""
+			}
+			return nil
+		}), nil
+	case "strip-index":
+		files := args
+		if len(files) == 0 {
+			files = defaultIndexFiles
+		}
+		return UriRuleFunc(func(uri *url.URL) error {
+			i := strings.LastIndex(uri.Path, "/")
+			for _, file := range files {
+				if strings.EqualFold(uri.Path[i+1:], file) {
+					uri.Path = uri.Path[:i+1]
+					uri.RawPath = ""
+					break
+				}
+			}
+			return nil
+		}), nil
+	case "sort-query":
+		return UriRuleFunc(func(uri *url.URL) error {
+			if uri.RawQuery == "" {
+				return nil
+			}
+			params := strings.Split(uri.RawQuery, "&")
+			sort.Strings(params)
+			uri.RawQuery = strings.Join(params, "&")
+			return nil
+		}), nil
+	case "drop-params":
+		if len(args) == 0 {
+			return nil, errors.New("drop-params: missing parameter names")
+		}
+		for _, pattern := range args {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("drop-params: invalid pattern '%s': %w", pattern, err)
+			}
+		}
+		return UriRuleFunc(func(uri *url.URL) error {
+			if uri.RawQuery == "" {
+				return nil
+			}
+			var kept []string
+			for _, param := range strings.Split(uri.RawQuery, "&") {
+				key, _, _ := strings.Cut(param, "=")
+				if k, err := url.QueryUnescape(key); err == nil {
+					key = k
+				}
+				if match, _ := matchAny(args, key); !match {
+					kept = append(kept, param)
+				}
+			}
+			uri.RawQuery = strings.Join(kept, "&")
+			uri.ForceQuery = false
+			return nil
+		}), nil
+	case "punycode":
+		return UriRuleFunc(func(uri *url.URL) error {
+			host, err := idna.Lookup.ToASCII(uri.Hostname())
+			if err != nil {
+				return fmt.Errorf("failed to convert host to punycode: %w", err)
+			}
+			if port := uri.Port(); port != "" {
+				host = net.JoinHostPort(host, port)
+			}
+			uri.Host = host
+			return nil
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown rule: %s", name)
+	}
+}
+
+// Apply applies the rules in order.
+func (r *UriRules) Apply(uri *url.URL) error {
+	for _, rule := range r.rules {
+		if err := rule.Apply(uri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Surt returns the Sort-friendly URI Reordering Transform of the uri, e.g. "com,example,www)/path?query".
+// The scheme, user info and fragment are not part of the result.
+func Surt(uri *url.URL) string {
+	labels := strings.Split(strings.ToLower(uri.Hostname()), ".")
+	for i, j := 0, len(labels)-1; i < j; i, j = i+1, j-1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Join(labels, ","))
+	if port := uri.Port(); port != "" {
+		b.WriteString(":")
+		b.WriteString(port)
+	}
+	b.WriteString(")")
+	if p := uri.EscapedPath(); p != "" {
+		b.WriteString(p)
+	} else {
+		b.WriteString("/")
+	}
+	if uri.RawQuery != "" {
+		b.WriteString("?")
+		b.WriteString(uri.RawQuery)
+	}
+	return b.String()
+}
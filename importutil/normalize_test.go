@@ -142,3 +142,87 @@ func Test_UriKeyNormalizer_ignoreSchemeFlag(t *testing.T) {
 		})
 	}
 }
+
+func Test_UriKeyNormalizer_rules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		uri     string
+		wantKey string
+		wantErr bool
+	}{
+		{"strip-www", "rules: [strip-www]", "http://www.example.com/", "http://example.com/", false},
+		{"strip-www numbered", "rules: [strip-www]", "http://WWW2.example.com/foo", "http://example.com/foo", false},
+		{"strip-www only prefix", "rules: [strip-www]", "http://foo.www.example.com/", "http://foo.www.example.com/", false},
+		{"strip-default-port http", "rules: [strip-default-port]", "http://www.example.com:80/", "http://www.example.com/", false},
+		{"strip-default-port https", "rules: [strip-default-port]", "https://www.example.com:443/", "https://www.example.com/", false},
+		{"strip-default-port other", "rules: [strip-default-port]", "http://www.example.com:8080/", "http://www.example.com:8080/", false},
+		{"strip-trailing-slash", "rules: [strip-trailing-slash]", "http://www.example.com/foo/", "http://www.example.com/foo", false},
+		{"strip-trailing-slash root", "rules: [strip-trailing-slash]", "http://www.example.com/", "http://www.example.com/", false},
+		{"strip-index default", "rules: [strip-index]", "http://www.example.com/foo/index.html", "http://www.example.com/foo/", false},
+		{"strip-index configured", "rules: [{strip-index: [home.html]}]", "http://www.example.com/Home.html", "http://www.example.com/", false},
+		{"strip-index other file", "rules: [strip-index]", "http://www.example.com/about.html", "http://www.example.com/about.html", false},
+		{"sort-query", "rules: [sort-query]", "http://www.example.com/?b=2&a=1", "http://www.example.com/?a=1&b=2", false},
+		{"drop-params", "rules: [{drop-params: [utm_*, fbclid]}]", "http://www.example.com/?utm_source=x&id=1&fbclid=y&utm_medium=z", "http://www.example.com/?id=1", false},
+		{"drop-params all", "rules: [{drop-params: utm_*}]", "http://www.example.com/?utm_source=x", "http://www.example.com/", false},
+		{"punycode", "rules: [punycode]", "http://bücher.example/", "http://xn--bcher-kva.example/", false},
+		{"punycode port", "rules: [punycode]", "http://bücher.example:8080/", "http://xn--bcher-kva.example:8080/", false},
+		{"surt", "rules: [surt]", "https://www.example.com/foo?q=1#hash", "com,example,www)/foo?q=1", false},
+		{"surt port", "rules: [surt]", "http://www.example.com:8080", "com,example,www:8080)/", false},
+		{
+			name:    "chain",
+			rules:   "rules: [strip-www, strip-default-port, strip-index, strip-trailing-slash, {drop-params: [utm_*]}, sort-query, punycode, surt]",
+			uri:     "https://www.Bücher.example:443/shop/index.html?utm_campaign=a&z=1&a=2",
+			wantKey: "example,xn--bcher-kva)/shop?a=2&z=1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseUriRules([]byte(tt.rules))
+			if err != nil {
+				t.Fatalf("ParseUriRules() error = %v", err)
+			}
+			n := &UriKeyNormalizer{Rules: rules}
+			got, err := n.Normalize(tt.uri)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Normalize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.wantKey {
+				t.Errorf("Normalize() key = %v, want %v", got, tt.wantKey)
+			}
+		})
+	}
+}
+
+func Test_ParseUriRules_errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{"unknown rule", "rules: [foo]"},
+		{"surt not last", "rules: [surt, strip-www]"},
+		{"drop-params without names", "rules: [drop-params]"},
+		{"invalid pattern", "rules: [{drop-params: ['[']}]"},
+		{"multiple names", "rules: [{strip-index: [a], drop-params: [b]}]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseUriRules([]byte(tt.rules)); err == nil {
+				t.Error("ParseUriRules() expected error")
+			}
+		})
+	}
+}
+
+func Test_UriRuleNames(t *testing.T) {
+	// Every documented rule must be known
+	for _, name := range UriRuleNames {
+		rule := name
+		if name == "drop-params" {
+			rule = name + ": utm_*"
+		}
+		if _, err := ParseUriRules([]byte("rules:\n  - " + rule + "\n")); err != nil {
+			t.Errorf("rule %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nlnwa/veidemannctl/logger"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/term"
+)
+
+// InputProgress is implemented by record readers that know how much of their input has been read.
+type InputProgress interface {
+	// InputProgress returns how much of the input has been read and the size of the input in the same unit,
+	// e.g. bytes or records. The size is 0 when unknown.
+	InputProgress() (read int64, size int64)
+}
+
+// Progress reports the progress of a long-running operation on stderr.
+//
+// When stderr is a terminal a progress bar is redrawn a few times per second, and log output is redirected
+// to clear the bar before each log line. Otherwise, a log line is written every LogInterval.
+// Nothing is shown for operations completing within Delay.
+//
+// The fraction done is computed from the total number of records if known (see SetTotal), otherwise from
+// the input if it reports its progress (see SetInput).
+type Progress struct {
+	// Name of the operation
+	Name string
+	// Delay is how long to wait before showing progress
+	Delay time.Duration
+	// LogInterval is the interval between log lines when stderr is not a terminal
+	LogInterval time.Duration
+
+	out     io.Writer
+	tty     bool
+	width   func() int
+	refresh time.Duration
+
+	total   atomic.Int64
+	input   InputProgress
+	stats   func() (count int, success int, failed int)
+	success atomic.Int64
+	failed  atomic.Int64
+	read    atomic.Int64
+	last    atomic.Pointer[State]
+
+	mu      sync.Mutex
+	start   time.Time
+	started bool
+	drawn   bool
+	shown   bool
+	restore func()
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewProgress creates a progress reporter for the named operation writing to stderr.
+func NewProgress(name string) *Progress {
+	fd := int(os.Stderr.Fd())
+	return &Progress{
+		Name:        name,
+		Delay:       2 * time.Second,
+		LogInterval: 30 * time.Second,
+		out:         os.Stderr,
+		tty:         term.IsTerminal(fd),
+		width: func() int {
+			if w, _, err := term.GetSize(fd); err == nil && w > 0 {
+				return w
+			}
+			return 80
+		},
+		refresh: 200 * time.Millisecond,
+	}
+}
+
+// SetTotal sets the total number of records, when known in advance.
+func (p *Progress) SetTotal(n int) {
+	p.total.Store(int64(n))
+}
+
+// SetInput sets the input to compute the fraction done from when the total number of records is unknown.
+// It must be called before Start.
+func (p *Progress) SetInput(input InputProgress) {
+	p.input = input
+}
+
+// SetStats sets the function counting completed records, e.g. Executor.Stats, instead of counting calls to Done.
+// It must be called before Start.
+func (p *Progress) SetStats(stats func() (count int, success int, failed int)) {
+	p.stats = stats
+}
+
+// Read registers that the record with the given state has been read.
+func (p *Progress) Read(state *State) {
+	p.read.Add(1)
+	p.last.Store(state)
+}
+
+// Done registers that a record has been processed, failing if err is not nil.
+func (p *Progress) Done(err error) {
+	if err == nil {
+		p.success.Add(1)
+	} else {
+		p.failed.Add(1)
+	}
+}
+
+// Start starts reporting progress.
+func (p *Progress) Start() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.started {
+		return
+	}
+	p.started = true
+	p.start = time.Now()
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	interval := p.LogInterval
+	if p.tty {
+		interval = p.refresh
+		p.restore = logger.Redirect(p.Writer(p.out))
+	}
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case now := <-ticker.C:
+				if now.Sub(p.start) < p.Delay {
+					continue
+				}
+				if p.tty {
+					p.mu.Lock()
+					p.draw(now)
+					p.mu.Unlock()
+				} else {
+					p.log(now)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops reporting progress. If a progress bar is shown it is drawn a final time and left on screen.
+func (p *Progress) Stop() {
+	p.mu.Lock()
+	started := p.started
+	p.mu.Unlock()
+	if !started {
+		return
+	}
+	p.once.Do(func() {
+		close(p.stop)
+		<-p.done
+
+		// restore log output before locking mu, since log writes wait for mu while redirected
+		if p.restore != nil {
+			p.restore()
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.shown {
+			p.draw(time.Now())
+			_, _ = fmt.Fprintln(p.out)
+			p.drawn = false
+		}
+	})
+}
+
+// Writer returns a writer which clears the progress bar before writing to w and redraws it afterwards.
+func (p *Progress) Writer(w io.Writer) io.Writer {
+	return &progressWriter{p: p, w: w}
+}
+
+type progressWriter struct {
+	p *Progress
+	w io.Writer
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	pw.p.mu.Lock()
+	defer pw.p.mu.Unlock()
+	shown := pw.p.drawn
+	pw.p.clear()
+	n, err := pw.w.Write(b)
+	if shown {
+		pw.p.draw(time.Now())
+	}
+	return n, err
+}
+
+// clear clears the line with the progress bar. It must be called with mu held.
+func (p *Progress) clear() {
+	if p.drawn {
+		_, _ = fmt.Fprint(p.out, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// draw draws the progress bar. It must be called with mu held.
+func (p *Progress) draw(now time.Time) {
+	_, _ = fmt.Fprint(p.out, "\r\033[K"+p.snapshot(now).bar(p.width()))
+	p.drawn = true
+	p.shown = true
+}
+
+// log writes a log line with the progress.
+func (p *Progress) log(now time.Time) {
+	s := p.snapshot(now)
+	e := log.Info().Str("operation", p.Name).Int64("done", s.done).Int64("failed", s.failed).
+		Str("rate", fmt.Sprintf("%.1f/s", s.rate)).Str("elapsed", s.elapsed.Round(time.Second).String())
+	if s.total > 0 {
+		e = e.Int64("total", s.total)
+	}
+	if s.fraction >= 0 {
+		e = e.Str("progress", fmt.Sprintf("%.0f%%", 100*s.fraction)).Str("eta", s.eta.String())
+	}
+	if s.filename != "" {
+		e = e.Str("filename", s.filename).Int("recNum", s.recNum)
+	}
+	e.Msg("Progress")
+}
+
+// progressSnapshot is the progress at some point in time.
+type progressSnapshot struct {
+	done     int64
+	failed   int64
+	total    int64
+	elapsed  time.Duration
+	rate     float64
+	fraction float64 // -1 if unknown
+	eta      time.Duration
+	filename string
+	recNum   int
+}
+
+func (p *Progress) snapshot(now time.Time) progressSnapshot {
+	s := progressSnapshot{
+		total:    p.total.Load(),
+		elapsed:  now.Sub(p.start),
+		fraction: -1,
+	}
+	if p.stats != nil {
+		count, _, failed := p.stats()
+		s.done, s.failed = int64(count), int64(failed)
+	} else {
+		s.failed = p.failed.Load()
+		s.done = p.success.Load() + s.failed
+	}
+	if secs := s.elapsed.Seconds(); secs > 0 {
+		s.rate = float64(s.done) / secs
+	}
+	if state := p.last.Load(); state != nil {
+		s.filename = state.GetFilename()
+		s.recNum = state.GetRecordNum()
+	}
+
+	if s.total > 0 {
+		s.fraction = float64(s.done) / float64(s.total)
+	} else if p.input != nil {
+		if read, size := p.input.InputProgress(); size > 0 {
+			s.fraction = float64(read) / float64(size)
+		}
+	}
+	if s.fraction > 1 {
+		s.fraction = 1
+	}
+	if s.fraction > 0 {
+		s.eta = (time.Duration(float64(s.elapsed) * (1 - s.fraction) / s.fraction)).Round(time.Second)
+	}
+	return s
+}
+
+// bar formats the progress to fit within width.
+func (s progressSnapshot) bar(width int) string {
+	parts := []string{fmt.Sprintf("%d", s.done)}
+	if s.total > 0 {
+		parts[0] = fmt.Sprintf("%d/%d", s.done, s.total)
+	}
+	if s.failed > 0 {
+		parts = append(parts, fmt.Sprintf("%d failed", s.failed))
+	}
+	parts = append(parts, fmt.Sprintf("%.1f rec/s", s.rate))
+	if s.fraction > 0 {
+		parts = append(parts, "ETA "+s.eta.String())
+	}
+	if s.filename != "" {
+		parts = append(parts, fmt.Sprintf("%s:%d", filepath.Base(s.filename), s.recNum))
+	}
+	text := strings.Join(parts, " | ")
+
+	if s.fraction >= 0 {
+		percent := fmt.Sprintf("%3.0f%% ", 100*s.fraction)
+		// leave room for the brackets and a space between bar and text
+		barWidth := width - len(percent) - len(text) - 4
+		if barWidth > 40 {
+			barWidth = 40
+		}
+		if barWidth >= 10 {
+			filled := int(s.fraction * float64(barWidth))
+			bar := strings.Repeat("=", filled)
+			if filled < barWidth {
+				bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+			}
+			text = "[" + bar + "] " + percent + text
+		} else {
+			text = percent + text
+		}
+	}
+	if width > 1 && len(text) >= width {
+		text = text[:width-1]
+	}
+	return text
+}
@@ -0,0 +1,161 @@
+package importutil
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nlnwa/veidemannctl/logger"
+)
+
+func TestProgressBar(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &Progress{start: start}
+	p.SetTotal(400)
+	for i := 0; i < 100; i++ {
+		var err error
+		if i%10 == 0 {
+			err = errors.New("failed")
+		}
+		p.Done(err)
+	}
+	p.Read(&State{fileName: "/tmp/seeds.csv", recNum: 120})
+
+	s := p.snapshot(start.Add(10 * time.Second))
+	if s.fraction != 0.25 || s.eta != 30*time.Second || s.rate != 10 {
+		t.Errorf("got fraction %v, eta %v and rate %v, want 0.25, 30s and 10", s.fraction, s.eta, s.rate)
+	}
+
+	want := "[==========>                             ]  25% 100/400 | 10 failed | 10.0 rec/s | ETA 30s | seeds.csv:120"
+	if got := s.bar(120); got != want {
+		t.Errorf("got bar\n%q, want\n%q", got, want)
+	}
+	// The bar is left out when there is no room for it
+	want = " 25% 100/400 | 10 failed | 10.0 rec/s | ETA 30s | seeds.csv:120"
+	if got := s.bar(70); got != want {
+		t.Errorf("got bar\n%q, want\n%q", got, want)
+	}
+	if got := s.bar(20); len(got) != 19 {
+		t.Errorf("got bar %q wider than terminal", got)
+	}
+}
+
+func TestProgressInput(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := &Progress{start: start}
+	p.SetInput(&seedUriReader{uris: []string{"a", "b", "c", "d"}})
+	s := p.snapshot(start.Add(time.Second))
+	if s.fraction != 0 || !strings.HasPrefix(s.bar(120), "[>") {
+		t.Errorf("got fraction %v and bar %q before reading", s.fraction, s.bar(120))
+	}
+
+	// Without a total or input the fraction is unknown
+	p = &Progress{start: start}
+	if s := p.snapshot(start.Add(time.Second)); s.fraction != -1 {
+		t.Errorf("got fraction %v, want unknown", s.fraction)
+	}
+}
+
+func TestProgressWriter(t *testing.T) {
+	var out bytes.Buffer
+	p := &Progress{out: &out, width: func() int { return 80 }, start: time.Now()}
+	w := p.Writer(&out)
+
+	// Nothing is cleared before the bar is drawn
+	_, _ = io.WriteString(w, "first\n")
+	p.draw(time.Now())
+	_, _ = io.WriteString(w, "second\n")
+
+	got := out.String()
+	if !strings.HasPrefix(got, "first\n\r\033[K0 | ") {
+		t.Errorf("got output %q", got)
+	}
+	// The bar is cleared before and redrawn after the log line
+	if !strings.Contains(got, "\r\033[Ksecond\n\r\033[K0 | ") {
+		t.Errorf("got output %q, want bar cleared and redrawn around log line", got)
+	}
+}
+
+func TestRecordReaderInputProgress(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "1\n2\n3\n", "b.txt": "4\n5\n", "c.json": "{}"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rr, err := NewRecordReader(dir, &LineAsStringDecoder{}, "*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read, size := rr.InputProgress(); read != 0 || size != 10 {
+		t.Errorf("got %d of %d bytes read before reading, want 0 of 10", read, size)
+	}
+	for {
+		var s string
+		if _, err := rr.Next(&s); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if read, _ := rr.InputProgress(); read == 0 {
+			t.Error("got no bytes read after reading a record")
+		}
+	}
+	if read, size := rr.InputProgress(); read != size {
+		t.Errorf("got %d of %d bytes read at end of input", read, size)
+	}
+}
+
+func TestProgressStartStop(t *testing.T) {
+	var out safeBuffer
+	p := &Progress{out: &out, tty: true, width: func() int { return 80 }, refresh: time.Millisecond}
+	p.Start()
+
+	// Log output is written through the progress bar while it runs
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_, _ = io.WriteString(logger.Stderr, "log line\n")
+			p.Done(nil)
+		}
+	}()
+	<-done
+	time.Sleep(10 * time.Millisecond)
+	p.Stop()
+	p.Stop()
+
+	got := out.String()
+	if !strings.Contains(got, "log line\n") {
+		t.Errorf("got output %q, want log lines", got)
+	}
+	// The final progress bar is left on its own line
+	if i := strings.LastIndex(got, "\r\033[K"); i < 0 || !strings.HasPrefix(got[i:], "\r\033[K100 | ") || !strings.HasSuffix(got, "\n") {
+		t.Errorf("got output %q, want final progress bar", got)
+	}
+}
+
+// safeBuffer is a bytes.Buffer safe for concurrent use
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,157 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a token bucket rate limiter holding at most one token, so requests are spread evenly.
+type tokenBucket struct {
+	mu sync.Mutex
+	// rate is the number of tokens added per second, 0 means unlimited
+	rate   float64
+	tokens float64
+	last   time.Time
+	// notBefore is the earliest time a token can be used
+	notBefore time.Time
+}
+
+func newTokenBucket(rate float64, now time.Time) *tokenBucket {
+	return &tokenBucket{rate: rate, tokens: 1, last: now}
+}
+
+// reserve takes a token and returns how long to wait before it can be used.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var wait time.Duration
+	if b.rate > 0 {
+		if now.After(b.last) {
+			b.tokens += now.Sub(b.last).Seconds() * b.rate
+			if b.tokens > 1 {
+				b.tokens = 1
+			}
+			b.last = now
+		}
+		b.tokens--
+		if b.tokens < 0 {
+			wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+		}
+	}
+	if d := b.notBefore.Sub(now); d > wait {
+		wait = d
+	}
+	return wait
+}
+
+// delay makes the bucket hand out no tokens before t.
+func (b *tokenBucket) delay(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if t.After(b.notBefore) {
+		b.notBefore = t
+	}
+}
+
+// RequestLimiter limits the rate of requests, both in total and per host.
+type RequestLimiter struct {
+	global   *tokenBucket
+	hostRate float64
+
+	mu    sync.Mutex
+	hosts map[string]*tokenBucket
+}
+
+// NewRequestLimiter creates a limiter allowing rate requests per second in total and hostRate
+// requests per second to each host. A rate of 0 means unlimited.
+func NewRequestLimiter(rate float64, hostRate float64) *RequestLimiter {
+	return &RequestLimiter{
+		global:   newTokenBucket(rate, time.Now()),
+		hostRate: hostRate,
+		hosts:    make(map[string]*tokenBucket),
+	}
+}
+
+// host returns the token bucket of a host.
+func (l *RequestLimiter) host(hostname string) *tokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.hosts[hostname]
+	if !ok {
+		b = newTokenBucket(l.hostRate, time.Now())
+		l.hosts[hostname] = b
+	}
+	return b
+}
+
+// Wait blocks until a request to the host is allowed or the context is done.
+func (l *RequestLimiter) Wait(ctx context.Context, hostname string) error {
+	// Wait for the host before taking a global token, so a busy host does not hold back other hosts
+	if err := sleep(ctx, l.host(hostname).reserve(time.Now())); err != nil {
+		return err
+	}
+	return sleep(ctx, l.global.reserve(time.Now()))
+}
+
+// Delay holds back requests to the host until t.
+func (l *RequestLimiter) Delay(hostname string, t time.Time) {
+	l.host(hostname).delay(t)
+}
+
+// sleep waits for the duration d or until the context is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// retryAfter returns the delay given by the Retry-After header of a response, which is either a number of
+// seconds or an HTTP date. It returns false if the header is missing or invalid.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	v := strings.TrimSpace(resp.Header.Get("Retry-After"))
+	if v == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
@@ -0,0 +1,96 @@
+package importutil
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRequestLimiter(t *testing.T) {
+	waitN := func(l *RequestLimiter, hosts ...string) time.Duration {
+		start := time.Now()
+		for _, host := range hosts {
+			if err := l.Wait(context.Background(), host); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return time.Since(start)
+	}
+
+	t.Run("per host", func(t *testing.T) {
+		l := NewRequestLimiter(0, 20)
+		if d := waitN(l, "a", "a", "a", "a", "a"); d < 190*time.Millisecond {
+			t.Errorf("Expected 5 requests to one host to take at least 200ms, took %s", d)
+		}
+		// another host is not held back
+		if d := waitN(l, "b"); d > 40*time.Millisecond {
+			t.Errorf("Expected request to other host to pass immediately, took %s", d)
+		}
+	})
+
+	t.Run("global", func(t *testing.T) {
+		l := NewRequestLimiter(20, 0)
+		if d := waitN(l, "a", "b", "c", "d", "e"); d < 190*time.Millisecond {
+			t.Errorf("Expected 5 requests to take at least 200ms, took %s", d)
+		}
+	})
+
+	t.Run("unlimited", func(t *testing.T) {
+		l := NewRequestLimiter(0, 0)
+		if d := waitN(l, "a", "a", "a", "a", "a"); d > 40*time.Millisecond {
+			t.Errorf("Expected unlimited requests to pass immediately, took %s", d)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		l := NewRequestLimiter(0, 0)
+		l.Delay("a", time.Now().Add(200*time.Millisecond))
+		if d := waitN(l, "b"); d > 40*time.Millisecond {
+			t.Errorf("Expected request to other host to pass immediately, took %s", d)
+		}
+		if d := waitN(l, "a"); d < 190*time.Millisecond {
+			t.Errorf("Expected delayed request to take at least 200ms, took %s", d)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		l := NewRequestLimiter(0, 0)
+		l.Delay("a", time.Now().Add(time.Hour))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := l.Wait(ctx, "a"); err == nil {
+			t.Error("Expected error when context is done")
+		}
+	})
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		wantOk bool
+	}{
+		{"missing", "", 0, false},
+		{"seconds", "120", 2 * time.Minute, true},
+		{"negative", "-1", 0, false},
+		{"date", now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{"past date", now.Add(-time.Hour).Format(http.TimeFormat), 0, true},
+		{"invalid", "soon", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.header != "" {
+				resp.Header.Set("Retry-After", tt.header)
+			}
+			got, ok := retryAfter(resp, now)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("retryAfter() = %s, %v, want %s, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
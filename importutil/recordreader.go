@@ -21,6 +21,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync/atomic"
 
 	"github.com/rs/zerolog/log"
 )
@@ -41,7 +42,16 @@ type recordReader struct {
 	dir           *os.File
 	curFileName   string
 	curRecNum     int
-	filePattern   string
+	filePatterns  []string
+
+	// input is the file being read, used to track how much of the input has been read
+	input *os.File
+	// size is the total size of the input files, or 0 when reading stdin
+	size int64
+	// readBytes is the size of the files read to the end
+	readBytes int64
+	// read is how much of the input has been read
+	read atomic.Int64
 }
 
 type RecordDecoder interface {
@@ -49,17 +59,21 @@ type RecordDecoder interface {
 	Read(v interface{}) (err error)
 }
 
-func NewRecordReader(fileOrDir string, decoder RecordDecoder, filePattern string) (l *recordReader, err error) {
+// NewRecordReader creates a reader of records from a file, a directory or stdin ("-").
+//
+// When reading a directory, files matching any of the file patterns are read.
+// The decoder is initialized with the suffix of each file, so a decoder may choose the format by suffix.
+func NewRecordReader(fileOrDir string, decoder RecordDecoder, filePatterns ...string) (l *recordReader, err error) {
 	l = &recordReader{
 		recordDecoder: decoder,
-		filePattern:   filePattern,
+		filePatterns:  filePatterns,
 	}
 
 	if fileOrDir == "-" {
 		l.recordDecoder.Init(os.Stdin, "")
 	} else {
 		if hasMeta(fileOrDir) {
-			l.filePattern = filepath.Base(fileOrDir)
+			l.filePatterns = []string{filepath.Base(fileOrDir)}
 			fileOrDir = filepath.Dir(fileOrDir)
 		}
 		var f *os.File
@@ -69,12 +83,18 @@ func NewRecordReader(fileOrDir string, decoder RecordDecoder, filePattern string
 		}
 		if fi, _ := f.Stat(); fi.IsDir() {
 			l.dir = f
+			l.size, err = l.dirSize()
+			if err != nil {
+				return nil, fmt.Errorf("could not read directory '%s': %w", fileOrDir, err)
+			}
 			err = l.initRecordReader()
 			if err != nil {
 				return nil, fmt.Errorf("could not open file '%s': %w", fileOrDir, err)
 			}
 		} else {
 			l.curFileName = f.Name()
+			l.input = f
+			l.size = fi.Size()
 			log.Info().Str("filename", l.curFileName).Msg("Reading file")
 			l.recordDecoder.Init(f, filepath.Ext(f.Name()))
 		}
@@ -92,8 +112,48 @@ func hasMeta(path string) bool {
 	return strings.ContainsAny(path, magicChars)
 }
 
+// matchAny reports whether name matches any of the patterns.
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		if match, err := filepath.Match(pattern, name); match || err != nil {
+			return match, err
+		}
+	}
+	return false, nil
+}
+
+// dirSize returns the total size of the files in the directory matching the file patterns.
+func (l *recordReader) dirSize() (int64, error) {
+	entries, err := os.ReadDir(l.dir.Name())
+	if err != nil {
+		return 0, err
+	}
+	var size int64
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if match, _ := matchAny(l.filePatterns, entry.Name()); !match {
+			continue
+		}
+		if fi, err := entry.Info(); err == nil {
+			size += fi.Size()
+		}
+	}
+	return size, nil
+}
+
+// InputProgress returns the number of bytes read and the total size of the input files.
+func (l *recordReader) InputProgress() (int64, int64) {
+	return l.read.Load(), l.size
+}
+
 func (l *recordReader) initRecordReader() error {
 	if l.curFile != nil {
+		if fi, err := l.curFile.Stat(); err == nil {
+			l.readBytes += fi.Size()
+			l.read.Store(l.readBytes)
+		}
 		_ = l.curFile.Close()
 	}
 
@@ -112,13 +172,14 @@ func (l *recordReader) initRecordReader() error {
 
 		if !fi.IsDir() {
 			var match bool
-			if match, err = filepath.Match(l.filePattern, fi.Name()); match && err == nil {
+			if match, err = matchAny(l.filePatterns, fi.Name()); match && err == nil {
 				l.curFile, err = os.Open(filepath.Join(l.dir.Name(), fi.Name()))
 				if err != nil {
 					return fmt.Errorf("failed to open file \"%s\": %w", fi.Name(), err)
 				}
 				l.curRecNum = 0
 				l.curFileName = l.curFile.Name()
+				l.input = l.curFile
 
 				log.Info().Str("filename", l.curFileName).Msg("Reading file")
 				l.recordDecoder.Init(l.curFile, filepath.Ext(l.curFile.Name()))
@@ -138,6 +199,11 @@ func (l *recordReader) Next(v interface{}) (*State, error) {
 		return l.Next(v)
 	}
 	l.curRecNum++
+	if l.input != nil {
+		if offset, err := l.input.Seek(0, io.SeekCurrent); err == nil {
+			l.read.Store(l.readBytes + offset)
+		}
+	}
 
 	return &State{
 		fileName: l.curFileName,
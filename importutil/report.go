@@ -0,0 +1,131 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// Outcome is the result of importing a record.
+type Outcome string
+
+const (
+	OutcomeCreated          Outcome = "created"
+	OutcomeUpdated          Outcome = "updated"
+	OutcomeUnchanged        Outcome = "unchanged"
+	OutcomeSkippedDuplicate Outcome = "skipped-duplicate"
+	OutcomeFailedCheck      Outcome = "failed-check"
+	OutcomeError            Outcome = "error"
+)
+
+// OutcomeOf returns the outcome of a record that failed with err.
+func OutcomeOf(err error) Outcome {
+	var alreadyExists ErrAlreadyExists
+	var uriErr ErrUriCheck
+	switch {
+	case errors.As(err, &alreadyExists):
+		return OutcomeSkippedDuplicate
+	case errors.As(err, &uriErr):
+		return OutcomeFailedCheck
+	default:
+		return OutcomeError
+	}
+}
+
+// RecordReport is the result of importing a single record.
+type RecordReport struct {
+	Type      string  `json:"type"`
+	Filename  string  `json:"filename"`
+	RecordNum int     `json:"recordNum"`
+	Uri       string  `json:"uri,omitempty"`
+	Key       string  `json:"key,omitempty"`
+	Outcome   Outcome `json:"outcome"`
+	SeedId    string  `json:"seedId,omitempty"`
+	EntityId  string  `json:"entityId,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	// Category is the error category of a failed record, see ErrorCategory
+	Category string `json:"category,omitempty"`
+	// StatusCode is the status code of a record rejected by the uri check
+	StatusCode int `json:"statusCode,omitempty"`
+	// Record is the input record of a failed record, so it can be retried
+	Record json.RawMessage `json:"record,omitempty"`
+}
+
+// SetError sets the outcome and error of a record that failed with err.
+func (rec *RecordReport) SetError(err error) {
+	rec.Outcome = OutcomeOf(err)
+	rec.Error = err.Error()
+	rec.Category = ErrorCategory(err)
+	var uriErr ErrUriCheck
+	if errors.As(err, &uriErr) {
+		rec.StatusCode = uriErr.Result.StatusCode
+	}
+}
+
+// ReportSummary sums up the results of an import.
+type ReportSummary struct {
+	Type    string          `json:"type"`
+	DryRun  bool            `json:"dryRun"`
+	Total   int             `json:"total"`
+	Counts  map[Outcome]int `json:"counts"`
+	Elapsed string          `json:"elapsed"`
+}
+
+// ReportWriter writes the result of each imported record as a line of JSON, followed by a summary.
+// It is safe for concurrent use.
+type ReportWriter struct {
+	mu     sync.Mutex
+	enc    *json.Encoder
+	start  time.Time
+	total  int
+	counts map[Outcome]int
+}
+
+// NewReportWriter creates a report writer writing to w. Elapsed time is measured from now.
+func NewReportWriter(w io.Writer) *ReportWriter {
+	return &ReportWriter{
+		enc:    json.NewEncoder(w),
+		start:  time.Now(),
+		counts: make(map[Outcome]int),
+	}
+}
+
+// Write writes the result of a record.
+func (r *ReportWriter) Write(rec RecordReport) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rec.Type = "record"
+	r.total++
+	r.counts[rec.Outcome]++
+	return r.enc.Encode(rec)
+}
+
+// WriteSummary writes a summary of the written records.
+func (r *ReportWriter) WriteSummary(dryRun bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.enc.Encode(ReportSummary{
+		Type:    "summary",
+		DryRun:  dryRun,
+		Total:   r.total,
+		Counts:  r.counts,
+		Elapsed: time.Since(r.start).String(),
+	})
+}
@@ -0,0 +1,77 @@
+package importutil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestOutcomeOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want Outcome
+	}{
+		{ErrAlreadyExists("example.com/"), OutcomeSkippedDuplicate},
+		{fmt.Errorf("wrapped: %w", ErrUriCheck{Result: &UriCheckResult{Category: UriClientError}}), OutcomeFailedCheck},
+		{errors.New("boom"), OutcomeError},
+	}
+	for _, tt := range tests {
+		if got := OutcomeOf(tt.err); got != tt.want {
+			t.Errorf("OutcomeOf(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestReportWriter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewReportWriter(&buf)
+
+	records := []RecordReport{
+		{Filename: "seeds.json", RecordNum: 1, Uri: "https://example.com/", Key: "//example.com/", Outcome: OutcomeCreated, SeedId: "s1", EntityId: "e1"},
+		{Filename: "seeds.json", RecordNum: 2, Uri: "https://example.com/", Key: "//example.com/", Outcome: OutcomeSkippedDuplicate, Error: "already exists: //example.com/"},
+		{Filename: "seeds.json", RecordNum: 3, Uri: "https://example.org/", Key: "//example.org/", Outcome: OutcomeCreated, SeedId: "s2", EntityId: "e1"},
+	}
+	for _, rec := range records {
+		if err := r.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.WriteSummary(false); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("Got %d lines, want 4", len(lines))
+	}
+	if lines[0]["type"] != "record" || lines[0]["seedId"] != "s1" || lines[0]["recordNum"] != 1.0 {
+		t.Errorf("Unexpected record line %v", lines[0])
+	}
+	if _, ok := lines[0]["error"]; ok {
+		t.Errorf("Record line %v of created seed has an error", lines[0])
+	}
+
+	summary := lines[3]
+	if summary["type"] != "summary" || summary["total"] != 3.0 {
+		t.Errorf("Unexpected summary line %v", summary)
+	}
+	wantCounts := map[string]interface{}{"created": 2.0, "skipped-duplicate": 1.0}
+	if !reflect.DeepEqual(summary["counts"], wantCounts) {
+		t.Errorf("Got counts %v, want %v", summary["counts"], wantCounts)
+	}
+	if summary["elapsed"] == "" {
+		t.Error("Summary without elapsed time")
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// ErrorUnavailable is the category of errors where Veidemann was unavailable
+	ErrorUnavailable = "unavailable"
+	// ErrorOther is the category of all other errors
+	ErrorOther = "error"
+)
+
+// ErrorCategory classifies the error of a failed record.
+//
+// Records rejected by the uri check get the category of the check result. Other errors are classified by
+// their gRPC status as timeout, unavailable or error.
+func ErrorCategory(err error) string {
+	var uriErr ErrUriCheck
+	if errors.As(err, &uriErr) {
+		return string(uriErr.Result.Category)
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded:
+		return string(UriTimeout)
+	case status.Code(err) == codes.Unavailable:
+		return ErrorUnavailable
+	default:
+		return ErrorOther
+	}
+}
+
+// RetryFilter selects failed records to retry.
+type RetryFilter struct {
+	categories  map[string]bool
+	statusCodes map[int]bool
+}
+
+// ParseRetryFilter creates a filter selecting failed records of the given categories. A category is an
+// error category (see ErrorCategory), 4xx or 5xx for client or server errors, or a status code (e.g. 503).
+// Without categories, all failed records are selected.
+func ParseRetryFilter(categories []string) (*RetryFilter, error) {
+	if len(categories) == 0 {
+		return nil, nil
+	}
+	f := &RetryFilter{
+		categories:  make(map[string]bool),
+		statusCodes: make(map[int]bool),
+	}
+	for _, c := range categories {
+		c = strings.TrimSpace(c)
+		switch c {
+		case "4xx":
+			c = string(UriClientError)
+		case "5xx":
+			c = string(UriServerError)
+		}
+		if code, err := strconv.Atoi(c); err == nil {
+			if code < 400 || code > 599 {
+				return nil, fmt.Errorf("invalid status code to retry: %d (must be 4xx or 5xx)", code)
+			}
+			f.statusCodes[code] = true
+			continue
+		}
+		if c != ErrorUnavailable && c != ErrorOther && (c == string(UriOk) || !isUriCategory(UriCategory(c))) {
+			return nil, fmt.Errorf("invalid category to retry: %s", c)
+		}
+		f.categories[c] = true
+	}
+	return f, nil
+}
+
+// Match returns true if the record failed and is selected by the filter. A nil filter selects all failed records.
+func (f *RetryFilter) Match(rec *RecordReport) bool {
+	if rec.Type != "record" || (rec.Outcome != OutcomeError && rec.Outcome != OutcomeFailedCheck) {
+		return false
+	}
+	if f == nil {
+		return true
+	}
+	return f.categories[rec.Category] || f.statusCodes[rec.StatusCode]
+}
+
+// RetryReader reads the failed records of a report written by a previous import.
+//
+// Records keep the file name and record number of the original input, so reports and error logs of
+// a retry refer to the original input.
+type RetryReader struct {
+	f       *os.File
+	scanner *bufio.Scanner
+	filter  *RetryFilter
+	lineNum int
+	size    int64
+	read    atomic.Int64
+	// Unavailable is the number of selected records without a saved record, e.g. records that failed to decode
+	Unavailable int
+}
+
+// NewRetryReader creates a reader of the records in a report file selected by the filter.
+func NewRetryReader(reportFile string, filter *RetryFilter) (*RetryReader, error) {
+	f, err := os.Open(reportFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open report '%s': %w", reportFile, err)
+	}
+	var size int64
+	if fi, err := f.Stat(); err == nil {
+		size = fi.Size()
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &RetryReader{f: f, scanner: scanner, filter: filter, size: size}, nil
+}
+
+// InputProgress returns the number of bytes read and the size of the report.
+func (r *RetryReader) InputProgress() (int64, int64) {
+	return r.read.Load(), r.size
+}
+
+// Next decodes the next selected record into v. It returns io.EOF when there are no more records.
+func (r *RetryReader) Next(v interface{}) (*State, error) {
+	for r.scanner.Scan() {
+		r.lineNum++
+		r.read.Add(int64(len(r.scanner.Bytes())) + 1)
+		var rec RecordReport
+		if err := json.Unmarshal(r.scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("invalid report line %d: %w", r.lineNum, err)
+		}
+		if !r.filter.Match(&rec) {
+			continue
+		}
+		if len(rec.Record) == 0 {
+			r.Unavailable++
+			continue
+		}
+		state := &State{fileName: rec.Filename, recNum: rec.RecordNum}
+		state.err = json.Unmarshal(rec.Record, v)
+		return state, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Close closes the report file.
+func (r *RetryReader) Close() error {
+	return r.f.Close()
+}
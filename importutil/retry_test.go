@@ -0,0 +1,133 @@
+package importutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{ErrUriCheck{Result: &UriCheckResult{Category: UriServerError, StatusCode: 503}}, "server-error"},
+		{fmt.Errorf("failed to create seed: %w", status.Error(codes.DeadlineExceeded, "deadline")), "timeout"},
+		{fmt.Errorf("failed: %w", context.DeadlineExceeded), "timeout"},
+		{status.Error(codes.Unavailable, "down"), "unavailable"},
+		{errors.New("boom"), "error"},
+	}
+	for _, tt := range tests {
+		if got := ErrorCategory(tt.err); got != tt.want {
+			t.Errorf("ErrorCategory(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryFilter(t *testing.T) {
+	if _, err := ParseRetryFilter([]string{"ok"}); err == nil {
+		t.Error("Expected error for category ok")
+	}
+	if _, err := ParseRetryFilter([]string{"200"}); err == nil {
+		t.Error("Expected error for status code 200")
+	}
+
+	f, err := ParseRetryFilter([]string{"timeout", "5xx", "404"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rec  RecordReport
+		want bool
+	}{
+		{RecordReport{Type: "record", Outcome: OutcomeError, Category: "timeout"}, true},
+		{RecordReport{Type: "record", Outcome: OutcomeFailedCheck, Category: "server-error", StatusCode: 502}, true},
+		{RecordReport{Type: "record", Outcome: OutcomeFailedCheck, Category: "client-error", StatusCode: 404}, true},
+		{RecordReport{Type: "record", Outcome: OutcomeFailedCheck, Category: "client-error", StatusCode: 410}, false},
+		{RecordReport{Type: "record", Outcome: OutcomeError, Category: "error"}, false},
+		{RecordReport{Type: "record", Outcome: OutcomeCreated}, false},
+	}
+	for _, tt := range tests {
+		if got := f.Match(&tt.rec); got != tt.want {
+			t.Errorf("Match(%+v) = %v, want %v", tt.rec, got, tt.want)
+		}
+	}
+
+	// A nil filter matches all failed records
+	var all *RetryFilter
+	if !all.Match(&RecordReport{Type: "record", Outcome: OutcomeError}) || all.Match(&RecordReport{Type: "record", Outcome: OutcomeSkippedDuplicate}) {
+		t.Error("Nil filter must match failed records only")
+	}
+}
+
+func TestRetryReader(t *testing.T) {
+	reportFile := filepath.Join(t.TempDir(), "report.json")
+	f, err := os.Create(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := NewReportWriter(f)
+
+	write := func(recNum int, sd *SeedDesc, err error) {
+		rec := RecordReport{Filename: "seeds.json", RecordNum: recNum, Outcome: OutcomeCreated}
+		if err != nil {
+			rec.SetError(err)
+			rec.Record = []byte(sd.String())
+		}
+		if err := report.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(1, &SeedDesc{Uri: "https://example.com/"}, nil)
+	write(2, &SeedDesc{Uri: "https://example.org/", EntityName: "Org"}, status.Error(codes.DeadlineExceeded, "deadline"))
+	write(3, &SeedDesc{Uri: "https://example.net/"}, ErrAlreadyExists("//example.net/"))
+	write(4, &SeedDesc{Uri: "https://example.no/"}, ErrUriCheck{Result: &UriCheckResult{Category: UriDnsError}})
+	if err := report.Write(RecordReport{Filename: "seeds.json", RecordNum: 5, Outcome: OutcomeError, Category: "timeout"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := report.WriteSummary(false); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	filter, err := ParseRetryFilter([]string{"timeout"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRetryReader(reportFile, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var got []SeedDesc
+	for {
+		var sd SeedDesc
+		state, err := r.Next(&sd)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.GetFilename() != "seeds.json" || state.GetRecordNum() != 2 {
+			t.Errorf("Got record %d of %s, want record 2 of seeds.json", state.GetRecordNum(), state.GetFilename())
+		}
+		got = append(got, sd)
+	}
+	want := []SeedDesc{{Uri: "https://example.org/", EntityName: "Org"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got records %v, want %v", got, want)
+	}
+	if r.Unavailable != 1 {
+		t.Errorf("Got %d unavailable records, want 1", r.Unavailable)
+	}
+}
@@ -2,6 +2,9 @@ package importutil
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
+
 	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
 )
 
@@ -56,3 +59,125 @@ func (sd *SeedDesc) ToSeed() *configV1.ConfigObject {
 		},
 	}
 }
+
+// ParseLabels parses labels on the form key:value.
+func ParseLabels(labels []string) ([]*configV1.Label, error) {
+	var result []*configV1.Label
+	for _, label := range labels {
+		key, value, ok := strings.Cut(label, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label '%s', expected key:value", label)
+		}
+		result = append(result, &configV1.Label{Key: key, Value: value})
+	}
+	return result, nil
+}
+
+// UpdateSeed updates an existing seed with the labels, crawl job references and description of the seed description.
+//
+// If replace is false, labels and crawl job references not already present are added and the description is
+// updated if the seed description has one. If replace is true, the fields set in the seed description replace
+// those of the seed. Fields the seed description leaves out are kept, so a record can not remove all labels
+// or crawl job references of a seed.
+// The names of the changed fields are returned.
+func (sd *SeedDesc) UpdateSeed(seed *configV1.ConfigObject, replace bool) []string {
+	var changed []string
+
+	meta := seed.GetMeta()
+	if meta == nil {
+		meta = &configV1.Meta{}
+		seed.Meta = meta
+	}
+	spec := seed.GetSeed()
+	if spec == nil {
+		spec = &configV1.Seed{}
+		seed.Spec = &configV1.ConfigObject_Seed{Seed: spec}
+	}
+
+	if replace {
+		if len(sd.SeedLabel) > 0 && !equalLabels(meta.Label, sd.SeedLabel) {
+			meta.Label = sd.SeedLabel
+			changed = append(changed, "seedLabel")
+		}
+		if len(sd.CrawlJobRef) > 0 && !equalRefs(spec.JobRef, sd.CrawlJobRef) {
+			spec.JobRef = sd.CrawlJobRef
+			changed = append(changed, "crawlJobRef")
+		}
+		if sd.SeedDescription != "" && meta.Description != sd.SeedDescription {
+			meta.Description = sd.SeedDescription
+			changed = append(changed, "seedDescription")
+		}
+		return changed
+	}
+
+	var labelsChanged bool
+	for _, label := range sd.SeedLabel {
+		if !containsLabel(meta.Label, label) {
+			meta.Label = append(meta.Label, label)
+			labelsChanged = true
+		}
+	}
+	if labelsChanged {
+		changed = append(changed, "seedLabel")
+	}
+
+	var refsChanged bool
+	for _, ref := range sd.CrawlJobRef {
+		if !containsRef(spec.JobRef, ref) {
+			spec.JobRef = append(spec.JobRef, ref)
+			refsChanged = true
+		}
+	}
+	if refsChanged {
+		changed = append(changed, "crawlJobRef")
+	}
+
+	if sd.SeedDescription != "" && meta.Description != sd.SeedDescription {
+		meta.Description = sd.SeedDescription
+		changed = append(changed, "seedDescription")
+	}
+
+	return changed
+}
+
+func containsLabel(labels []*configV1.Label, label *configV1.Label) bool {
+	for _, l := range labels {
+		if l.GetKey() == label.GetKey() && l.GetValue() == label.GetValue() {
+			return true
+		}
+	}
+	return false
+}
+
+func equalLabels(a []*configV1.Label, b []*configV1.Label) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, label := range b {
+		if !containsLabel(a, label) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsRef(refs []*configV1.ConfigRef, ref *configV1.ConfigRef) bool {
+	for _, r := range refs {
+		if r.GetKind() == ref.GetKind() && r.GetId() == ref.GetId() {
+			return true
+		}
+	}
+	return false
+}
+
+func equalRefs(a []*configV1.ConfigRef, b []*configV1.ConfigRef) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, ref := range b {
+		if !containsRef(a, ref) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package importutil
+
+import (
+	"reflect"
+	"testing"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSeedDescUpdateSeed(t *testing.T) {
+	existing := func() *configV1.ConfigObject {
+		return &configV1.ConfigObject{
+			Id:   "seed1",
+			Kind: configV1.Kind_seed,
+			Meta: &configV1.Meta{
+				Name:        "https://www.example.com/",
+				Description: "old",
+				Label:       []*configV1.Label{{Key: "topic", Value: "news"}},
+			},
+			Spec: &configV1.ConfigObject_Seed{
+				Seed: &configV1.Seed{
+					EntityRef: &configV1.ConfigRef{Kind: configV1.Kind_crawlEntity, Id: "entity1"},
+					JobRef:    []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: "job1"}},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		sd          SeedDesc
+		replace     bool
+		wantChanged []string
+		wantLabels  []*configV1.Label
+		wantRefs    []*configV1.ConfigRef
+		wantDesc    string
+	}{
+		{
+			name: "merge",
+			sd: SeedDesc{
+				SeedLabel:       []*configV1.Label{{Key: "topic", Value: "news"}, {Key: "event", Value: "election"}},
+				CrawlJobRef:     []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: "job2"}},
+				SeedDescription: "new",
+			},
+			wantChanged: []string{"seedLabel", "crawlJobRef", "seedDescription"},
+			wantLabels:  []*configV1.Label{{Key: "topic", Value: "news"}, {Key: "event", Value: "election"}},
+			wantRefs:    []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: "job1"}, {Kind: configV1.Kind_crawlJob, Id: "job2"}},
+			wantDesc:    "new",
+		},
+		{
+			name: "merge unchanged",
+			sd: SeedDesc{
+				SeedLabel:   []*configV1.Label{{Key: "topic", Value: "news"}},
+				CrawlJobRef: []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: "job1"}},
+			},
+			wantLabels: []*configV1.Label{{Key: "topic", Value: "news"}},
+			wantRefs:   []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: "job1"}},
+			wantDesc:   "old",
+		},
+		{
+			name: "replace",
+			sd: SeedDesc{
+				SeedLabel:       []*configV1.Label{{Key: "event", Value: "election"}},
+				CrawlJobRef:     []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: "job2"}},
+				SeedDescription: "new",
+			},
+			replace:     true,
+			wantChanged: []string{"seedLabel", "crawlJobRef", "seedDescription"},
+			wantLabels:  []*configV1.Label{{Key: "event", Value: "election"}},
+			wantRefs:    []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: "job2"}},
+			wantDesc:    "new",
+		},
+		{
+			name: "replace labels only",
+			sd: SeedDesc{
+				SeedLabel: []*configV1.Label{{Key: "event", Value: "election"}},
+			},
+			replace:     true,
+			wantChanged: []string{"seedLabel"},
+			wantLabels:  []*configV1.Label{{Key: "event", Value: "election"}},
+			wantRefs:    []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: "job1"}},
+			wantDesc:    "old",
+		},
+		{
+			name:       "replace without jobs or labels",
+			sd:         SeedDesc{},
+			replace:    true,
+			wantLabels: []*configV1.Label{{Key: "topic", Value: "news"}},
+			wantRefs:   []*configV1.ConfigRef{{Kind: configV1.Kind_crawlJob, Id: "job1"}},
+			wantDesc:   "old",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed := existing()
+			changed := tt.sd.UpdateSeed(seed, tt.replace)
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			if !proto.Equal(&configV1.Meta{Label: seed.GetMeta().GetLabel()}, &configV1.Meta{Label: tt.wantLabels}) {
+				t.Errorf("labels = %v, want %v", seed.GetMeta().GetLabel(), tt.wantLabels)
+			}
+			if !proto.Equal(&configV1.Seed{JobRef: seed.GetSeed().GetJobRef()}, &configV1.Seed{JobRef: tt.wantRefs}) {
+				t.Errorf("job refs = %v, want %v", seed.GetSeed().GetJobRef(), tt.wantRefs)
+			}
+			if seed.GetMeta().GetDescription() != tt.wantDesc {
+				t.Errorf("description = %q, want %q", seed.GetMeta().GetDescription(), tt.wantDesc)
+			}
+			if seed.GetSeed().GetEntityRef().GetId() != "entity1" {
+				t.Error("entity ref must not change")
+			}
+		})
+	}
+}
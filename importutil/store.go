@@ -0,0 +1,172 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"bytes"
+	"path"
+	"sort"
+	"sync"
+)
+
+// InMemory is the db dir selecting an in-memory state store, which is discarded when closed.
+const InMemory = ":memory:"
+
+// StateStore is the key-value store holding the state of an import db.
+//
+// Get returns nil for a missing key, so a missing key and an empty value are not told apart.
+type StateStore interface {
+	// Get returns the value of the key or nil if the key does not exist.
+	Get(key []byte) ([]byte, error)
+	// Set sets the value of the key.
+	Set(key []byte, value []byte) error
+	// Delete removes the key.
+	Delete(key []byte) error
+	// Iterate calls fn, in key order, for every key starting with prefix. Iteration stops at the first error
+	// returned by fn. The store may be modified from fn, but the changes are not necessarily seen by the iteration.
+	Iterate(prefix []byte, fn func(key []byte, value []byte) error) error
+	// DropPrefix removes all keys starting with prefix.
+	DropPrefix(prefix []byte) error
+	// Update calls fn in a transaction, so the reads and writes of fn are applied atomically.
+	Update(fn func(txn StoreTxn) error) error
+	// Close closes the store.
+	Close() error
+}
+
+// StoreTxn is a transaction in a StateStore.
+type StoreTxn interface {
+	Get(key []byte) ([]byte, error)
+	Set(key []byte, value []byte) error
+	Delete(key []byte) error
+}
+
+// StateDbDir returns the directory of a state db below dbDir, or InMemory if dbDir is InMemory.
+func StateDbDir(dbDir string, elem ...string) string {
+	if dbDir == InMemory {
+		return InMemory
+	}
+	return path.Join(append([]string{dbDir}, elem...)...)
+}
+
+// OpenStateStore opens the state store in dbDir, or an in-memory store if dbDir is InMemory.
+// If truncate is true, the store is emptied.
+func OpenStateStore(dbDir string, truncate bool) (StateStore, error) {
+	if dbDir == InMemory {
+		return NewMemoryStore(), nil
+	}
+	return openBadgerStore(dbDir, truncate)
+}
+
+// MemoryStore is a StateStore keeping everything in a map.
+type MemoryStore struct {
+	mu sync.RWMutex
+	m  map[string][]byte
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{m: make(map[string][]byte)}
+}
+
+func (s *MemoryStore) Get(key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return memoryTxn{s.m}.Get(key)
+}
+
+func (s *MemoryStore) Set(key []byte, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryTxn{s.m}.Set(key, value)
+}
+
+func (s *MemoryStore) Delete(key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return memoryTxn{s.m}.Delete(key)
+}
+
+func (s *MemoryStore) Iterate(prefix []byte, fn func(key []byte, value []byte) error) error {
+	// Iterate over a snapshot so fn can modify the store
+	type kv struct{ k, v []byte }
+	var snapshot []kv
+	s.mu.RLock()
+	for k, v := range s.m {
+		if bytes.HasPrefix([]byte(k), prefix) {
+			snapshot = append(snapshot, kv{[]byte(k), v})
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(snapshot, func(i, j int) bool {
+		return bytes.Compare(snapshot[i].k, snapshot[j].k) < 0
+	})
+	for _, e := range snapshot {
+		if err := fn(e.k, bytes.Clone(e.v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) DropPrefix(prefix []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k := range s.m {
+		if bytes.HasPrefix([]byte(k), prefix) {
+			delete(s.m, k)
+		}
+	}
+	return nil
+}
+
+// Update calls fn with the store locked. Changes made by fn before it fails are not rolled back.
+func (s *MemoryStore) Update(fn func(txn StoreTxn) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(memoryTxn{s.m})
+}
+
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.m = make(map[string][]byte)
+	return nil
+}
+
+// memoryTxn accesses the map of a MemoryStore, which must be locked by the caller.
+type memoryTxn struct {
+	m map[string][]byte
+}
+
+func (t memoryTxn) Get(key []byte) ([]byte, error) {
+	v, ok := t.m[string(key)]
+	if !ok {
+		return nil, nil
+	}
+	if v == nil {
+		return []byte{}, nil
+	}
+	return bytes.Clone(v), nil
+}
+
+func (t memoryTxn) Set(key []byte, value []byte) error {
+	t.m[string(key)] = bytes.Clone(value)
+	return nil
+}
+
+func (t memoryTxn) Delete(key []byte) error {
+	delete(t.m, string(key))
+	return nil
+}
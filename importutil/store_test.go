@@ -0,0 +1,109 @@
+package importutil
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStateStore(t *testing.T) {
+	stores := map[string]func(t *testing.T) StateStore{
+		"badger": func(t *testing.T) StateStore {
+			s, err := OpenStateStore(t.TempDir(), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+		"memory": func(t *testing.T) StateStore {
+			s, err := OpenStateStore(InMemory, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		},
+	}
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+
+			for _, k := range []string{"b", "a2", "a1", "c"} {
+				if err := s.Set([]byte(k), []byte("v"+k)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Set([]byte("a3"), nil); err != nil {
+				t.Fatal(err)
+			}
+
+			if v, err := s.Get([]byte("a1")); err != nil || string(v) != "va1" {
+				t.Errorf("Get(a1) = %q, %v, want \"va1\"", v, err)
+			}
+			if v, err := s.Get([]byte("a3")); err != nil || v == nil || len(v) != 0 {
+				t.Errorf("Get(a3) = %#v, %v, want empty value", v, err)
+			}
+			if v, err := s.Get([]byte("missing")); err != nil || v != nil {
+				t.Errorf("Get(missing) = %#v, %v, want nil", v, err)
+			}
+
+			var keys []string
+			err := s.Iterate([]byte("a"), func(k []byte, _ []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := []string{"a1", "a2", "a3"}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("Iterate(a) = %v, want %v", keys, want)
+			}
+
+			stop := errors.New("stop")
+			if err := s.Iterate(nil, func([]byte, []byte) error { return stop }); !errors.Is(err, stop) {
+				t.Errorf("Iterate() = %v, want %v", err, stop)
+			}
+
+			err = s.Update(func(txn StoreTxn) error {
+				v, err := txn.Get([]byte("b"))
+				if err != nil {
+					return err
+				}
+				if err := txn.Delete([]byte("b")); err != nil {
+					return err
+				}
+				return txn.Set([]byte("d"), v)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v, _ := s.Get([]byte("b")); v != nil {
+				t.Errorf("Get(b) = %q after delete, want nil", v)
+			}
+			if v, _ := s.Get([]byte("d")); string(v) != "vb" {
+				t.Errorf("Get(d) = %q, want \"vb\"", v)
+			}
+
+			if err := s.DropPrefix([]byte("a")); err != nil {
+				t.Fatal(err)
+			}
+			keys = nil
+			_ = s.Iterate(nil, func(k []byte, _ []byte) error {
+				keys = append(keys, string(k))
+				return nil
+			})
+			if want := []string{"c", "d"}; !reflect.DeepEqual(keys, want) {
+				t.Errorf("keys after DropPrefix(a) = %v, want %v", keys, want)
+			}
+		})
+	}
+}
+
+func TestStateDbDir(t *testing.T) {
+	if got := StateDbDir(InMemory, "ctx", "seed"); got != InMemory {
+		t.Errorf("StateDbDir(%q) = %q, want %q", InMemory, got, InMemory)
+	}
+	if got, want := StateDbDir("/tmp/db", "ctx", "seed"), "/tmp/db/ctx/seed"; got != want {
+		t.Errorf("StateDbDir() = %q, want %q", got, want)
+	}
+}
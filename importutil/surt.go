@@ -0,0 +1,74 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// surtKeyPrefix is the prefix of keys in the SURT index.
+//
+// An index entry is the SURT form of a key followed by a NUL byte and the key itself, so entries are
+// ordered by SURT and several keys with the same SURT form (e.g. http and https) can coexist.
+const surtKeyPrefix = internalKeyPrefix + "surt\x00"
+
+// surtOf returns the SURT form of a key and true, or false if the key is not a URI.
+// Keys that already are in SURT form are returned as is.
+func surtOf(key string) (string, bool) {
+	if strings.Contains(key, ")/") && !strings.Contains(key, "://") {
+		return key, true
+	}
+	uri, err := url.Parse(key)
+	if err != nil || uri.Hostname() == "" {
+		return "", false
+	}
+	return Surt(uri), true
+}
+
+// surtIndexKey returns the index key for the key, or nil if the key is not a URI.
+func surtIndexKey(key string) []byte {
+	surt, ok := surtOf(key)
+	if !ok {
+		return nil
+	}
+	return []byte(surtKeyPrefix + surt + "\x00" + key)
+}
+
+// ScanSurtPrefix calls fn, in SURT order, for every URI key whose SURT form starts with prefix.
+// An empty prefix scans all URI keys. Scanning stops at the first error returned by fn.
+//
+// Keys are added to the SURT index when they are set, so a db created by an older version must be
+// filled again (e.g. by importing existing seeds) before it can be scanned.
+func (d *ImportDb) ScanSurtPrefix(prefix string, fn func(surt string, key string, ids []string) error) error {
+	return d.store.Iterate([]byte(surtKeyPrefix+prefix), func(k []byte, _ []byte) error {
+		entry := strings.TrimPrefix(string(k), surtKeyPrefix)
+		surt, key, ok := strings.Cut(entry, "\x00")
+		if !ok {
+			return nil
+		}
+
+		v, err := d.store.Get([]byte(key))
+		if err != nil {
+			return fmt.Errorf("failed to get '%s': %w", key, err)
+		}
+		if v == nil {
+			// stale index entry
+			return nil
+		}
+
+		return fn(surt, key, d.bytesToStringArray(v))
+	})
+}
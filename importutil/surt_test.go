@@ -0,0 +1,56 @@
+package importutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScanSurtPrefix(t *testing.T) {
+	db, err := NewImportDb(InMemory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, _, _ = db.Set("http://www.example.com/", "1")
+	_, _, _ = db.Set("https://example.com/news/", "2")
+	_, _, _ = db.Set("//example.com/", "3")
+	_, _, _ = db.Set("http://example.org/", "4")
+	_, _, _ = db.Set("com,example)/sport/", "5")
+	_, _, _ = db.Set("Some entity", "6")
+	_ = db.SetCheckpoint("file", 1)
+
+	scan := func(prefix string) []string {
+		var got []string
+		err := db.ScanSurtPrefix(prefix, func(surt string, key string, ids []string) error {
+			got = append(got, surt+" "+key+" "+ids[0])
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	want := []string{
+		"com,example)/ //example.com/ 3",
+		"com,example)/news/ https://example.com/news/ 2",
+		"com,example)/sport/ com,example)/sport/ 5",
+		"com,example,www)/ http://www.example.com/ 1",
+		"org,example)/ http://example.org/ 4",
+	}
+	if got := scan(""); !reflect.DeepEqual(got, want) {
+		t.Errorf("ScanSurtPrefix(\"\") = %q, want %q", got, want)
+	}
+	if got := scan("com,example)/"); !reflect.DeepEqual(got, want[:3]) {
+		t.Errorf("ScanSurtPrefix(\"com,example)/\") = %q, want %q", got, want[:3])
+	}
+
+	// Deleting the last id of a key removes it from the index
+	if err := db.Delete("https://example.com/news/", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if got := scan("com,example)/news"); len(got) != 0 {
+		t.Errorf("Expected no keys after delete, got %q", got)
+	}
+}
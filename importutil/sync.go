@@ -0,0 +1,134 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	commonsV1 "github.com/nlnwa/veidemann-api/go/commons/v1"
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+)
+
+// syncKey is the key of the sync state.
+const syncKey = internalKeyPrefix + "sync"
+
+// syncOverlap is how long before the high-water mark an incremental import keeps listing objects, to allow for
+// clock skew between the writers of Veidemann.
+const syncOverlap = time.Minute
+
+// idKeyPrefix is the prefix of keys mapping an id to its key.
+const idKeyPrefix = internalKeyPrefix + "id\x00"
+
+// syncState records the last sync of the db with Veidemann.
+type syncState struct {
+	// LastModified is the high-water mark: the latest last modified time of the synced objects
+	LastModified time.Time `json:"lastModified"`
+	// Normalizer describes the key normalizer used when syncing
+	Normalizer string `json:"normalizer"`
+}
+
+// getSyncState returns the sync state or nil if the db has never been synced.
+func (d *ImportDb) getSyncState() (*syncState, error) {
+	v, err := d.store.Get([]byte(syncKey))
+	if err == nil && v == nil {
+		return nil, nil
+	}
+	state := &syncState{}
+	if err == nil {
+		err = json.Unmarshal(v, state)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sync state: %w", err)
+	}
+	return state, nil
+}
+
+// setSyncState stores the sync state.
+func (d *ImportDb) setSyncState(state syncState) error {
+	b, err := json.Marshal(state)
+	if err == nil {
+		err = d.store.Set([]byte(syncKey), b)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set sync state: %w", err)
+	}
+	return nil
+}
+
+// KeyOf returns the key of the id or an empty string if the id is unknown.
+func (d *ImportDb) KeyOf(id string) (string, error) {
+	v, err := d.store.Get([]byte(idKeyPrefix + id))
+	return string(v), err
+}
+
+// normalizerName describes a key normalizer.
+func normalizerName(n KeyNormalizer) string {
+	if n == nil {
+		return ""
+	}
+	if s, ok := n.(fmt.Stringer); ok {
+		return s.String()
+	}
+	return fmt.Sprintf("%T", n)
+}
+
+// listIds returns the ids of all objects of the kind in Veidemann.
+func listIds(ctx context.Context, client configV1.ConfigClient, kind configV1.Kind) (map[string]bool, error) {
+	req := &configV1.ListRequest{
+		Kind:               kind,
+		ReturnedFieldsMask: &commonsV1.FieldMask{Paths: []string{"id"}},
+	}
+	r, err := client.ListConfigObjects(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s ids from Veidemann: %w", kind.String(), err)
+	}
+	ids := make(map[string]bool)
+	for {
+		msg, err := r.Recv()
+		if errors.Is(err, io.EOF) {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s ids from Veidemann: %w", kind.String(), err)
+		}
+		ids[msg.GetId()] = true
+	}
+}
+
+// removeStale removes every id not in existing and returns the number of removed ids.
+func (d *ImportDb) removeStale(existing map[string]bool) (int, error) {
+	type entry struct{ key, id string }
+	var stale []entry
+	err := d.IterateIds(func(key string, ids []string) {
+		for _, id := range ids {
+			if !existing[id] {
+				stale = append(stale, entry{key, id})
+			}
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, e := range stale {
+		if err := d.Delete(e.key, e.id); err != nil {
+			return 0, err
+		}
+	}
+	return len(stale), nil
+}
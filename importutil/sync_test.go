@@ -0,0 +1,275 @@
+package importutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeListClient lists config objects, honouring ordering by last modified time and id-only field masks
+type fakeListClient struct {
+	configV1.ConfigClient
+	objects []*configV1.ConfigObject
+	// unordered makes the client ignore the requested ordering
+	unordered bool
+	// sent is the number of objects sent in full
+	sent int
+	// fetched is the number of objects fetched by id
+	fetched int
+}
+
+func (c *fakeListClient) GetConfigObject(_ context.Context, ref *configV1.ConfigRef, _ ...grpc.CallOption) (*configV1.ConfigObject, error) {
+	for _, o := range c.objects {
+		if o.GetKind() == ref.GetKind() && o.GetId() == ref.GetId() {
+			c.fetched++
+			return o, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s with id %s", ref.GetKind(), ref.GetId())
+}
+
+func (c *fakeListClient) ListConfigObjects(ctx context.Context, req *configV1.ListRequest, _ ...grpc.CallOption) (configV1.Config_ListConfigObjectsClient, error) {
+	items := append([]*configV1.ConfigObject(nil), c.objects...)
+	if req.GetOrderByPath() == "meta.lastModified" && !c.unordered {
+		sort.SliceStable(items, func(i, j int) bool {
+			a := items[i].GetMeta().GetLastModified().AsTime()
+			b := items[j].GetMeta().GetLastModified().AsTime()
+			if req.GetOrderDescending() {
+				return a.After(b)
+			}
+			return a.Before(b)
+		})
+	}
+	idOnly := reflect.DeepEqual(req.GetReturnedFieldsMask().GetPaths(), []string{"id"})
+	return &configObjectStream{ctx: ctx, client: c, items: items, idOnly: idOnly}, nil
+}
+
+type configObjectStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	client *fakeListClient
+	items  []*configV1.ConfigObject
+	idOnly bool
+}
+
+func (s *configObjectStream) Recv() (*configV1.ConfigObject, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(s.items) == 0 {
+		return nil, io.EOF
+	}
+	item := s.items[0]
+	s.items = s.items[1:]
+	if s.idOnly {
+		return &configV1.ConfigObject{Id: item.GetId()}, nil
+	}
+	s.client.sent++
+	return item, nil
+}
+
+func seedObject(id string, uri string, lastModified time.Time) *configV1.ConfigObject {
+	return &configV1.ConfigObject{
+		Id:   id,
+		Kind: configV1.Kind_seed,
+		Meta: &configV1.Meta{
+			Name:         uri,
+			LastModified: timestamppb.New(lastModified),
+		},
+	}
+}
+
+func TestImportExistingIncremental(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := &fakeListClient{objects: []*configV1.ConfigObject{
+		seedObject("0", "https://example.dk/", t0.Add(-time.Hour)),
+		seedObject("1", "https://example.com/", t0),
+		seedObject("2", "https://example.org/", t0.Add(time.Hour)),
+		seedObject("3", "https://example.net/", t0.Add(2*time.Hour)),
+	}}
+	normalizer := &UriKeyNormalizer{IgnoreScheme: true}
+
+	db, err := NewImportDb(InMemory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	get := func(key string) []string {
+		t.Helper()
+		ids, err := db.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	// Full import
+	if err := ImportExisting(db, client, configV1.Kind_seed, normalizer); err != nil {
+		t.Fatal(err)
+	}
+	if client.sent != 4 {
+		t.Errorf("full import fetched %d objects, want 4", client.sent)
+	}
+
+	// Rename seed 2, delete seed 3 and add seed 4
+	client.objects = []*configV1.ConfigObject{
+		client.objects[0],
+		client.objects[1],
+		seedObject("2", "https://example.no/", t0.Add(3*time.Hour)),
+		seedObject("4", "https://example.se/", t0.Add(4*time.Hour)),
+	}
+	client.sent = 0
+
+	if err := ImportExisting(db, client, configV1.Kind_seed, normalizer); err != nil {
+		t.Fatal(err)
+	}
+	// Listing stops at seed 1, the first seed older than the high-water mark, so seed 0 is not fetched
+	if client.sent != 3 {
+		t.Errorf("incremental import fetched %d objects, want 3", client.sent)
+	}
+
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{"//example.dk/", []string{"0"}},
+		{"//example.com/", []string{"1"}},
+		{"//example.org/", nil},
+		{"//example.no/", []string{"2"}},
+		{"//example.net/", nil},
+		{"//example.se/", []string{"4"}},
+	}
+	for _, tt := range tests {
+		if got := get(tt.key); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Get(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+
+	// A different normalizer forces a full import
+	client.sent = 0
+	if err := ImportExisting(db, client, configV1.Kind_seed, &UriKeyNormalizer{}); err != nil {
+		t.Fatal(err)
+	}
+	if client.sent != 4 {
+		t.Errorf("import with new normalizer fetched %d objects, want 4", client.sent)
+	}
+}
+
+func TestImportExistingSinceHighWaterMark(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := &fakeListClient{objects: []*configV1.ConfigObject{
+		seedObject("0", "https://example.dk/", t0.Add(-time.Hour)),
+		seedObject("1", "https://example.com/", t0),
+	}}
+	normalizer := &UriKeyNormalizer{IgnoreScheme: true}
+
+	db, err := NewImportDb(InMemory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := ImportExisting(db, client, configV1.Kind_seed, normalizer); err != nil {
+		t.Fatal(err)
+	}
+
+	// Seed 2 shares the high-water mark and seed 3 was written by a writer with a clock slightly behind
+	client.objects = append(client.objects,
+		seedObject("2", "https://example.org/", t0),
+		seedObject("3", "https://example.net/", t0.Add(-syncOverlap/2)),
+	)
+	client.sent = 0
+
+	if err := ImportExisting(db, client, configV1.Kind_seed, normalizer); err != nil {
+		t.Fatal(err)
+	}
+	// Listing stops at seed 0, the first seed older than the high-water mark less the overlap
+	if client.sent != 4 {
+		t.Errorf("incremental import fetched %d objects, want 4", client.sent)
+	}
+	if client.fetched != 0 {
+		t.Errorf("incremental import fetched %d objects by id, want 0", client.fetched)
+	}
+	for key, id := range map[string]string{"//example.com/": "1", "//example.org/": "2", "//example.net/": "3"} {
+		ids, err := db.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(ids, []string{id}) {
+			t.Errorf("Get(%q) = %v, want [%s]", key, ids, id)
+		}
+	}
+}
+
+func TestImportExistingUnordered(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := &fakeListClient{unordered: true, objects: []*configV1.ConfigObject{
+		seedObject("0", "https://example.dk/", t0.Add(-time.Hour)),
+		seedObject("1", "https://example.com/", t0),
+	}}
+	normalizer := &UriKeyNormalizer{IgnoreScheme: true}
+
+	db, err := NewImportDb(InMemory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	get := func(key string) []string {
+		t.Helper()
+		ids, err := db.Get(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids
+	}
+
+	if err := ImportExisting(db, client, configV1.Kind_seed, normalizer); err != nil {
+		t.Fatal(err)
+	}
+
+	// The listing starts with seed 0, older than the high-water mark, so the new seed 2 is fetched by id
+	client.objects = append(client.objects, seedObject("2", "https://example.org/", t0.Add(time.Hour)))
+	client.sent = 0
+
+	if err := ImportExisting(db, client, configV1.Kind_seed, normalizer); err != nil {
+		t.Fatal(err)
+	}
+	if client.sent != 1 || client.fetched != 1 {
+		t.Errorf("incremental import fetched %d objects and %d by id, want 1 and 1", client.sent, client.fetched)
+	}
+	if got := get("//example.org/"); !reflect.DeepEqual(got, []string{"2"}) {
+		t.Errorf("Get(%q) = %v, want [2]", "//example.org/", got)
+	}
+
+	// Seed 0 renamed after seed 2 shows the listing is not ordered, so listing continues past seed 1
+	client.objects = []*configV1.ConfigObject{
+		client.objects[2],
+		seedObject("0", "https://example.no/", t0.Add(2*time.Hour)),
+		client.objects[1],
+	}
+	client.sent = 0
+	client.fetched = 0
+
+	if err := ImportExisting(db, client, configV1.Kind_seed, normalizer); err != nil {
+		t.Fatal(err)
+	}
+	if client.sent != 3 || client.fetched != 0 {
+		t.Errorf("incremental import fetched %d objects and %d by id, want 3 and 0", client.sent, client.fetched)
+	}
+	if got := get("//example.dk/"); got != nil {
+		t.Errorf("Get(%q) = %v, want []", "//example.dk/", got)
+	}
+	if got := get("//example.no/"); !reflect.DeepEqual(got, []string{"0"}) {
+		t.Errorf("Get(%q) = %v, want [0]", "//example.no/", got)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright © 2023 National Library of Norway
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package importutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/invopop/yaml"
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// templateFuncs are the functions available in object and key templates.
+var templateFuncs = template.FuncMap{
+	// json encodes a value as JSON, e.g. to quote a string
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"split": func(sep string, s string) []string {
+		if s == "" {
+			return nil
+		}
+		return strings.Split(s, sep)
+	},
+	"join": func(sep string, s []string) string {
+		return strings.Join(s, sep)
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	// default returns def if v is empty
+	"default": func(def interface{}, v interface{}) interface{} {
+		if v == nil || v == "" {
+			return def
+		}
+		return v
+	},
+}
+
+// ObjectTemplate renders input records into config objects.
+//
+// The template is a Go template executed with the record as data and must render a single config object
+// as YAML or JSON, in the same form as accepted by the create command. A record rendering to nothing
+// but white space is skipped.
+type ObjectTemplate struct {
+	kind configV1.Kind
+	tmpl *template.Template
+}
+
+// ParseObjectTemplate parses a template rendering config objects of the kind.
+func ParseObjectTemplate(text string, kind configV1.Kind) (*ObjectTemplate, error) {
+	tmpl, err := template.New("object").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return &ObjectTemplate{kind: kind, tmpl: tmpl}, nil
+}
+
+// LoadObjectTemplate reads a template rendering config objects of the kind from a file.
+func LoadObjectTemplate(filename string, kind configV1.Kind) (*ObjectTemplate, error) {
+	b, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	return ParseObjectTemplate(string(b), kind)
+}
+
+// Render renders the record into a config object. It returns nil if the record renders to nothing.
+//
+// The kind and api version of the object default to the kind of the template and v1.
+func (t *ObjectTemplate) Render(record interface{}) (*configV1.ConfigObject, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, record); err != nil {
+		return nil, fmt.Errorf("failed to render template: %w", err)
+	}
+	if len(bytes.TrimSpace(buf.Bytes())) == 0 {
+		return nil, nil
+	}
+
+	b, err := yaml.YAMLToJSON(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("rendered template is not valid YAML or JSON: %w", err)
+	}
+	obj := &configV1.ConfigObject{}
+	if err := protojson.Unmarshal(b, obj); err != nil {
+		return nil, fmt.Errorf("rendered template is not a valid config object: %w", err)
+	}
+
+	if obj.ApiVersion == "" {
+		obj.ApiVersion = "v1"
+	}
+	if obj.Kind == configV1.Kind_undefined {
+		obj.Kind = t.kind
+	}
+	if obj.Kind != t.kind {
+		return nil, fmt.Errorf("rendered object is a %s, expected %s", obj.Kind, t.kind)
+	}
+	if obj.GetMeta().GetName() == "" {
+		return nil, fmt.Errorf("rendered object is missing meta.name")
+	}
+	return obj, nil
+}
+
+// TemplateKey creates keys of config objects from a template executed with the object as data,
+// e.g. {{.Meta.Name}} or {{.Meta.Name}}/{{.GetCrawlJob.GetScheduleRef.GetId}}.
+type TemplateKey struct {
+	text string
+	tmpl *template.Template
+}
+
+// ParseTemplateKey parses a key template.
+func ParseTemplateKey(text string) (*TemplateKey, error) {
+	tmpl, err := template.New("key").Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key template: %w", err)
+	}
+	return &TemplateKey{text: text, tmpl: tmpl}, nil
+}
+
+// ObjectKey returns the key of the object.
+func (k *TemplateKey) ObjectKey(obj *configV1.ConfigObject) (string, error) {
+	var buf strings.Builder
+	if err := k.tmpl.Execute(&buf, obj); err != nil {
+		return "", fmt.Errorf("failed to create key: %w", err)
+	}
+	key := strings.TrimSpace(buf.String())
+	if key == "" {
+		return "", fmt.Errorf("empty key for %s '%s'", obj.GetKind(), obj.GetMeta().GetName())
+	}
+	return key, nil
+}
+
+// Normalize returns the key of an object with only a name.
+func (k *TemplateKey) Normalize(name string) (string, error) {
+	return k.ObjectKey(&configV1.ConfigObject{Meta: &configV1.Meta{Name: name}})
+}
+
+func (k *TemplateKey) String() string {
+	return "template " + k.text
+}
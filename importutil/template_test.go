@@ -0,0 +1,134 @@
+package importutil
+
+import (
+	"testing"
+	"time"
+
+	configV1 "github.com/nlnwa/veidemann-api/go/config/v1"
+)
+
+const collectionTemplate = `{{if .name}}
+meta:
+  name: {{json .name}}
+  description: {{json (default "none" .description)}}
+  label:
+  {{- range split ";" .labels}}
+  - key: source
+    value: {{json (trim .)}}
+  {{- end}}
+collection:
+  collectionDedupPolicy: {{upper .policy}}
+{{end}}`
+
+func TestObjectTemplateRender(t *testing.T) {
+	tmpl, err := ParseObjectTemplate(collectionTemplate, configV1.Kind_collection)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := tmpl.Render(map[string]interface{}{
+		"name":   "News \"daily\"",
+		"labels": "a; b",
+		"policy": "monthly",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.GetApiVersion() != "v1" || obj.GetKind() != configV1.Kind_collection {
+		t.Errorf("got apiVersion %q and kind %v, want v1 and collection", obj.GetApiVersion(), obj.GetKind())
+	}
+	if obj.GetMeta().GetName() != "News \"daily\"" {
+		t.Errorf("got name %q", obj.GetMeta().GetName())
+	}
+	if obj.GetMeta().GetDescription() != "none" {
+		t.Errorf("got description %q, want default", obj.GetMeta().GetDescription())
+	}
+	if labels := obj.GetMeta().GetLabel(); len(labels) != 2 || labels[1].GetValue() != "b" {
+		t.Errorf("got labels %v", labels)
+	}
+	if obj.GetCollection().GetCollectionDedupPolicy() != configV1.Collection_MONTHLY {
+		t.Errorf("got dedup policy %v", obj.GetCollection().GetCollectionDedupPolicy())
+	}
+
+	// A record rendering to nothing is skipped
+	obj, err = tmpl.Render(map[string]interface{}{"name": ""})
+	if err != nil || obj != nil {
+		t.Errorf("got %v, %v for blank output, want nil, nil", obj, err)
+	}
+}
+
+func TestObjectTemplateRenderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{"kind mismatch", "kind: crawlJob\nmeta:\n  name: x\n"},
+		{"missing name", "meta:\n  description: x\n"},
+		{"unknown field", "meta:\n  name: x\nnoSuchField: 1\n"},
+		{"invalid yaml", "meta: [\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := ParseObjectTemplate(tt.template, configV1.Kind_collection)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tmpl.Render(map[string]interface{}{}); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestTemplateKey(t *testing.T) {
+	key, err := ParseTemplateKey("{{lower .Meta.Name}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := key.ObjectKey(&configV1.ConfigObject{Meta: &configV1.Meta{Name: "Daily"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "daily" {
+		t.Errorf("got key %q, want %q", got, "daily")
+	}
+	if got, _ := key.Normalize("Daily"); got != "daily" {
+		t.Errorf("got normalized key %q, want %q", got, "daily")
+	}
+	if _, err := key.ObjectKey(&configV1.ConfigObject{}); err == nil {
+		t.Error("expected error for empty key")
+	}
+}
+
+func TestImportExistingTemplateKey(t *testing.T) {
+	t0 := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	client := &fakeListClient{objects: []*configV1.ConfigObject{
+		seedObject("1", "Daily", t0),
+		seedObject("2", "daily", t0.Add(time.Hour)),
+		seedObject("3", "Weekly", t0.Add(2*time.Hour)),
+	}}
+	db, err := NewImportDb(InMemory, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	key, err := ParseTemplateKey("{{lower .Meta.Name}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportExisting(db, client, configV1.Kind_seed, key); err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := db.Get("daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("got ids %v for key daily, want 2", ids)
+	}
+	if ids, _ := db.Get("weekly"); len(ids) != 1 || ids[0] != "3" {
+		t.Errorf("got ids %v for key weekly, want [3]", ids)
+	}
+}
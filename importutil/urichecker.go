@@ -2,65 +2,348 @@ package importutil
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 )
 
+// UriCategory classifies the result of a uri check
+type UriCategory string
+
+const (
+	// UriOk is a uri that is reachable
+	UriOk UriCategory = "ok"
+	// UriInvalid is a uri that could not be requested
+	UriInvalid UriCategory = "invalid"
+	// UriDnsError is a uri with a host name that could not be resolved
+	UriDnsError UriCategory = "dns"
+	// UriTlsError is a uri where the TLS handshake or certificate verification failed
+	UriTlsError UriCategory = "tls"
+	// UriTimeout is a uri that did not respond in time
+	UriTimeout UriCategory = "timeout"
+	// UriConnectionError is a uri that failed with another network error
+	UriConnectionError UriCategory = "connection"
+	// UriRedirectError is a uri with too many redirects or a redirect without a valid location
+	UriRedirectError UriCategory = "redirect-error"
+	// UriClientError is a uri responding with a 4xx status code
+	UriClientError UriCategory = "client-error"
+	// UriServerError is a uri responding with a 5xx status code
+	UriServerError UriCategory = "server-error"
+	// UriSoft404 is a uri that looks like a missing page although the status code says otherwise
+	UriSoft404 UriCategory = "soft-404"
+	// UriOffsiteRedirect is a uri redirecting to another registered domain
+	UriOffsiteRedirect UriCategory = "offsite-redirect"
+)
+
+// UriCategories are all categories of uri check results
+var UriCategories = []UriCategory{
+	UriOk, UriInvalid, UriDnsError, UriTlsError, UriTimeout, UriConnectionError, UriRedirectError,
+	UriClientError, UriServerError, UriSoft404, UriOffsiteRedirect,
+}
+
+// maxRedirects is the maximum number of redirects followed when checking a uri
+const maxRedirects = 10
+
+// notFoundPath matches paths of typical not found pages
+var notFoundPath = regexp.MustCompile(`(?i)(^|[/_.-])(404|not-?found|page-?not-?found|error)([/_.-]|$)`)
+
+// notFoundTitle matches titles of typical not found pages
+var notFoundTitle = regexp.MustCompile(`(?i)\b(404|not found|finnes ikke|ikke funnet|fant ikke)\b`)
+
+// UriCheckResult is the result of checking a uri
+type UriCheckResult struct {
+	// Uri is the checked uri with permanent redirects followed, which is the uri to import
+	Uri string `json:"uri"`
+	// FinalUri is the uri at the end of the redirect chain
+	FinalUri string `json:"finalUri"`
+	// Category classifies the result
+	Category UriCategory `json:"category"`
+	// StatusCode is the status code of the last response
+	StatusCode int `json:"statusCode,omitempty"`
+	// RedirectChain is the uris redirected to, in order
+	RedirectChain []string `json:"redirectChain,omitempty"`
+	// Error describes why the check failed
+	Error string `json:"error,omitempty"`
+}
+
 // UriChecker checks if a uri is reachable
 type UriChecker struct {
 	*http.Client
+	// Limiter limits the rate of requests if set
+	Limiter *RequestLimiter
+	// MaxRetries is the number of times a request is retried when the server responds
+	// with 429 or 503 and a Retry-After header
+	MaxRetries int
+	// MaxRetryAfter is the longest Retry-After delay to wait for before retrying, 0 means no limit
+	MaxRetryAfter time.Duration
+	// DetectSoft404 fetches reachable pages to look for titles of not found pages
+	DetectSoft404 bool
+}
+
+// Check checks if a uri is reachable and classifies the result.
+//
+// Redirects are followed. The uri of the result is the checked uri with permanent redirects (301 and 308)
+// from the start of the redirect chain followed.
+func (uc *UriChecker) Check(uri string) *UriCheckResult {
+	result := &UriCheckResult{Uri: uri, FinalUri: uri}
+	permanent := true
+
+	for {
+		resp, err := uc.do(http.MethodHead, result.FinalUri)
+		if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+			// the server does not support HEAD requests
+			_ = resp.Body.Close()
+			resp, err = uc.do(http.MethodGet, result.FinalUri)
+		}
+		if err != nil {
+			result.Category, result.Error = classifyError(err)
+			return result
+		}
+		_ = resp.Body.Close()
+		result.StatusCode = resp.StatusCode
+
+		if !isRedirect(resp.StatusCode) {
+			break
+		}
+		location, err := resp.Location()
+		if err != nil {
+			result.Category = UriRedirectError
+			result.Error = fmt.Sprintf("%s: %v", resp.Status, err)
+			return result
+		}
+		if len(result.RedirectChain) >= maxRedirects {
+			result.Category = UriRedirectError
+			result.Error = "too many redirects"
+			return result
+		}
+		location.Fragment = ""
+		result.RedirectChain = append(result.RedirectChain, location.String())
+		if permanent && (resp.StatusCode == http.StatusMovedPermanently || resp.StatusCode == http.StatusPermanentRedirect) {
+			result.Uri = location.String()
+		} else {
+			permanent = false
+		}
+		result.FinalUri = location.String()
+	}
+
+	switch {
+	case result.StatusCode >= 500:
+		result.Category = UriServerError
+		result.Error = http.StatusText(result.StatusCode)
+	case result.StatusCode >= 400:
+		result.Category = UriClientError
+		result.Error = http.StatusText(result.StatusCode)
+	case isOffsite(uri, result.FinalUri):
+		result.Category = UriOffsiteRedirect
+	case len(result.RedirectChain) > 0 && isNotFoundPath(uri, result.FinalUri):
+		result.Category = UriSoft404
+	case uc.DetectSoft404 && notFoundTitle.MatchString(uc.GetTitle(result.FinalUri)):
+		result.Category = UriSoft404
+	default:
+		result.Category = UriOk
+	}
+	return result
+}
+
+// isRedirect returns true if the status code is a redirect with a location
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
 
-// Check checks if a uri is reachable and returns the uri if it is reachable
-// If the uri is not reachable, it returns an error
-// If the uri is redirected with 301, it returns the redirected uri
-func (uc *UriChecker) Check(uri string) (string, error) {
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodHead, uri, nil)
+// isOffsite returns true if the uris have different registered domains
+func isOffsite(uri string, finalUri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	f, err := url.Parse(finalUri)
 	if err != nil {
-		return "", err
+		return false
 	}
-	resp, err := uc.Client.Do(req)
+	return registeredDomain(strings.ToLower(u.Hostname())) != registeredDomain(strings.ToLower(f.Hostname()))
+}
+
+// isNotFoundPath returns true if the final uri has a path typical of not found pages and the uri does not
+func isNotFoundPath(uri string, finalUri string) bool {
+	u, err := url.Parse(uri)
 	if err != nil {
-		var uerr *url.Error
-		if errors.As(err, &uerr) && uerr.Timeout() {
-			return "", fmt.Errorf("timeout")
+		return false
+	}
+	f, err := url.Parse(finalUri)
+	if err != nil {
+		return false
+	}
+	return notFoundPath.MatchString(f.Path) && !notFoundPath.MatchString(u.Path)
+}
+
+// classifyError returns the category and a description of a failed request
+func classifyError(err error) (UriCategory, string) {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return UriDnsError, fmt.Sprintf("no such host: %s", dnsErr.Name)
+	}
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return UriTlsError, unwrapUrlError(err).Error()
+	}
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		if uerr.Op == "parse" {
+			return UriInvalid, uerr.Error()
 		}
-		var dnsErr *net.DNSError
-		if errors.As(err, &dnsErr) {
-			return "", fmt.Errorf("no such host: %s", dnsErr.Name)
+		if uerr.Timeout() {
+			return UriTimeout, "timeout"
 		}
-		return "", err
+		return UriConnectionError, uerr.Err.Error()
 	}
-	defer resp.Body.Close()
+	return UriInvalid, err.Error()
+}
 
-	if resp.StatusCode == http.StatusMovedPermanently {
-		u, err := resp.Location()
+// unwrapUrlError returns the error wrapped by a url.Error, which does not repeat the method and uri
+func unwrapUrlError(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return uerr.Err
+	}
+	return err
+}
+
+// do sends a request when allowed by the limiter.
+// If the server responds with 429 or 503 and a Retry-After header, the request is retried after the given delay.
+func (uc *UriChecker) do(method string, uri string) (*http.Response, error) {
+	ctx := context.Background()
+	for retries := 0; ; retries++ {
+		req, err := http.NewRequestWithContext(ctx, method, uri, nil)
+		if err != nil {
+			return nil, err
+		}
+		if uc.Limiter != nil {
+			if err := uc.Limiter.Wait(ctx, req.URL.Hostname()); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := uc.Client.Do(req)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			if d, ok := retryAfter(resp, time.Now()); ok && retries < uc.MaxRetries && (uc.MaxRetryAfter == 0 || d <= uc.MaxRetryAfter) {
+				_ = resp.Body.Close()
+				if err := uc.delay(req.URL.Hostname(), d); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		return resp, nil
+	}
+}
+
+// delay holds back requests to the host for the duration d
+func (uc *UriChecker) delay(hostname string, d time.Duration) error {
+	if uc.Limiter != nil {
+		// the next call to Wait for the host blocks until the delay has passed
+		uc.Limiter.Delay(hostname, time.Now().Add(d))
+		return nil
+	}
+	return sleep(context.Background(), d)
+}
+
+// AcceptUsage is the usage of the flag for an accept policy shared by the import commands.
+const AcceptUsage = "Categories (invalid, dns, tls, timeout, connection, redirect-error, client-error, server-error, soft-404, offsite-redirect) " +
+	"or status codes (e.g. 403) of uri checks that are still imported. Accepted uris that are not ok are flagged in the error file. " +
+	"offsite-redirect is accepted unless rejected with -offsite-redirect"
+
+// defaultAccepted are the categories accepted unless rejected.
+// Offsite redirects are accepted since a site moving to a new domain is still the site to import.
+var defaultAccepted = []UriCategory{UriOffsiteRedirect}
+
+// AcceptPolicy decides which uri check results are accepted for import.
+// Results in category ok are always accepted.
+type AcceptPolicy struct {
+	categories  map[UriCategory]bool
+	statusCodes map[int]bool
+}
+
+// ParseAcceptPolicy creates a policy accepting the given categories (e.g. soft-404) and
+// status codes (e.g. 403) of client and server errors, in addition to the categories accepted by default.
+// A category prefixed with '-' (e.g. -offsite-redirect) is rejected.
+func ParseAcceptPolicy(accept []string) (*AcceptPolicy, error) {
+	p := &AcceptPolicy{
+		categories:  map[UriCategory]bool{UriOk: true},
+		statusCodes: make(map[int]bool),
+	}
+	for _, c := range defaultAccepted {
+		p.categories[c] = true
+	}
+	for _, a := range accept {
+		a = strings.TrimSpace(a)
+		if reject, ok := strings.CutPrefix(a, "-"); ok {
+			if !isUriCategory(UriCategory(reject)) || UriCategory(reject) == UriOk {
+				return nil, fmt.Errorf("invalid category to reject: %s", reject)
+			}
+			delete(p.categories, UriCategory(reject))
+			continue
+		}
+		if code, err := strconv.Atoi(a); err == nil {
+			if code < 400 || code > 599 {
+				return nil, fmt.Errorf("invalid status code to accept: %d (must be 4xx or 5xx)", code)
+			}
+			p.statusCodes[code] = true
+			continue
 		}
-		return u.String(), nil
+		if !isUriCategory(UriCategory(a)) {
+			return nil, fmt.Errorf("invalid category to accept: %s", a)
+		}
+		p.categories[UriCategory(a)] = true
 	}
+	return p, nil
+}
 
-	if resp.StatusCode < 400 {
-		return uri, nil
+// Accept returns true if the result is accepted for import.
+func (p *AcceptPolicy) Accept(r *UriCheckResult) bool {
+	if p.categories[r.Category] {
+		return true
+	}
+	if r.Category == UriClientError || r.Category == UriServerError {
+		return p.statusCodes[r.StatusCode]
 	}
+	return false
+}
 
-	return uri, fmt.Errorf("%s", resp.Status)
+func isUriCategory(c UriCategory) bool {
+	for _, category := range UriCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
 }
 
 // GetTitle returns the title of the uri
 func (uc *UriChecker) GetTitle(uri string) string {
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, uri, nil)
-	if err != nil {
-		return ""
-	}
-	resp, err := uc.Client.Do(req)
+	resp, err := uc.do(http.MethodGet, uri)
 	if err != nil {
 		return ""
 	}
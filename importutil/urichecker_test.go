@@ -1,32 +1,329 @@
 package importutil
 
 import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
 
 func TestUriChecker(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the wiki has moved its front page
+		if r.Host == "wiki.example.no" && r.URL.Path == "/" {
+			http.Redirect(w, r, "/wiki/Main_Page", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
 
 	uriChecker := &UriChecker{
-		Client: NewHttpClient(5*time.Second, false),
+		Client: newTestClient(ts, 5*time.Second),
 	}
 
 	tests := []struct {
 		uri  string
 		want string
 	}{
-		{"https://www.nb.no/", "https://www.nb.no/"},
-		{"https://lokalhistoriewiki.no", "https://lokalhistoriewiki.no/wiki/Lokalhistoriewiki:Hovedside"},
+		{"http://www.example.no/", "http://www.example.no/"},
+		{"http://wiki.example.no", "http://wiki.example.no/wiki/Main_Page"},
+	}
+
+	for _, tt := range tests {
+		got := uriChecker.Check(tt.uri)
+		if got.Category != UriOk {
+			t.Error(got.Error)
+		}
+
+		if got.Uri != tt.want {
+			t.Errorf("Want %s, got %s", tt.want, got.Uri)
+		}
+	}
+}
+
+// newTestClient returns a client connecting to the test server whatever the host of the request is.
+func newTestClient(ts *httptest.Server, timeout time.Duration) *http.Client {
+	c := NewHttpClient(timeout, false)
+	c.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, network, ts.Listener.Addr().String())
+	}
+	return c
+}
+
+func TestUriCheckerClassify(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/found":
+			http.Redirect(w, r, "/new", http.StatusFound)
+		case "/moved-found":
+			http.Redirect(w, r, "/found", http.StatusPermanentRedirect)
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+		case "/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/gone":
+			http.Redirect(w, r, "/404.html", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, "http://www.example.org/", http.StatusMovedPermanently)
+		case "/sub":
+			http.Redirect(w, r, "http://news.example.com/", http.StatusMovedPermanently)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/titled":
+			_, _ = w.Write([]byte("<html><head><title>Siden finnes ikke</title></head></html>"))
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/no-head-moved":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotImplemented)
+				return
+			}
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		}
+	}))
+	defer ts.Close()
+
+	const base = "http://www.example.com"
+
+	tests := []struct {
+		path          string
+		detectSoft404 bool
+		want          UriCheckResult
+	}{
+		{"/", false, UriCheckResult{Uri: base + "/", FinalUri: base + "/", Category: UriOk, StatusCode: 200}},
+		{"/moved", false, UriCheckResult{Uri: base + "/new", FinalUri: base + "/new", Category: UriOk, StatusCode: 200,
+			RedirectChain: []string{base + "/new"}}},
+		{"/found", false, UriCheckResult{Uri: base + "/found", FinalUri: base + "/new", Category: UriOk, StatusCode: 200,
+			RedirectChain: []string{base + "/new"}}},
+		{"/moved-found", false, UriCheckResult{Uri: base + "/found", FinalUri: base + "/new", Category: UriOk, StatusCode: 200,
+			RedirectChain: []string{base + "/found", base + "/new"}}},
+		{"/missing", false, UriCheckResult{Uri: base + "/missing", FinalUri: base + "/missing", Category: UriClientError, StatusCode: 404,
+			Error: "Not Found"}},
+		{"/broken", false, UriCheckResult{Uri: base + "/broken", FinalUri: base + "/broken", Category: UriServerError, StatusCode: 500,
+			Error: "Internal Server Error"}},
+		{"/gone", false, UriCheckResult{Uri: base + "/gone", FinalUri: base + "/404.html", Category: UriSoft404, StatusCode: 200,
+			RedirectChain: []string{base + "/404.html"}}},
+		{"/away", false, UriCheckResult{Uri: "http://www.example.org/", FinalUri: "http://www.example.org/", Category: UriOffsiteRedirect, StatusCode: 200,
+			RedirectChain: []string{"http://www.example.org/"}}},
+		{"/sub", false, UriCheckResult{Uri: "http://news.example.com/", FinalUri: "http://news.example.com/", Category: UriOk, StatusCode: 200,
+			RedirectChain: []string{"http://news.example.com/"}}},
+		{"/titled", false, UriCheckResult{Uri: base + "/titled", FinalUri: base + "/titled", Category: UriOk, StatusCode: 200}},
+		{"/titled", true, UriCheckResult{Uri: base + "/titled", FinalUri: base + "/titled", Category: UriSoft404, StatusCode: 200}},
+		{"/no-head", false, UriCheckResult{Uri: base + "/no-head", FinalUri: base + "/no-head", Category: UriOk, StatusCode: 200}},
+		{"/no-head-moved", false, UriCheckResult{Uri: base + "/new", FinalUri: base + "/new", Category: UriOk, StatusCode: 200,
+			RedirectChain: []string{base + "/new"}}},
+		{"/slow", false, UriCheckResult{Uri: base + "/slow", FinalUri: base + "/slow", Category: UriTimeout, Error: "timeout"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			uriChecker := &UriChecker{
+				Client:        newTestClient(ts, 200*time.Millisecond),
+				DetectSoft404: tt.detectSoft404,
+			}
+			got := uriChecker.Check(base + tt.path)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("Check() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	t.Run("/loop", func(t *testing.T) {
+		uriChecker := &UriChecker{Client: newTestClient(ts, time.Second)}
+		got := uriChecker.Check(base + "/loop")
+		if got.Category != UriRedirectError || len(got.RedirectChain) != maxRedirects {
+			t.Errorf("Expected %s after %d redirects, got %s after %d", UriRedirectError, maxRedirects, got.Category, len(got.RedirectChain))
+		}
+	})
+}
+
+func TestUriCheckerNetworkErrors(t *testing.T) {
+	tlsServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// the handshake error is expected
+	tlsServer.Config.ErrorLog = log.New(io.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	closedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closedServer.Close()
+
+	uriChecker := &UriChecker{Client: NewHttpClient(time.Second, false)}
+
+	tests := []struct {
+		name string
+		uri  string
+		want UriCategory
+	}{
+		{"tls", tlsServer.URL, UriTlsError},
+		{"connection", closedServer.URL, UriConnectionError},
+		{"dns", "http://host.invalid/", UriDnsError},
+		{"invalid", "http://[::1", UriInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := uriChecker.Check(tt.uri)
+			if got.Category != tt.want {
+				t.Errorf("Check() category = %s (%s), want %s", got.Category, got.Error, tt.want)
+			}
+			if got.Error == "" {
+				t.Error("Expected error description")
+			}
+		})
+	}
+}
+
+func TestAcceptPolicy(t *testing.T) {
+	policy, err := ParseAcceptPolicy([]string{"offsite-redirect", "403"})
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	tests := []struct {
+		result UriCheckResult
+		want   bool
+	}{
+		{UriCheckResult{Category: UriOk, StatusCode: 200}, true},
+		{UriCheckResult{Category: UriOffsiteRedirect, StatusCode: 200}, true},
+		{UriCheckResult{Category: UriClientError, StatusCode: 403}, true},
+		{UriCheckResult{Category: UriClientError, StatusCode: 404}, false},
+		{UriCheckResult{Category: UriSoft404, StatusCode: 200}, false},
+		{UriCheckResult{Category: UriDnsError}, false},
+	}
 	for _, tt := range tests {
-		got, err := uriChecker.Check(tt.uri)
-		if err != nil {
-			t.Error(err)
+		if got := policy.Accept(&tt.result); got != tt.want {
+			t.Errorf("Accept(%s %d) = %v, want %v", tt.result.Category, tt.result.StatusCode, got, tt.want)
 		}
+	}
 
-		if got != tt.want {
-			t.Errorf("Want %s, got %s", tt.want, got)
+	// Offsite redirects are accepted unless rejected
+	policy, err = ParseAcceptPolicy(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !policy.Accept(&UriCheckResult{Category: UriOffsiteRedirect, StatusCode: 200}) {
+		t.Error("Expected offsite redirect to be accepted by default")
+	}
+	policy, err = ParseAcceptPolicy([]string{"-offsite-redirect"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Accept(&UriCheckResult{Category: UriOffsiteRedirect, StatusCode: 200}) {
+		t.Error("Expected rejected offsite redirect not to be accepted")
+	}
+
+	for _, invalid := range []string{"unknown", "200", "-ok", "-unknown"} {
+		if _, err := ParseAcceptPolicy([]string{invalid}); err == nil {
+			t.Errorf("Expected error for %q", invalid)
+		}
+	}
+}
+
+func TestUriCheckerRetryAfter(t *testing.T) {
+	var requests atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		switch r.URL.Path {
+		case "/busy":
+			// busy on first request
+			if n == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+			}
+		case "/long":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
 		}
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name         string
+		path         string
+		limiter      *RequestLimiter
+		wantErr      bool
+		wantRequests int32
+		wantMinDelay time.Duration
+	}{
+		{"retry", "/busy", nil, false, 2, time.Second},
+		{"retry with limiter", "/busy", NewRequestLimiter(0, 0), false, 2, time.Second},
+		{"retry after too long", "/long", nil, true, 1, 0},
+		{"no retry after", "/unavailable", nil, true, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests.Store(0)
+			uriChecker := &UriChecker{
+				Client:        NewHttpClient(5*time.Second, false),
+				Limiter:       tt.limiter,
+				MaxRetries:    2,
+				MaxRetryAfter: time.Minute,
+			}
+
+			start := time.Now()
+			got := uriChecker.Check(ts.URL + tt.path)
+			elapsed := time.Since(start)
+
+			if (got.Category != UriOk) != tt.wantErr {
+				t.Errorf("Check() category = %s, wantErr %v", got.Category, tt.wantErr)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("Expected %d requests, got %d", tt.wantRequests, got)
+			}
+			if elapsed < tt.wantMinDelay {
+				t.Errorf("Expected retry after at least %s, got %s", tt.wantMinDelay, elapsed)
+			}
+		})
+	}
+}
+
+func TestUriCheckerHostRate(t *testing.T) {
+	var m sync.Mutex
+	var times []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.Lock()
+		times = append(times, time.Now())
+		m.Unlock()
+	}))
+	defer ts.Close()
+
+	uriChecker := &UriChecker{
+		Client:  NewHttpClient(5*time.Second, false),
+		Limiter: NewRequestLimiter(0, 20),
+	}
+
+	// Check concurrently like when run by the executor
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got := uriChecker.Check(ts.URL); got.Category != UriOk {
+				t.Error(got.Error)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(times) != 5 {
+		t.Fatalf("Expected 5 requests, got %d", len(times))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	// 20 requests per second to one host spreads 5 requests over at least 200ms
+	if d := times[4].Sub(times[0]); d < 190*time.Millisecond {
+		t.Errorf("Expected requests to be spread over at least 200ms, got %s", d)
 	}
 }
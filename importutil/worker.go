@@ -18,6 +18,7 @@ package importutil
 
 import (
 	"sync"
+	"sync/atomic"
 )
 
 // Payload is an interface for the payload of a job in a work queue
@@ -34,14 +35,11 @@ type Job[P Payload] struct {
 // Executor is a work queue that executes jobs in concurrent workers.
 type Executor[P Payload] struct {
 	Queue chan Job[P]
-	stats chan error
-	done  chan struct{}
 	wg    sync.WaitGroup
 
-	// Keep track of the number of jobs completed and the number of jobs that failed.
-	count   int
-	success int
-	failed  int
+	// Keep track of the number of jobs that succeeded and the number of jobs that failed.
+	success atomic.Int64
+	failed  atomic.Int64
 }
 
 // NewExecutor creates a work queue with nrOfWorkers workers.
@@ -52,25 +50,16 @@ type Executor[P Payload] struct {
 // To close the work queue, call Wait() after all jobs have been queued.
 // Writing to the Queue channel after Wait() has been called will panic.
 func NewExecutor[P Payload](nrOfWorkers int, do func(P) error, onError func(Job[P])) *Executor[P] {
+	return NewExecutorWithDone(nrOfWorkers, do, onError, nil)
+}
+
+// NewExecutorWithDone is like NewExecutor, but onDone is called for every job after it has been processed,
+// whether it failed or not. onDone is called after onError and may be nil.
+func NewExecutorWithDone[P Payload](nrOfWorkers int, do func(P) error, onError func(Job[P]), onDone func(Job[P])) *Executor[P] {
 	e := &Executor[P]{
 		Queue: make(chan Job[P], nrOfWorkers),
-		done:  make(chan struct{}),
-		stats: make(chan error, nrOfWorkers),
 	}
 
-	// start error handler
-	go func() {
-		defer close(e.done)
-		for err := range e.stats {
-			e.count++
-			if err == nil {
-				e.success++
-			} else {
-				e.failed++
-			}
-		}
-	}()
-
 	// start workers
 	for i := 0; i < nrOfWorkers; i++ {
 		e.wg.Add(1)
@@ -78,11 +67,16 @@ func NewExecutor[P Payload](nrOfWorkers int, do func(P) error, onError func(Job[
 			defer e.wg.Done()
 			for job := range e.Queue {
 				err := do(job.Val)
-				e.stats <- err
-				if err != nil {
+				if err == nil {
+					e.success.Add(1)
+				} else {
+					e.failed.Add(1)
 					job.err = err
 					onError(job)
 				}
+				if onDone != nil {
+					onDone(job)
+				}
 			}
 		}()
 	}
@@ -90,6 +84,14 @@ func NewExecutor[P Payload](nrOfWorkers int, do func(P) error, onError func(Job[
 	return e
 }
 
+// Stats returns the number of jobs completed, the number of jobs that succeeded and the number of jobs that failed
+// so far. It is safe to call while jobs are running.
+func (e *Executor[P]) Stats() (count int, success int, failed int) {
+	success = int(e.success.Load())
+	failed = int(e.failed.Load())
+	return success + failed, success, failed
+}
+
 // Wait waits for all jobs to complete.
 // It returns the number of jobs completed, the number of jobs that succeeded and the number of jobs that failed.
 func (e *Executor[P]) Wait() (int, int, int) {
@@ -97,10 +99,6 @@ func (e *Executor[P]) Wait() (int, int, int) {
 	close(e.Queue)
 	// wait for workers to finish
 	e.wg.Wait()
-	// stop counting
-	close(e.stats)
-	// wait for counting to complete
-	<-e.done
 	// return stats
-	return e.count, e.success, e.failed
+	return e.Stats()
 }
@@ -0,0 +1,37 @@
+package importutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestExecutorStats(t *testing.T) {
+	release := make(chan error)
+	e := NewExecutor(2, func(err error) error { return <-release }, func(Job[error]) {})
+
+	for i := 0; i < 4; i++ {
+		e.Queue <- Job[error]{State: &State{}}
+	}
+	release <- nil
+	release <- errors.New("failed")
+
+	// Stats are updated while jobs are running
+	deadline := time.Now().Add(time.Second)
+	for {
+		count, success, failed := e.Stats()
+		if count == 2 && success == 1 && failed == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got stats %d, %d, %d, want 2, 1, 1", count, success, failed)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	release <- nil
+	release <- nil
+	if count, success, failed := e.Wait(); count != 4 || success != 3 || failed != 1 {
+		t.Errorf("got stats %d, %d, %d, want 4, 3, 1", count, success, failed)
+	}
+}
@@ -17,9 +17,11 @@
 package logger
 
 import (
+	"io"
 	stdlog "log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -32,6 +34,38 @@ const (
 	formatPretty = "pretty"
 )
 
+// Stderr is the destination of log output. It writes to os.Stderr unless redirected by Redirect.
+var Stderr io.Writer = stderr
+
+var stderr = &redirectWriter{w: os.Stderr}
+
+// redirectWriter is a writer whose destination can be changed while in use.
+type redirectWriter struct {
+	mu sync.RWMutex
+	w  io.Writer
+}
+
+func (r *redirectWriter) Write(p []byte) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.w.Write(p)
+}
+
+// Redirect writes log output to w instead of os.Stderr until restore is called,
+// e.g. to keep log lines from being written over a progress bar.
+func Redirect(w io.Writer) (restore func()) {
+	stderr.mu.Lock()
+	prev := stderr.w
+	stderr.w = w
+	stderr.mu.Unlock()
+
+	return func() {
+		stderr.mu.Lock()
+		stderr.w = prev
+		stderr.mu.Unlock()
+	}
+}
+
 // InitLogger initializes the logger with the given level and format.
 // If logCaller is true, the caller is logged.
 func InitLogger(level string, format string, logCaller bool) {
@@ -57,7 +91,9 @@ func InitLogger(level string, format string, logCaller bool) {
 	}
 
 	if strings.ToLower(format) != formatJson {
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: Stderr, TimeFormat: time.RFC3339})
+	} else {
+		log.Logger = log.Output(Stderr)
 	}
 
 	if logCaller {